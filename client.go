@@ -155,6 +155,16 @@ type Options struct {
 	ZDBBin   string
 
 	ZDBCacheTTLSeconds int32
+
+	Safety *SafetyOptions
+
+	// KeyStore holds encryption keys for datasets created with a key. Nil stores
+	// them as files in DefaultKeyDir.
+	KeyStore KeyStore
+
+	// ShareStyle is the sharenfs syntax of the host zfs runs on. It may be empty
+	// with the local runner, which uses DefaultShareStyle.
+	ShareStyle ShareStyle
 }
 
 func NewClient(opts Options) *Client {
@@ -177,7 +187,7 @@ func NewClient(opts Options) *Client {
 		zdbCacheTTL = 5 * time.Minute
 	}
 
-	zfsC := &zfs{cmd: zfsCmd}
+	zfsC := &zfs{cmd: zfsCmd, safety: opts.Safety, keys: opts.KeyStore, shareStyle: opts.ShareStyle}
 	zdbC := &zdb{cmd: zdbCmd, cacheTTL: zdbCacheTTL}
 	zpoolC := &zpool{cmd: zpoolCmd, zdb: zdbC, zfs: zfsC}
 
@@ -23,6 +23,30 @@ type ZFSPropertySource struct {
 	Data string `json:"data"`
 }
 
+// PropertyOrigin describes where a property value comes from, as reported in the
+// SOURCE column of zfs get.
+type PropertyOrigin string
+
+const (
+	OriginLocal     PropertyOrigin = "local"
+	OriginInherited PropertyOrigin = "inherited"
+	OriginReceived  PropertyOrigin = "received"
+	OriginDefault   PropertyOrigin = "default"
+	OriginTemporary PropertyOrigin = "temporary"
+	OriginNone      PropertyOrigin = "none"
+)
+
+// Origin normalises the source type, which zfs reports in upper case in JSON output
+// and in lower case in text output.
+func (s ZFSPropertySource) Origin() PropertyOrigin {
+	switch t := strings.ToLower(strings.TrimSpace(s.Type)); t {
+	case "", "-":
+		return OriginNone
+	default:
+		return PropertyOrigin(t)
+	}
+}
+
 var (
 	zdbArgs    = []string{"-C"}
 	zpoolArgs  = []string{"-p"}
@@ -34,9 +58,62 @@ var (
 		"aclmode", "aclinherit", "primarycache", "volmode", "compressratio",
 		"atime", "dedup", "volblocksize", "encryption", "encryptionroot",
 		"keyformat", "keylocation", "refreservation", "readonly",
+		"creation", "refquota", "reservation", "sync", "canmount",
 	}
+	dsPropSets = map[string][]string{
+		PropertySetMinimal: {"name", "guid"},
+		PropertySetSpace: {
+			"name", "guid", "used", "available", "referenced", "usedbydataset",
+			"usedbysnapshots", "usedbychildren", "usedbyrefreservation",
+			"logicalused", "logicalreferenced", "quota", "refquota",
+			"reservation", "refreservation", "written", "compressratio", "volsize",
+		},
+		PropertySetEncryption: {
+			"name", "guid", "encryption", "encryptionroot", "keyformat",
+			"keylocation", "keystatus", "pbkdf2iters",
+		},
+	}
+)
+
+// Named property sets accepted wherever a property selection is taken.
+const (
+	PropertySetMinimal    = "minimal"
+	PropertySetSpace      = "space"
+	PropertySetEncryption = "encryption"
+	PropertySetAll        = "all"
 )
 
+// resolvePropertyList expands named sets in selection into zfs property names. An
+// empty selection yields the default property list.
+func resolvePropertyList(selection []string) []string {
+	if len(selection) == 0 {
+		return dsPropList
+	}
+
+	seen := map[string]bool{"name": true}
+	props := []string{"name"}
+
+	for _, entry := range selection {
+		if entry == PropertySetAll {
+			return []string{"all"}
+		}
+
+		expanded, ok := dsPropSets[entry]
+		if !ok {
+			expanded = []string{entry}
+		}
+
+		for _, p := range expanded {
+			if !seen[p] {
+				seen[p] = true
+				props = append(props, p)
+			}
+		}
+	}
+
+	return props
+}
+
 func ParseSize(value string) uint64 {
 	s := strings.TrimSpace(value)
 	if s == "" || s == "-" {
@@ -1,6 +1,7 @@
 package gzfs
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -166,3 +167,25 @@ func TestGenerateDeterministicUUID(t *testing.T) {
 		t.Errorf("GenerateDeterministicUUID should produce different UUIDs for different inputs, but got same: %q", uuid1)
 	}
 }
+
+func TestResolvePropertyList(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection []string
+		expected  string
+	}{
+		{"default", nil, strings.Join(dsPropList, ",")},
+		{"minimal", []string{"minimal"}, "name,guid"},
+		{"all", []string{"used", "all"}, "all"},
+		{"explicit", []string{"creation", "usedbysnapshots", "com.ourco:tag"}, "name,creation,usedbysnapshots,com.ourco:tag"},
+		{"set and explicit deduplicated", []string{"encryption", "guid", "origin"}, "name,guid,encryption,encryptionroot,keyformat,keylocation,keystatus,pbkdf2iters,origin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(resolvePropertyList(tt.selection), ","); got != tt.expected {
+				t.Errorf("resolvePropertyList(%v) = %q, want %q", tt.selection, got, tt.expected)
+			}
+		})
+	}
+}
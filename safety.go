@@ -0,0 +1,349 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SafetyOptions configures guardrails enforced before destructive operations. A nil
+// SafetyOptions on Options disables all checks.
+type SafetyOptions struct {
+	// Protected lists dataset names or path.Match patterns that may not be destroyed,
+	// rolled back or renamed. Matching a file system or volume also protects its
+	// descendants; snapshots are only protected by entries matching their full name.
+	// Recursive destroys, renames and pool destroys are also refused when an entry
+	// lies below the target.
+	Protected []string
+	// MaxRecursiveDestroy caps how many datasets a single recursive destroy may remove.
+	// Zero means no limit.
+	MaxRecursiveDestroy int
+	// RequirePoolDestroyConfirmation makes ZPool.Destroy require the pool name as a
+	// confirmation token.
+	RequirePoolDestroyConfirmation bool
+}
+
+// PathHolder is a process holding a file, working directory or root under a path.
+type PathHolder struct {
+	PID     int      `json:"pid"`
+	Command string   `json:"command"`
+	Paths   []string `json:"paths"`
+}
+
+var procRoot = "/proc"
+
+// destroyCheckBatch is how many datasets checkDestroyTargets passes to one zfs get.
+var destroyCheckBatch = 256
+
+func parentDatasetName(name string) string {
+	i := strings.LastIndex(name, "/")
+	if i < 0 {
+		return ""
+	}
+	return name[:i]
+}
+
+func (s *SafetyOptions) isProtected(name string) bool {
+	if s == nil {
+		return false
+	}
+
+	for _, pattern := range s.Protected {
+		if strings.Contains(name, "@") {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+			continue
+		}
+
+		for candidate := name; candidate != ""; candidate = parentDatasetName(candidate) {
+			if ok, _ := path.Match(pattern, candidate); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// hasProtectedDescendant reports whether a Protected entry could match a descendant
+// of name, or a snapshot of name or of a descendant. Patterns are matched one path
+// component at a time, so "tank/db-*" counts as under "tank" even if no such dataset
+// exists yet.
+func (s *SafetyOptions) hasProtectedDescendant(name string) bool {
+	if s == nil || strings.Contains(name, "@") {
+		return false
+	}
+
+	parts := strings.Split(name, "/")
+
+	for _, pattern := range s.Protected {
+		dataset, _, isSnap := strings.Cut(pattern, "@")
+		patternParts := strings.Split(dataset, "/")
+		if len(patternParts) < len(parts) || (len(patternParts) == len(parts) && !isSnap) {
+			continue
+		}
+
+		matched := true
+		for i, part := range parts {
+			if ok, _ := path.Match(patternParts[i], part); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *SafetyOptions) checkProtected(name string) error {
+	if s.isProtected(name) {
+		return fmt.Errorf("dataset_protected: %s", name)
+	}
+	return nil
+}
+
+// checkProtectedTree refuses name when it or anything below it is protected, for
+// operations that take the whole subtree with them.
+func (s *SafetyOptions) checkProtectedTree(name string) error {
+	if err := s.checkProtected(name); err != nil {
+		return err
+	}
+	if s.hasProtectedDescendant(name) {
+		return fmt.Errorf("dataset_has_protected_descendant: %s", name)
+	}
+	return nil
+}
+
+// findPathHolders scans the Linux-style /proc under root. It fails when root has no
+// per-process cwd, root or fd entries to read, as on FreeBSD, rather than reporting
+// that nothing holds target.
+func findPathHolders(root, target string) ([]PathHolder, error) {
+	target = filepath.Clean(target)
+	within := func(p string) bool {
+		return p == target || strings.HasPrefix(p, target+"/")
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("path_holders_unavailable: %w", err)
+	}
+
+	var holders []PathHolder
+	readable := false
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		procDir := filepath.Join(root, entry.Name())
+		var paths []string
+
+		for _, link := range []string{"cwd", "root"} {
+			p, err := os.Readlink(filepath.Join(procDir, link))
+			if err != nil {
+				continue
+			}
+			readable = true
+			if within(p) {
+				paths = append(paths, p)
+			}
+		}
+
+		fds, err := os.ReadDir(filepath.Join(procDir, "fd"))
+		if err == nil {
+			readable = true
+		}
+		for _, fd := range fds {
+			if p, err := os.Readlink(filepath.Join(procDir, "fd", fd.Name())); err == nil && within(p) {
+				paths = append(paths, p)
+			}
+		}
+
+		if len(paths) == 0 {
+			continue
+		}
+
+		comm, _ := os.ReadFile(filepath.Join(procDir, "comm"))
+		holders = append(holders, PathHolder{
+			PID:     pid,
+			Command: strings.TrimSpace(string(comm)),
+			Paths:   paths,
+		})
+	}
+
+	if !readable {
+		return nil, fmt.Errorf("path_holders_unavailable: no process entries in %s", root)
+	}
+
+	return holders, nil
+}
+
+func (z *zfs) checkDestroy(ctx context.Context, target string, opts DestroyOptions) error {
+	s := z.safety
+	if s == nil {
+		return nil
+	}
+
+	plan, err := z.PlanDestroy(ctx, target, opts)
+	if err != nil {
+		return err
+	}
+
+	recursive := opts.Recursive || opts.Dependents
+	if err := s.checkPlanned(plan.Datasets, recursive); err != nil {
+		return err
+	}
+
+	if recursive {
+		if err := s.checkProtectedTree(target); err != nil {
+			return err
+		}
+	}
+
+	return z.checkDestroyTargets(ctx, plan.Datasets, opts)
+}
+
+// checkPlanned applies MaxRecursiveDestroy and Protected to the datasets an operation
+// would destroy.
+func (s *SafetyOptions) checkPlanned(names []string, recursive bool) error {
+	if s.MaxRecursiveDestroy > 0 && recursive && len(names) > s.MaxRecursiveDestroy {
+		return fmt.Errorf("recursive_destroy_limit_exceeded: %d datasets (max %d)", len(names), s.MaxRecursiveDestroy)
+	}
+
+	for _, name := range names {
+		if err := s.checkProtected(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkDestroyTargets refuses to destroy held, cloned or busy datasets unless opts
+// allows it.
+func (z *zfs) checkDestroyTargets(ctx context.Context, names []string, opts DestroyOptions) error {
+	if len(names) == 0 || (opts.AllowBusy && opts.AllowHolds && opts.AllowClones) {
+		return nil
+	}
+
+	// Recursive destroys can plan thousands of snapshots, so they are queried in
+	// batches to stay clear of the argument length limit.
+	datasets := make(map[string]*Dataset, len(names))
+	for start := 0; start < len(names); start += destroyCheckBatch {
+		end := min(start+destroyCheckBatch, len(names))
+
+		var resp DatasetList
+		args := append([]string{"get"}, zfsArgs...)
+		args = append(args, "mounted,mountpoint,userrefs,clones")
+		args = append(args, names[start:end]...)
+
+		if err := z.cmd.RunJSON(ctx, &resp, args...); err != nil {
+			return fmt.Errorf("error_checking_destroy_targets: %w", err)
+		}
+		for name, ds := range resp.Datasets {
+			datasets[name] = ds
+		}
+	}
+
+	for _, name := range names {
+		ds, ok := datasets[name]
+		if !ok || ds == nil {
+			continue
+		}
+
+		if !opts.AllowHolds && !opts.Defer && ParseUint64(ds.Properties["userrefs"].Value) > 0 {
+			return fmt.Errorf("dataset_has_holds: %s", name)
+		}
+
+		if !opts.AllowClones && ParseString(ds.Properties["clones"].Value) != "" {
+			return fmt.Errorf("dataset_has_clones: %s", name)
+		}
+
+		if !opts.AllowBusy && ds.Properties["mounted"].Value == "yes" {
+			mountpoint := ParseString(ds.Properties["mountpoint"].Value)
+			if !strings.HasPrefix(mountpoint, "/") {
+				continue
+			}
+
+			holders, err := findPathHolders(procRoot, mountpoint)
+			if err != nil {
+				return fmt.Errorf("dataset_busy_check_failed: %s: %w", name, err)
+			}
+			if len(holders) > 0 {
+				return fmt.Errorf("dataset_busy: %s", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkRollback protects the dataset being rolled back and, with destroyMoreRecent,
+// checks the snapshots rollback -r would destroy like a recursive destroy.
+func (z *zfs) checkRollback(ctx context.Context, snapshot string, destroyMoreRecent bool) error {
+	s := z.safety
+	if s == nil {
+		return nil
+	}
+
+	dataset, snap, _ := strings.Cut(snapshot, "@")
+	if err := s.checkProtected(dataset); err != nil {
+		return err
+	}
+	if !destroyMoreRecent || snap == "" {
+		return nil
+	}
+
+	// The range from the target snapshot to the newest one is exactly what rollback -r
+	// removes, plus the target itself.
+	plan, err := z.PlanDestroy(ctx, SnapshotRange(dataset, snap, ""), DestroyOptions{})
+	if err != nil {
+		return err
+	}
+
+	newer := make([]string, 0, len(plan.Datasets))
+	for _, name := range plan.Datasets {
+		if name != snapshot {
+			newer = append(newer, name)
+		}
+	}
+
+	if err := s.checkPlanned(newer, true); err != nil {
+		return err
+	}
+
+	return z.checkDestroyTargets(ctx, newer, DestroyOptions{})
+}
+
+// checkRename refuses renames that would move a protected dataset, including a
+// protected descendant or snapshot carried along with oldName.
+func (z *zfs) checkRename(oldName string) error {
+	return z.safety.checkProtectedTree(oldName)
+}
+
+func (z *zfs) checkPoolDestroy(pool, confirm string) error {
+	s := z.safety
+	if s == nil {
+		return nil
+	}
+
+	if err := s.checkProtectedTree(pool); err != nil {
+		return err
+	}
+
+	if s.RequirePoolDestroyConfirmation && confirm != pool {
+		return fmt.Errorf("pool_destroy_confirmation_required: %s", pool)
+	}
+
+	return nil
+}
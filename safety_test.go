@@ -0,0 +1,408 @@
+package gzfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func destroyCheckJSON(name, mounted, mountpoint, userrefs, clones string) string {
+	return `{
+  "output_version": {"command": "zfs get", "vers_major": 0, "vers_minor": 1},
+  "datasets": {
+    "` + name + `": {
+      "name": "` + name + `",
+      "properties": {
+        "mounted": {"value": "` + mounted + `", "source": {"type": "none", "data": ""}},
+        "mountpoint": {"value": "` + mountpoint + `", "source": {"type": "default", "data": ""}},
+        "userrefs": {"value": "` + userrefs + `", "source": {"type": "none", "data": ""}},
+        "clones": {"value": "` + clones + `", "source": {"type": "none", "data": ""}}
+      }
+    }
+  }
+}`
+}
+
+func TestSafetyOptions_IsProtected(t *testing.T) {
+	s := &SafetyOptions{Protected: []string{"tank/prod", "tank/db-*", "tank/vm@gold"}}
+
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"tank/prod", true},
+		{"tank/prod/web", true},
+		{"tank/prod@daily", false},
+		{"tank/db-main", true},
+		{"tank/db-main/wal", true},
+		{"tank/vm@gold", true},
+		{"tank/vm@silver", false},
+		{"tank/dev", false},
+		{"tank", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.isProtected(tt.name); got != tt.expected {
+				t.Errorf("isProtected(%q) = %v, want %v", tt.name, got, tt.expected)
+			}
+		})
+	}
+
+	var nilSafety *SafetyOptions
+	if nilSafety.isProtected("tank/prod") {
+		t.Error("nil SafetyOptions should not protect anything")
+	}
+}
+
+func TestSafetyOptions_HasProtectedDescendant(t *testing.T) {
+	s := &SafetyOptions{Protected: []string{"tank/a/prod", "tank/db-*", "tank/vm@gold"}}
+
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"tank", true},
+		{"tank/a", true},
+		{"tank/a/prod", false},
+		{"tank/vm", true},
+		{"tank/b", false},
+		{"other", false},
+		{"tank@daily", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.hasProtectedDescendant(tt.name); got != tt.expected {
+				t.Errorf("hasProtectedDescendant(%q) = %v, want %v", tt.name, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestZFS_DestroySafety(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		safety      *SafetyOptions
+		opts        DestroyOptions
+		plan        string
+		check       string
+		errContains string
+	}{
+		{
+			name:   "no safety configured",
+			safety: nil,
+			opts:   DestroyOptions{Recursive: true},
+		},
+		{
+			name:        "protected descendant",
+			safety:      &SafetyOptions{Protected: []string{"tank/app/db"}},
+			opts:        DestroyOptions{Recursive: true},
+			plan:        "destroy\ttank/app/db\ndestroy\ttank/app\nreclaim\t10\n",
+			errContains: "dataset_protected: tank/app/db",
+		},
+		{
+			name:        "recursive limit exceeded",
+			safety:      &SafetyOptions{MaxRecursiveDestroy: 1},
+			opts:        DestroyOptions{Recursive: true},
+			plan:        "destroy\ttank/app/db\ndestroy\ttank/app\nreclaim\t10\n",
+			errContains: "recursive_destroy_limit_exceeded",
+		},
+		{
+			name:        "snapshot with holds",
+			safety:      &SafetyOptions{},
+			plan:        "destroy\ttank/app\nreclaim\t10\n",
+			check:       destroyCheckJSON("tank/app", "no", "/tank/app", "2", ""),
+			errContains: "dataset_has_holds",
+		},
+		{
+			name:   "holds ignored for deferred destroy",
+			safety: &SafetyOptions{},
+			opts:   DestroyOptions{Defer: true},
+			plan:   "destroy\ttank/app\nreclaim\t10\n",
+			check:  destroyCheckJSON("tank/app", "no", "/tank/app", "2", ""),
+		},
+		{
+			name:        "snapshot with clones",
+			safety:      &SafetyOptions{},
+			plan:        "destroy\ttank/app\nreclaim\t10\n",
+			check:       destroyCheckJSON("tank/app", "no", "/tank/app", "0", "tank/clone"),
+			errContains: "dataset_has_clones",
+		},
+		{
+			name:   "clones overridden",
+			safety: &SafetyOptions{},
+			opts:   DestroyOptions{AllowClones: true},
+			plan:   "destroy\ttank/app\nreclaim\t10\n",
+			check:  destroyCheckJSON("tank/app", "no", "/tank/app", "0", "tank/clone"),
+		},
+		{
+			name:        "protected pattern below recursive target",
+			safety:      &SafetyOptions{Protected: []string{"tank/app/db-*"}},
+			opts:        DestroyOptions{Recursive: true, AllowBusy: true, AllowHolds: true, AllowClones: true},
+			plan:        "destroy\ttank/app\nreclaim\t10\n",
+			errContains: "dataset_has_protected_descendant: tank/app",
+		},
+		{
+			name:        "busy check without proc entries",
+			safety:      &SafetyOptions{},
+			plan:        "destroy\ttank/app\nreclaim\t10\n",
+			check:       destroyCheckJSON("tank/app", "yes", "/tank/app", "0", ""),
+			errContains: "dataset_busy_check_failed",
+		},
+		{
+			name:   "all checks overridden",
+			safety: &SafetyOptions{},
+			opts:   DestroyOptions{AllowBusy: true, AllowHolds: true, AllowClones: true},
+			plan:   "destroy\ttank/app\nreclaim\t10\n",
+		},
+	}
+
+	oldProcRoot := procRoot
+	procRoot = t.TempDir()
+	defer func() { procRoot = oldProcRoot }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRunner := testutil.NewMockRunner()
+
+			client := &zfs{
+				cmd: Cmd{
+					Bin:    "zfs",
+					Runner: mockRunner,
+				},
+				safety: tt.safety,
+			}
+
+			target := "tank/app"
+			if tt.plan != "" {
+				mockRunner.AddCommand("zfs "+strings.Join(destroyArgs(target, tt.opts, true), " "), tt.plan, "", nil)
+			}
+			if tt.check != "" {
+				mockRunner.AddCommand("zfs get -p mounted,mountpoint,userrefs,clones tank/app -j", tt.check, "", nil)
+			}
+			mockRunner.AddCommand("zfs "+strings.Join(destroyArgs(target, tt.opts, false), " "), "", "", nil)
+
+			err := client.DestroyWithOptions(ctx, target, tt.opts)
+
+			if tt.errContains == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if last := mockRunner.GetLastCall(); last == nil || strings.Contains(last.Cmd, " -n ") {
+					t.Fatalf("Expected destroy to run, last call: %+v", last)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Fatalf("Expected error containing %q, got %v", tt.errContains, err)
+			}
+			for _, call := range mockRunner.CallHistory {
+				if strings.HasPrefix(call.Cmd, "zfs destroy") && !strings.Contains(call.Cmd, " -n ") {
+					t.Fatalf("Destroy should not have run: %s", call.Cmd)
+				}
+			}
+		})
+	}
+}
+
+func TestZFS_RollbackAndRenameProtected(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+		safety: &SafetyOptions{Protected: []string{"tank/prod"}},
+	}
+
+	err := client.Rollback(ctx, "tank/prod/web@daily", true)
+	if err == nil || !strings.Contains(err.Error(), "dataset_protected") {
+		t.Fatalf("Expected rollback to be refused, got %v", err)
+	}
+
+	mockRunner.AddCommand("zfs rollback tank/dev@daily", "", "", nil)
+
+	if err := client.Rollback(ctx, "tank/dev@daily", false); err != nil {
+		t.Fatalf("Unexpected rollback error: %v", err)
+	}
+
+	tank := &Dataset{z: client, Name: "tank/prod", Type: DatasetTypeFilesystem}
+	mockRunner.AddCommand(getSnapshotCmd("tank/prod"), snapshotDatasetJSON("tank/prod"), "", nil)
+
+	_, err = tank.Rename(ctx, "tank/old", false)
+	if err == nil || !strings.Contains(err.Error(), "dataset_protected") {
+		t.Fatalf("Expected rename to be refused, got %v", err)
+	}
+
+	parent := &Dataset{z: client, Name: "tank", Type: DatasetTypeFilesystem}
+	mockRunner.AddCommand(getSnapshotCmd("tank"), snapshotDatasetJSON("tank"), "", nil)
+
+	_, err = parent.Rename(ctx, "tank2", false)
+	if err == nil || !strings.Contains(err.Error(), "dataset_has_protected_descendant") {
+		t.Fatalf("Expected rename of an ancestor to be refused, got %v", err)
+	}
+}
+
+func TestZFS_RollbackDestroysNewerSnapshots(t *testing.T) {
+	ctx := context.Background()
+	plan := "destroy\ttank/dev@daily\ndestroy\ttank/dev@hourly\ndestroy\ttank/dev@gold\nreclaim\t10\n"
+
+	tests := []struct {
+		name        string
+		safety      *SafetyOptions
+		errContains string
+	}{
+		{
+			name:        "protected newer snapshot",
+			safety:      &SafetyOptions{Protected: []string{"tank/dev@gold"}},
+			errContains: "dataset_protected: tank/dev@gold",
+		},
+		{
+			name:        "recursive limit exceeded",
+			safety:      &SafetyOptions{MaxRecursiveDestroy: 1},
+			errContains: "recursive_destroy_limit_exceeded: 2 datasets",
+		},
+		{
+			name:   "within limits",
+			safety: &SafetyOptions{MaxRecursiveDestroy: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRunner := testutil.NewMockRunner()
+			client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}, safety: tt.safety}
+
+			mockRunner.AddCommand("zfs destroy -n -v -p tank/dev@daily%", plan, "", nil)
+			mockRunner.AddCommand("zfs get -p mounted,mountpoint,userrefs,clones tank/dev@hourly tank/dev@gold -j", `{"datasets": {}}`, "", nil)
+			mockRunner.AddCommand("zfs rollback -r tank/dev@daily", "", "", nil)
+
+			err := client.Rollback(ctx, "tank/dev@daily", true)
+			if tt.errContains == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if last := mockRunner.GetLastCall(); last == nil || last.Cmd != "zfs rollback -r tank/dev@daily" {
+					t.Fatalf("Expected rollback to run, last call: %+v", last)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Fatalf("Expected error containing %q, got %v", tt.errContains, err)
+			}
+			for _, call := range mockRunner.CallHistory {
+				if strings.HasPrefix(call.Cmd, "zfs rollback") {
+					t.Fatalf("Rollback should not have run: %s", call.Cmd)
+				}
+			}
+		})
+	}
+}
+
+func TestZFS_DestroyTargetsBatched(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+
+	prev := destroyCheckBatch
+	destroyCheckBatch = 2
+	defer func() { destroyCheckBatch = prev }()
+
+	mockRunner.AddCommand("zfs get -p mounted,mountpoint,userrefs,clones tank/a@1 tank/a@2 -j", `{"datasets": {}}`, "", nil)
+	mockRunner.AddCommand("zfs get -p mounted,mountpoint,userrefs,clones tank/a@3 -j", destroyCheckJSON("tank/a@3", "no", "-", "1", ""), "", nil)
+
+	err := client.checkDestroyTargets(ctx, []string{"tank/a@1", "tank/a@2", "tank/a@3"}, DestroyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "dataset_has_holds: tank/a@3") {
+		t.Fatalf("Expected hold on tank/a@3 from second batch, got %v", err)
+	}
+	if len(mockRunner.CallHistory) != 2 {
+		t.Errorf("Expected 2 zfs get calls, got %d", len(mockRunner.CallHistory))
+	}
+}
+
+func TestZPool_DestroyConfirmation(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+	mockRunner.AddCommand("zpool destroy tank", "", "", nil)
+
+	zfsC := &zfs{safety: &SafetyOptions{RequirePoolDestroyConfirmation: true}}
+	pool := &ZPool{
+		z:    &zpool{cmd: Cmd{Bin: "zpool", Runner: mockRunner}, zfs: zfsC},
+		Name: "tank",
+	}
+
+	if err := pool.Destroy(ctx); err == nil || !strings.Contains(err.Error(), "pool_destroy_confirmation_required") {
+		t.Fatalf("Expected confirmation error, got %v", err)
+	}
+	if err := pool.Destroy(ctx, "other"); err == nil {
+		t.Fatal("Expected error for wrong confirmation token")
+	}
+	if len(mockRunner.CallHistory) != 0 {
+		t.Fatalf("Expected no commands to run, got %d", len(mockRunner.CallHistory))
+	}
+	if err := pool.Destroy(ctx, "tank"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	zfsC.safety.Protected = []string{"tank/prod"}
+	if err := pool.Destroy(ctx, "tank"); err == nil || !strings.Contains(err.Error(), "dataset_has_protected_descendant: tank") {
+		t.Fatalf("Expected pool with a protected dataset to be kept, got %v", err)
+	}
+}
+
+func TestFindPathHolders(t *testing.T) {
+	root := t.TempDir()
+	mountpoint := filepath.Join(root, "mnt", "data")
+	if err := os.MkdirAll(mountpoint, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	busy := filepath.Join(root, "proc", "123")
+	idle := filepath.Join(root, "proc", "456")
+	for _, dir := range []string{filepath.Join(busy, "fd"), filepath.Join(idle, "fd")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(busy, "comm"), []byte("postgres\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(mountpoint, "file.db"), filepath.Join(busy, "fd", "3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(idle, "cwd")); err != nil {
+		t.Fatal(err)
+	}
+
+	holders, err := findPathHolders(filepath.Join(root, "proc"), mountpoint)
+	if err != nil {
+		t.Fatalf("findPathHolders returned error: %v", err)
+	}
+	if len(holders) != 1 {
+		t.Fatalf("Expected 1 holder, got %d: %+v", len(holders), holders)
+	}
+	if holders[0].PID != 123 || holders[0].Command != "postgres" {
+		t.Errorf("Unexpected holder: %+v", holders[0])
+	}
+
+	// A /proc without per-process links, as on FreeBSD, must not look idle.
+	bsd := filepath.Join(root, "bsdproc", "123")
+	if err := os.MkdirAll(bsd, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findPathHolders(filepath.Join(root, "bsdproc"), mountpoint); err == nil {
+		t.Error("Expected error when no process entries can be read")
+	}
+}
@@ -6,13 +6,14 @@ import (
 	"fmt"
 	"io"
 	"maps"
-	"os"
-	"strconv"
 	"strings"
 )
 
 type zfs struct {
-	cmd Cmd
+	cmd        Cmd
+	safety     *SafetyOptions
+	keys       KeyStore
+	shareStyle ShareStyle
 }
 
 type DatasetType string
@@ -22,6 +23,7 @@ const (
 	DatasetTypeFilesystem DatasetType = "FILESYSTEM"
 	DatasetTypeVolume     DatasetType = "VOLUME"
 	DatasetTypeSnapshot   DatasetType = "SNAPSHOT"
+	DatasetTypeBookmark   DatasetType = "BOOKMARK"
 )
 
 type Dataset struct {
@@ -40,6 +42,7 @@ type Dataset struct {
 	Compressratio float64 `json:"compressratio"`
 
 	Properties map[string]ZFSProperty `json:"properties"`
+	Typed      DatasetProperties      `json:"-"`
 }
 
 type EncryptionProperties struct {
@@ -63,6 +66,8 @@ func toZfsType(t DatasetType) string {
 		return "vol"
 	case DatasetTypeSnapshot:
 		return "snap"
+	case DatasetTypeBookmark:
+		return "bookmark"
 	case DatasetTypeAll:
 		return "all"
 	default:
@@ -72,84 +77,62 @@ func toZfsType(t DatasetType) string {
 
 func (z *zfs) hydrateDataset(d *Dataset) {
 	d.z = z
-	d.GUID = ParseString(d.Properties["guid"].Value)
-	d.Mountpoint = ParseString(d.Properties["mountpoint"].Value)
-	d.Used = ParseSize(d.Properties["used"].Value)
-	d.Available = ParseSize(d.Properties["available"].Value)
-	d.Referenced = ParseSize(d.Properties["referenced"].Value)
-	d.Compressratio = ParseRatio(d.Properties["compressratio"].Value)
-}
-
-func (z *zfs) listArgs(name string, recursive bool, t *DatasetType) []string {
-	args := append(
-		[]string{"list", "-o", strings.Join(dsPropList, ",")},
-		zfsArgs...,
-	)
 
-	if recursive {
-		args = append(args, "-r")
+	if prop, ok := d.Properties["guid"]; ok {
+		d.GUID = ParseString(prop.Value)
 	}
-
-	if t != nil {
-		args = append(args, "-t", toZfsType(*t))
+	if prop, ok := d.Properties["mountpoint"]; ok {
+		d.Mountpoint = ParseString(prop.Value)
+	}
+	if prop, ok := d.Properties["used"]; ok {
+		d.Used = ParseSize(prop.Value)
+	}
+	if prop, ok := d.Properties["available"]; ok {
+		d.Available = ParseSize(prop.Value)
+	}
+	if prop, ok := d.Properties["referenced"]; ok {
+		d.Referenced = ParseSize(prop.Value)
 	}
+	if prop, ok := d.Properties["compressratio"]; ok {
+		d.Compressratio = ParseRatio(prop.Value)
+	}
+
+	d.Typed = parseDatasetProperties(d.Properties)
+}
 
-	if name != "" {
-		args = append(args, name)
+func (z *zfs) listArgs(name string, recursive bool, t *DatasetType) []string {
+	opts := ListOptions{Recursive: recursive}
+	if t != nil {
+		opts.Type = *t
 	}
 
-	return args
+	return z.listOptionArgs(name, opts)
 }
 
 func (z *zfs) List(ctx context.Context, recursive bool, name ...string) ([]*Dataset, error) {
-	var resp DatasetList
-
 	var target string
 	if len(name) > 0 {
 		target = name[0]
 	}
 
-	args := z.listArgs(target, recursive, nil)
-
-	if err := z.cmd.RunJSON(ctx, &resp, args...); err != nil {
-		return nil, err
-	}
-
-	datasets := make([]*Dataset, 0, len(resp.Datasets))
-	for _, d := range resp.Datasets {
-		z.hydrateDataset(d)
-		datasets = append(datasets, d)
-	}
-
-	return datasets, nil
+	return z.listOrdered(ctx, z.listArgs(target, recursive, nil)...)
 }
 
 func (z *zfs) ListWithPrefix(ctx context.Context, t DatasetType, prefix string, recursive bool) ([]*Dataset, error) {
-	var resp DatasetList
 	var dType *DatasetType
 
-	if t == DatasetTypeAll {
-		dType = nil
-	} else {
+	if t != DatasetTypeAll {
 		dType = &t
 	}
 
-	if prefix == "" {
-		args := z.listArgs("", recursive, dType)
-		if err := z.cmd.RunJSON(ctx, &resp, args...); err != nil {
-			return nil, err
-		}
-	} else {
-		args := z.listArgs(prefix, recursive, dType)
-		if err := z.cmd.RunJSON(ctx, &resp, args...); err != nil {
-			return nil, err
-		}
+	all, err := z.listOrdered(ctx, z.listArgs(prefix, recursive, dType)...)
+	if err != nil {
+		return nil, err
 	}
 
-	datasets := make([]*Dataset, 0, len(resp.Datasets))
-	for _, d := range resp.Datasets {
+	datasets := make([]*Dataset, 0, len(all))
+	for _, d := range all {
 		if prefix == "" || strings.HasPrefix(d.Name, prefix) {
-			z.hydrateDataset(d)
 			datasets = append(datasets, d)
 		}
 	}
@@ -234,84 +217,41 @@ func (z *zfs) GetProperty(ctx context.Context, datasetName, propName string) (ZF
 }
 
 func (z *zfs) ListByType(ctx context.Context, t DatasetType, recursive bool, name ...string) ([]*Dataset, error) {
-	var resp DatasetList
-
 	var target string
 	if len(name) > 0 {
 		target = name[0]
 	}
 
-	args := z.listArgs(target, recursive, &t)
-
-	if err := z.cmd.RunJSON(ctx, &resp, args...); err != nil {
-		return nil, err
-	}
-
-	datasets := make([]*Dataset, 0, len(resp.Datasets))
-	for _, d := range resp.Datasets {
-		z.hydrateDataset(d)
-		datasets = append(datasets, d)
-	}
-
-	return datasets, nil
-}
-
-func prepareEncryptionKey(name string, props map[string]string) error {
-	key, ok := props["encryptionKey"]
-	if !ok || key == "" || props["encryption"] == "off" {
-		return nil
-	}
-
-	if len([]byte(key)) < 32 || len([]byte(key)) > 512 {
-		return fmt.Errorf("invalid_encryption_key_length")
-	}
-
-	seed := fmt.Sprintf("%s-%s", name, key)
-	keyPath := fmt.Sprintf("/etc/zfs/keys/%s", GenerateDeterministicUUID(seed))
-
-	if err := os.WriteFile(keyPath, []byte(key), 0600); err != nil {
-		return fmt.Errorf("failed_to_write_encryption_key")
-	}
-
-	props["keylocation"] = fmt.Sprintf("file://%s", keyPath)
-	props["keyformat"] = "passphrase"
-
-	return nil
+	return z.listOrdered(ctx, z.listArgs(target, recursive, &t)...)
 }
 
+// CreateVolume creates a volume from a property map. The pseudo-properties
+// encryptionKey and sparse are translated to VolumeCreateOptions; parent and size are
+// ignored. Parents are always created and readonly is forced off.
 func (z *zfs) CreateVolume(ctx context.Context, name string, size uint64, properties map[string]string) (*Dataset, error) {
 	props := make(map[string]string, len(properties))
 	maps.Copy(props, properties)
 
-	args := []string{"create", "-p"}
-
-	if props["sparse"] == "on" {
-		args = append(args, "-s")
+	enc, err := legacyEncryption(props)
+	if err != nil {
+		return nil, err
 	}
 
-	args = append(args, "-V", strconv.FormatUint(size, 10))
-
-	if err := prepareEncryptionKey(name, props); err != nil {
-		return nil, err
+	opts := VolumeCreateOptions{
+		Size:       size,
+		Sparse:     props["sparse"] == "on",
+		Parents:    true,
+		Encryption: enc,
+		Properties: props,
 	}
 
-	delete(props, "encryptionKey")
 	delete(props, "parent")
 	delete(props, "size")
 	delete(props, "sparse")
 
-	for k, v := range props {
-		args = append(args, "-o", fmt.Sprintf("%s=%s", k, v))
-	}
+	props["readonly"] = "off"
 
-	args = append(args, "-o", "readonly=off")
-	args = append(args, name)
-
-	if _, _, err := z.cmd.RunBytes(ctx, nil, args...); err != nil {
-		return nil, err
-	}
-
-	return z.Get(ctx, name, false)
+	return z.CreateVolumeWithOptions(ctx, name, opts)
 }
 
 func (z *zfs) EditVolume(ctx context.Context, name string, props map[string]string) error {
@@ -354,35 +294,30 @@ func (z *zfs) EditVolume(ctx context.Context, name string, props map[string]stri
 	return nil
 }
 
+// CreateFilesystem creates a file system from a property map. The encryptionKey
+// pseudo-property is translated to EncryptionOptions and readonly is forced off.
 func (z *zfs) CreateFilesystem(ctx context.Context, name string, properties map[string]string) (*Dataset, error) {
 	// work on a copy so caller's map isn't mutated
 	props := make(map[string]string, len(properties))
 	maps.Copy(props, properties)
 
-	args := []string{"create"}
-
-	if err := prepareEncryptionKey(name, props); err != nil {
+	enc, err := legacyEncryption(props)
+	if err != nil {
 		return nil, err
 	}
 
-	delete(props, "encryptionKey")
+	opts := FilesystemCreateOptions{
+		Encryption: enc,
+		Properties: props,
+	}
 
 	if q, ok := props["quota"]; ok && q == "" {
 		delete(props, "quota")
 	}
 
-	for k, v := range props {
-		args = append(args, "-o", fmt.Sprintf("%s=%s", k, v))
-	}
+	props["readonly"] = "off"
 
-	args = append(args, "-o", "readonly=off")
-	args = append(args, name)
-
-	if _, _, err := z.cmd.RunBytes(ctx, nil, args...); err != nil {
-		return nil, err
-	}
-
-	return z.Get(ctx, name, false)
+	return z.CreateFilesystemWithOptions(ctx, name, opts)
 }
 
 func (z *zfs) EditFilesystem(ctx context.Context, name string, props map[string]string) error {
@@ -429,6 +364,10 @@ func (z *zfs) EditFilesystem(ctx context.Context, name string, props map[string]
 		return fmt.Errorf("no_properties_to_edit")
 	}
 
+	if err := ValidateProperties(DatasetTypeFilesystem, clean, false); err != nil {
+		return err
+	}
+
 	args := []string{"set"}
 	for k, v := range clean {
 		args = append(args, fmt.Sprintf("%s=%s", k, v))
@@ -471,6 +410,10 @@ func (z *zfs) Rollback(ctx context.Context, name string, destroyMoreRecent bool)
 		return fmt.Errorf("snapshot name is empty")
 	}
 
+	if err := z.checkRollback(ctx, name, destroyMoreRecent); err != nil {
+		return err
+	}
+
 	args := []string{"rollback"}
 	if destroyMoreRecent {
 		args = append(args, "-r")
@@ -508,12 +451,7 @@ func (z *zfs) Clone(ctx context.Context, srcSnapshot, dest string, properties ma
 		return nil, fmt.Errorf("can_only_clone_from_snapshots")
 	}
 
-	args := []string{"clone", "-p"}
-
-	for k, v := range properties {
-		args = append(args, "-o", fmt.Sprintf("%s=%s", k, v))
-	}
-
+	args := appendPropertyArgs([]string{"clone", "-p"}, properties)
 	args = append(args, srcSnapshot, dest)
 
 	if _, _, err := z.cmd.RunBytes(ctx, nil, args...); err != nil {
@@ -532,6 +470,21 @@ func (z *zfs) Clone(ctx context.Context, srcSnapshot, dest string, properties ma
 	return ds, nil
 }
 
+// Promote makes the clone name independent of its origin snapshot. The origin and
+// every earlier snapshot of the origin file system move to name, and the former
+// origin becomes a clone of it.
+func (z *zfs) Promote(ctx context.Context, name string) error {
+	if name == "" {
+		return fmt.Errorf("dataset name is empty")
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, "promote", name); err != nil {
+		return fmt.Errorf("promote_failed: %w", err)
+	}
+
+	return nil
+}
+
 func (z *zfs) Rename(ctx context.Context, oldName, newName string, recursive bool) (*Dataset, error) {
 	if z == nil {
 		return nil, fmt.Errorf("zfs client is nil")
@@ -553,6 +506,10 @@ func (z *zfs) Rename(ctx context.Context, oldName, newName string, recursive boo
 		return nil, fmt.Errorf("dataset_not_found: %s", oldName)
 	}
 
+	if err := z.checkRename(oldName); err != nil {
+		return nil, err
+	}
+
 	args := []string{"rename"}
 	if recursive && ds.Type != DatasetTypeSnapshot {
 		return nil, fmt.Errorf("recursive_rename_only_allowed_for_snapshots")
@@ -560,10 +517,22 @@ func (z *zfs) Rename(ctx context.Context, oldName, newName string, recursive boo
 
 	args = append(args, oldName, newName)
 
+	// Keys are stored by dataset name, so those of renamed encryption roots move along.
+	var roots map[string]string
+	if ds.Type != DatasetTypeSnapshot {
+		if roots, err = z.encryptionRootKeyLocations(ctx, oldName); err != nil {
+			return nil, fmt.Errorf("error_getting_encryption_roots: %w", err)
+		}
+	}
+
 	if _, _, err := z.cmd.RunBytes(ctx, nil, args...); err != nil {
 		return nil, fmt.Errorf("rename_failed: %w", err)
 	}
 
+	if err := z.moveStoredKeys(ctx, oldName, newName, roots); err != nil {
+		return nil, fmt.Errorf("rename_succeeded_but_key_migration_failed: %w", err)
+	}
+
 	renamed, err := z.Get(ctx, newName, false)
 	if err != nil {
 		return nil, fmt.Errorf("error_getting_renamed_dataset: %w", err)
@@ -663,6 +632,9 @@ func (d *Dataset) SetProperties(ctx context.Context, kvPairs ...string) error {
 	args := []string{"set"}
 
 	for i := 0; i < len(kvPairs); i += 2 {
+		if err := ValidateProperty(d.Type, kvPairs[i], kvPairs[i+1], false); err != nil {
+			return err
+		}
 		args = append(args, fmt.Sprintf("%s=%s", kvPairs[i], kvPairs[i+1]))
 	}
 
@@ -693,24 +665,10 @@ func (d *Dataset) Destroy(ctx context.Context, recursive bool, deferDeletion boo
 		return fmt.Errorf("no zfs client attached")
 	}
 
-	args := []string{"destroy"}
-
-	if recursive {
-		args = append(args, "-r")
-	}
-
-	if deferDeletion {
-		args = append(args, "-d")
-	}
-
-	args = append(args, d.Name)
-
-	_, _, err := d.z.cmd.RunBytes(ctx, nil, args...)
-	if err != nil {
-		return fmt.Errorf("dataset_destroy_failed: %w", err)
-	}
-
-	return nil
+	return d.z.DestroyWithOptions(ctx, d.Name, DestroyOptions{
+		Recursive: recursive,
+		Defer:     deferDeletion,
+	})
 }
 
 func (d *Dataset) GetProperty(ctx context.Context, name string) (ZFSProperty, error) {
@@ -885,18 +843,7 @@ func (d *Dataset) LoadKey(ctx context.Context, recursive bool) error {
 		return fmt.Errorf("cannot load key for snapshots")
 	}
 
-	args := []string{"load-key"}
-	if recursive {
-		args = append(args, "-r")
-	}
-	args = append(args, d.Name)
-
-	_, _, err := d.z.cmd.RunBytes(ctx, nil, args...)
-	if err != nil {
-		return fmt.Errorf("load_key_failed: %w", err)
-	}
-
-	return nil
+	return d.z.LoadKey(ctx, d.Name, recursive)
 }
 
 func (d *Dataset) LoadKeyWithPassphrase(ctx context.Context, passphrase string, recursive bool) error {
@@ -958,33 +905,23 @@ func (d *Dataset) GetEncryptionProperties(ctx context.Context) (*EncryptionPrope
 		return nil, fmt.Errorf("no zfs client attached")
 	}
 
-	encProp, err := d.z.GetProperty(ctx, d.Name, "encryption")
+	props, err := d.z.GetProperties(ctx, []string{d.Name},
+		[]string{"encryption", "keylocation", "keyformat", "keystatus", "encryptionroot"}, GetOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("get_encryption_property_failed: %w", err)
+		return nil, fmt.Errorf("get_encryption_properties_failed: %w", err)
 	}
-	keylocProp, err := d.z.GetProperty(ctx, d.Name, "keylocation")
-	if err != nil {
-		return nil, fmt.Errorf("get_keylocation_property_failed: %w", err)
-	}
-	keyfmtProp, err := d.z.GetProperty(ctx, d.Name, "keyformat")
-	if err != nil {
-		return nil, fmt.Errorf("get_keyformat_property_failed: %w", err)
-	}
-	keystatProp, err := d.z.GetProperty(ctx, d.Name, "keystatus")
-	if err != nil {
-		return nil, fmt.Errorf("get_keystatus_property_failed: %w", err)
-	}
-	encrootProp, err := d.z.GetProperty(ctx, d.Name, "encryptionroot")
-	if err != nil {
-		return nil, fmt.Errorf("get_encryptionroot_property_failed: %w", err)
+
+	p, ok := props[d.Name]
+	if !ok {
+		return nil, fmt.Errorf("dataset %q not found in zfs get output", d.Name)
 	}
 
 	return &EncryptionProperties{
-		Encryption:     strings.TrimSpace(encProp.Value),
-		KeyLocation:    strings.TrimSpace(keylocProp.Value),
-		KeyFormat:      strings.TrimSpace(keyfmtProp.Value),
-		KeyStatus:      strings.TrimSpace(keystatProp.Value),
-		EncryptionRoot: strings.TrimSpace(encrootProp.Value),
+		Encryption:     strings.TrimSpace(p["encryption"].Value),
+		KeyLocation:    strings.TrimSpace(p["keylocation"].Value),
+		KeyFormat:      strings.TrimSpace(p["keyformat"].Value),
+		KeyStatus:      strings.TrimSpace(p["keystatus"].Value),
+		EncryptionRoot: strings.TrimSpace(p["encryptionroot"].Value),
 	}, nil
 }
 
@@ -1000,6 +937,18 @@ func (d *Dataset) Clone(ctx context.Context, dest string, properties map[string]
 	return d.z.Clone(ctx, d.Name, dest, properties)
 }
 
+func (d *Dataset) Promote(ctx context.Context) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.Promote(ctx, d.Name)
+}
+
 func (d *Dataset) Rename(ctx context.Context, newName string, recursive bool) (*Dataset, error) {
 	if d == nil {
 		return nil, fmt.Errorf("dataset is nil")
@@ -1202,7 +1151,17 @@ func (z *zfs) LoadKey(ctx context.Context, name string, recursive bool) error {
 	}
 	args = append(args, name)
 
-	_, _, err := z.cmd.RunBytes(ctx, nil, args...)
+	// A recursive load covers datasets with their own key locations, so only a
+	// single dataset can be fed from the key store.
+	var stdin io.Reader
+	if !recursive {
+		var err error
+		if stdin, err = z.storedKeyInput(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	_, _, err := z.cmd.RunBytes(ctx, stdin, args...)
 	if err != nil {
 		return fmt.Errorf("load_key_failed: %w", err)
 	}
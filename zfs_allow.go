@@ -0,0 +1,553 @@
+package gzfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GrantType is who or what a delegation applies to.
+type GrantType string
+
+const (
+	GrantUser     GrantType = "user"
+	GrantGroup    GrantType = "group"
+	GrantEveryone GrantType = "everyone"
+	// GrantSet defines the permission set named by Grant.Name, such as @backup.
+	GrantSet GrantType = "set"
+	// GrantCreate holds the create time permissions given to the creator of a new
+	// descendent.
+	GrantCreate GrantType = "create"
+)
+
+// GrantScope is where user, group and everyone delegations apply.
+type GrantScope string
+
+const (
+	ScopeLocal           GrantScope = "local"
+	ScopeDescendent      GrantScope = "descendent"
+	ScopeLocalDescendent GrantScope = "local+descendent"
+)
+
+// Grant is one delegation entry. Permissions hold permission names and @set names.
+// Scope is only used by user, group and everyone grants and defaults to
+// local+descendent.
+type Grant struct {
+	Type        GrantType  `json:"type"`
+	Name        string     `json:"name,omitempty"`
+	Scope       GrantScope `json:"scope,omitempty"`
+	Permissions []string   `json:"permissions"`
+}
+
+// DatasetPermissions are the delegations set on Dataset itself.
+type DatasetPermissions struct {
+	Dataset string  `json:"dataset"`
+	Grants  []Grant `json:"grants"`
+}
+
+// PermissionChange is one zfs allow or unallow needed to reach a desired state.
+type PermissionChange struct {
+	Allow bool  `json:"allow"`
+	Grant Grant `json:"grant"`
+}
+
+func (g Grant) key() string {
+	return string(g.Type) + "\x00" + g.Name + "\x00" + string(g.normalizedScope())
+}
+
+func (g Grant) normalizedScope() GrantScope {
+	switch g.Type {
+	case GrantUser, GrantGroup, GrantEveryone:
+		if g.Scope == "" {
+			return ScopeLocalDescendent
+		}
+		return g.Scope
+	default:
+		return ""
+	}
+}
+
+func validateGrant(g Grant) error {
+	switch g.Type {
+	case GrantUser, GrantGroup:
+		if g.Name == "" || strings.ContainsAny(g.Name, ", \t") {
+			return fmt.Errorf("invalid_grant_name: %q", g.Name)
+		}
+	case GrantEveryone, GrantCreate:
+		if g.Name != "" {
+			return fmt.Errorf("invalid_grant_name: %s grants take no name", g.Type)
+		}
+	case GrantSet:
+		if len(g.Name) < 2 || g.Name[0] != '@' || strings.ContainsAny(g.Name, ", \t") {
+			return fmt.Errorf("invalid_permission_set: %q", g.Name)
+		}
+	default:
+		return fmt.Errorf("invalid_grant_type: %q", g.Type)
+	}
+
+	switch g.Scope {
+	case "":
+	case ScopeLocal, ScopeDescendent, ScopeLocalDescendent:
+		if g.Type == GrantSet || g.Type == GrantCreate {
+			return fmt.Errorf("invalid_grant_scope: %s grants have no scope", g.Type)
+		}
+	default:
+		return fmt.Errorf("invalid_grant_scope: %q", g.Scope)
+	}
+
+	for _, p := range g.Permissions {
+		if p == "" || strings.ContainsAny(p, ", \t") {
+			return fmt.Errorf("invalid_permission: %q", p)
+		}
+	}
+
+	return nil
+}
+
+func allowArgs(cmd, dataset string, g Grant, recursive bool) []string {
+	args := []string{cmd}
+	if recursive {
+		args = append(args, "-r")
+	}
+
+	switch g.normalizedScope() {
+	case ScopeLocal:
+		args = append(args, "-l")
+	case ScopeDescendent:
+		args = append(args, "-d")
+	}
+
+	switch g.Type {
+	case GrantUser:
+		args = append(args, "-u", g.Name)
+	case GrantGroup:
+		args = append(args, "-g", g.Name)
+	case GrantEveryone:
+		args = append(args, "-e")
+	case GrantSet:
+		args = append(args, "-s", g.Name)
+	case GrantCreate:
+		args = append(args, "-c")
+	}
+
+	if len(g.Permissions) > 0 {
+		args = append(args, strings.Join(g.Permissions, ","))
+	}
+
+	return append(args, dataset)
+}
+
+// parsePermissions parses zfs allow output, which has one section for the dataset
+// and one for every ancestor with delegations, nearest first.
+func parsePermissions(out []byte) ([]DatasetPermissions, error) {
+	var sections []DatasetPermissions
+	var current *DatasetPermissions
+	var section string
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(line, "---- Permissions on "); ok {
+			name, _, _ := strings.Cut(rest, " ")
+			sections = append(sections, DatasetPermissions{Dataset: name, Grants: []Grant{}})
+			current = &sections[len(sections)-1]
+			section = ""
+			continue
+		}
+
+		if !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ") {
+			section = strings.TrimSuffix(strings.TrimSpace(line), ":")
+			continue
+		}
+
+		if current == nil {
+			return nil, fmt.Errorf("unexpected_allow_output: %q", line)
+		}
+
+		fields := strings.Fields(line)
+		g := Grant{Permissions: strings.Split(fields[len(fields)-1], ",")}
+
+		switch section {
+		case "Permission sets":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("unexpected_allow_output: %q", line)
+			}
+			g.Type, g.Name = GrantSet, fields[0]
+		case "Create time permissions":
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("unexpected_allow_output: %q", line)
+			}
+			g.Type = GrantCreate
+		case "Local permissions", "Descendent permissions", "Local+Descendent permissions":
+			scope := GrantScope(strings.ToLower(strings.TrimSuffix(section, " permissions")))
+			g.Scope = scope
+
+			switch {
+			case fields[0] == "everyone" && len(fields) == 2:
+				g.Type = GrantEveryone
+			case (fields[0] == "user" || fields[0] == "group") && len(fields) >= 3:
+				g.Type = GrantType(fields[0])
+				g.Name = strings.Join(fields[1:len(fields)-1], " ")
+			default:
+				return nil, fmt.Errorf("unexpected_allow_output: %q", line)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected_allow_section: %q", section)
+		}
+
+		current.Grants = append(current.Grants, g)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse allow output: %w", err)
+	}
+
+	return sections, nil
+}
+
+// Permissions returns the delegations that apply to dataset: those set on the dataset
+// itself first, followed by those inherited from each ancestor.
+func (z *zfs) Permissions(ctx context.Context, dataset string) ([]DatasetPermissions, error) {
+	if dataset == "" {
+		return nil, fmt.Errorf("dataset name is empty")
+	}
+
+	out, _, err := z.cmd.RunBytes(ctx, nil, "allow", dataset)
+	if err != nil {
+		return nil, fmt.Errorf("allow_list_failed: %w", err)
+	}
+
+	return parsePermissions(out)
+}
+
+// LocalPermissions returns only the delegations set on dataset itself.
+func (z *zfs) LocalPermissions(ctx context.Context, dataset string) ([]Grant, error) {
+	sections, err := z.Permissions(ctx, dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range sections {
+		if s.Dataset == dataset {
+			return s.Grants, nil
+		}
+	}
+
+	return []Grant{}, nil
+}
+
+// Allow delegates g on dataset. Granting to a GrantSet defines or extends the set.
+func (z *zfs) Allow(ctx context.Context, dataset string, g Grant) error {
+	if dataset == "" {
+		return fmt.Errorf("dataset name is empty")
+	}
+	if err := validateGrant(g); err != nil {
+		return err
+	}
+	if len(g.Permissions) == 0 {
+		return fmt.Errorf("no_permissions_to_allow")
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, allowArgs("allow", dataset, g, false)...); err != nil {
+		return fmt.Errorf("allow_failed: %w", err)
+	}
+
+	return nil
+}
+
+// Unallow revokes g on dataset, or on dataset and its descendents when recursive is
+// set. Empty Permissions revoke everything delegated to the grantee.
+func (z *zfs) Unallow(ctx context.Context, dataset string, g Grant, recursive bool) error {
+	if dataset == "" {
+		return fmt.Errorf("dataset name is empty")
+	}
+	if err := validateGrant(g); err != nil {
+		return err
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, allowArgs("unallow", dataset, g, recursive)...); err != nil {
+		return fmt.Errorf("unallow_failed: %w", err)
+	}
+
+	return nil
+}
+
+// DefinePermissionSet adds perms to the permission set name (@name) on dataset.
+func (z *zfs) DefinePermissionSet(ctx context.Context, dataset, name string, perms ...string) error {
+	return z.Allow(ctx, dataset, Grant{Type: GrantSet, Name: name, Permissions: perms})
+}
+
+// RemovePermissionSet removes perms from the permission set name, or the whole set
+// when no perms are given.
+func (z *zfs) RemovePermissionSet(ctx context.Context, dataset, name string, perms ...string) error {
+	return z.Unallow(ctx, dataset, Grant{Type: GrantSet, Name: name, Permissions: perms}, false)
+}
+
+func permissionSet(perms []string) map[string]bool {
+	set := make(map[string]bool, len(perms))
+	for _, p := range perms {
+		set[p] = true
+	}
+	return set
+}
+
+func permissionList(set map[string]bool) []string {
+	perms := make([]string, 0, len(set))
+	for p := range set {
+		perms = append(perms, p)
+	}
+	return perms
+}
+
+func missingPermissions(perms []string, have map[string]bool) []string {
+	var missing []string
+	for _, p := range perms {
+		if !have[p] {
+			missing = append(missing, p)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// splitScope splits a local+descendent grant into its local and descendent halves,
+// which zfs tracks separately.
+func splitScope(g Grant) []Grant {
+	g.Scope = g.normalizedScope()
+	if g.Scope != ScopeLocalDescendent {
+		return []Grant{g}
+	}
+
+	local, descendent := g, g
+	local.Scope, descendent.Scope = ScopeLocal, ScopeDescendent
+	return []Grant{local, descendent}
+}
+
+// mergeScopes recombines the local and descendent changes of one grantee into a
+// single local+descendent change for the permissions both halves share.
+func mergeScopes(changes []PermissionChange) []PermissionChange {
+	grantee := func(g Grant) string {
+		return string(g.Type) + "\x00" + g.Name
+	}
+
+	halves := make(map[string]map[GrantScope][]string)
+	for _, c := range changes {
+		if c.Grant.Scope == ScopeLocal || c.Grant.Scope == ScopeDescendent {
+			k := grantee(c.Grant)
+			if halves[k] == nil {
+				halves[k] = make(map[GrantScope][]string)
+			}
+			halves[k][c.Grant.Scope] = c.Grant.Permissions
+		}
+	}
+
+	var merged []PermissionChange
+	done := make(map[string]bool)
+
+	for _, c := range changes {
+		k := grantee(c.Grant)
+		h := halves[k]
+		if h == nil || h[ScopeLocal] == nil || h[ScopeDescendent] == nil {
+			merged = append(merged, c)
+			continue
+		}
+		if done[k] {
+			continue
+		}
+		done[k] = true
+
+		descendent := permissionSet(h[ScopeDescendent])
+		var both, localOnly []string
+		for _, p := range h[ScopeLocal] {
+			if descendent[p] {
+				both = append(both, p)
+			} else {
+				localOnly = append(localOnly, p)
+			}
+		}
+		descendentOnly := missingPermissions(h[ScopeDescendent], permissionSet(both))
+
+		for _, part := range []struct {
+			scope GrantScope
+			perms []string
+		}{{ScopeLocalDescendent, both}, {ScopeLocal, localOnly}, {ScopeDescendent, descendentOnly}} {
+			if len(part.perms) == 0 {
+				continue
+			}
+			g := c.Grant
+			g.Scope, g.Permissions = part.scope, part.perms
+			merged = append(merged, PermissionChange{Allow: c.Allow, Grant: g})
+		}
+	}
+
+	return merged
+}
+
+// PlanPermissions returns the changes that turn current into desired. Local and
+// descendent permissions are compared separately, so moving a grant between scopes
+// only touches the scope that differs. Permission sets are defined before they can
+// be referenced and removed only after the grants that use them.
+func PlanPermissions(current, desired []Grant) ([]PermissionChange, error) {
+	type entry struct {
+		grant Grant
+		perms map[string]bool
+	}
+
+	index := func(grants []Grant) (map[string]*entry, []string, error) {
+		m := make(map[string]*entry)
+		var keys []string
+		for _, grant := range grants {
+			if err := validateGrant(grant); err != nil {
+				return nil, nil, err
+			}
+			for _, g := range splitScope(grant) {
+				k := g.key()
+				if e, ok := m[k]; ok {
+					for _, p := range g.Permissions {
+						e.perms[p] = true
+					}
+					continue
+				}
+				m[k] = &entry{grant: g, perms: permissionSet(g.Permissions)}
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		return m, keys, nil
+	}
+
+	have, haveKeys, err := index(current)
+	if err != nil {
+		return nil, err
+	}
+	want, wantKeys, err := index(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	var setAllows, allows, unallows, setUnallows []PermissionChange
+
+	for _, k := range wantKeys {
+		w := want[k]
+		var existing map[string]bool
+		if h, ok := have[k]; ok {
+			existing = h.perms
+		}
+
+		perms := missingPermissions(permissionList(w.perms), existing)
+		if len(perms) == 0 {
+			continue
+		}
+
+		g := w.grant
+		g.Permissions = perms
+		if g.Type == GrantSet {
+			setAllows = append(setAllows, PermissionChange{Allow: true, Grant: g})
+		} else {
+			allows = append(allows, PermissionChange{Allow: true, Grant: g})
+		}
+	}
+
+	for _, k := range haveKeys {
+		h := have[k]
+		var wanted map[string]bool
+		if w, ok := want[k]; ok {
+			wanted = w.perms
+		}
+
+		perms := missingPermissions(permissionList(h.perms), wanted)
+		if len(perms) == 0 {
+			continue
+		}
+
+		g := h.grant
+		g.Permissions = perms
+		if g.Type == GrantSet {
+			setUnallows = append(setUnallows, PermissionChange{Grant: g})
+		} else {
+			unallows = append(unallows, PermissionChange{Grant: g})
+		}
+	}
+
+	changes := append(setAllows, mergeScopes(allows)...)
+	changes = append(changes, mergeScopes(unallows)...)
+	return append(changes, setUnallows...), nil
+}
+
+// ApplyPermissions brings the delegations set on dataset itself to desired and returns
+// the changes made. Delegations inherited from ancestors are left alone.
+func (z *zfs) ApplyPermissions(ctx context.Context, dataset string, desired []Grant) ([]PermissionChange, error) {
+	current, err := z.LocalPermissions(ctx, dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := PlanPermissions(current, desired)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, c := range changes {
+		if c.Allow {
+			err = z.Allow(ctx, dataset, c.Grant)
+		} else {
+			err = z.Unallow(ctx, dataset, c.Grant, false)
+		}
+		if err != nil {
+			return changes[:i], err
+		}
+	}
+
+	return changes, nil
+}
+
+func (d *Dataset) Permissions(ctx context.Context) ([]DatasetPermissions, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.Permissions(ctx, d.Name)
+}
+
+func (d *Dataset) Allow(ctx context.Context, g Grant) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.Allow(ctx, d.Name, g)
+}
+
+func (d *Dataset) Unallow(ctx context.Context, g Grant, recursive bool) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.Unallow(ctx, d.Name, g, recursive)
+}
+
+func (d *Dataset) ApplyPermissions(ctx context.Context, desired []Grant) ([]PermissionChange, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.ApplyPermissions(ctx, d.Name, desired)
+}
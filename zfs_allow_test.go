@@ -0,0 +1,161 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+const zfsAllowOutput = `---- Permissions on tank/home ----------------------------------------
+Permission sets:
+	@backup hold,send,snapshot
+Create time permissions:
+	destroy,mount
+Local permissions:
+	user alice snapshot
+Local+Descendent permissions:
+	group staff @backup
+	everyone mount
+---- Permissions on tank ----------------------------------------------
+Descendent permissions:
+	user backup send
+`
+
+func TestParsePermissions(t *testing.T) {
+	sections, err := parsePermissions([]byte(zfsAllowOutput))
+	if err != nil {
+		t.Fatalf("parsePermissions returned error: %v", err)
+	}
+
+	if len(sections) != 2 || sections[0].Dataset != "tank/home" || sections[1].Dataset != "tank" {
+		t.Fatalf("Unexpected sections: %+v", sections)
+	}
+
+	var got []string
+	for _, g := range sections[0].Grants {
+		got = append(got, fmt.Sprintf("%s:%s:%s:%s", g.Type, g.Name, g.Scope, strings.Join(g.Permissions, ",")))
+	}
+	want := "set:@backup::hold,send,snapshot create:::destroy,mount user:alice:local:snapshot group:staff:local+descendent:@backup everyone::local+descendent:mount"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Grants = %v, want %s", got, want)
+	}
+
+	if g := sections[1].Grants[0]; g.Type != GrantUser || g.Name != "backup" || g.Scope != ScopeDescendent {
+		t.Errorf("Unexpected inherited grant: %+v", g)
+	}
+}
+
+func TestPlanPermissions_Scopes(t *testing.T) {
+	alice := func(scope GrantScope, perms ...string) Grant {
+		return Grant{Type: GrantUser, Name: "alice", Scope: scope, Permissions: perms}
+	}
+
+	tests := []struct {
+		name    string
+		current []Grant
+		desired []Grant
+		want    []string
+	}{
+		{
+			name:    "widen local to local+descendent",
+			current: []Grant{alice(ScopeLocal, "snapshot")},
+			desired: []Grant{alice(ScopeLocalDescendent, "snapshot")},
+			want:    []string{"allow -d -u alice snapshot tank/home"},
+		},
+		{
+			name:    "narrow local+descendent to local",
+			current: []Grant{alice(ScopeLocalDescendent, "mount", "snapshot")},
+			desired: []Grant{alice(ScopeLocal, "snapshot")},
+			want:    []string{"unallow -u alice mount tank/home", "unallow -d -u alice snapshot tank/home"},
+		},
+		{
+			name:    "split local and descendent grants",
+			current: []Grant{alice(ScopeLocal, "snapshot"), alice(ScopeDescendent, "snapshot")},
+			desired: []Grant{alice("", "snapshot")},
+		},
+		{
+			name:    "new grant",
+			desired: []Grant{alice("", "send", "hold"), alice(ScopeLocal, "destroy")},
+			want:    []string{"allow -u alice hold,send tank/home", "allow -l -u alice destroy tank/home"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := PlanPermissions(tt.current, tt.desired)
+			if err != nil {
+				t.Fatalf("PlanPermissions returned error: %v", err)
+			}
+
+			var got []string
+			for _, c := range changes {
+				cmd := "unallow"
+				if c.Allow {
+					cmd = "allow"
+				}
+				got = append(got, strings.Join(allowArgs(cmd, "tank/home", c.Grant, false), " "))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Changes =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestZFS_ApplyPermissions(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+
+	mockRunner.AddCommand("zfs allow tank/home", zfsAllowOutput, "", nil)
+	mockRunner.AddCommand("zfs allow -s @backup receive tank/home", "", "", nil)
+	mockRunner.AddCommand("zfs allow -l -u alice destroy tank/home", "", "", nil)
+	mockRunner.AddCommand("zfs allow -u svc @backup tank/home", "", "", nil)
+	mockRunner.AddCommand("zfs unallow -c destroy,mount tank/home", "", "", nil)
+	mockRunner.AddCommand("zfs unallow -e mount tank/home", "", "", nil)
+	mockRunner.AddCommand("zfs unallow -g staff @backup tank/home", "", "", nil)
+	mockRunner.AddCommand("zfs unallow -s @backup hold tank/home", "", "", nil)
+
+	changes, err := client.ApplyPermissions(ctx, "tank/home", []Grant{
+		{Type: GrantSet, Name: "@backup", Permissions: []string{"send", "snapshot", "receive"}},
+		{Type: GrantUser, Name: "alice", Scope: ScopeLocal, Permissions: []string{"snapshot", "destroy"}},
+		{Type: GrantUser, Name: "svc", Permissions: []string{"@backup"}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyPermissions returned error: %v", err)
+	}
+
+	var got []string
+	for _, call := range mockRunner.CallHistory[1:] {
+		got = append(got, strings.Join(call.Args, " "))
+	}
+	want := []string{
+		"allow -s @backup receive tank/home",
+		"allow -l -u alice destroy tank/home",
+		"allow -u svc @backup tank/home",
+		"unallow -c destroy,mount tank/home",
+		"unallow -e mount tank/home",
+		"unallow -g staff @backup tank/home",
+		"unallow -s @backup hold tank/home",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Commands =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(changes) != len(want) {
+		t.Errorf("Expected %d changes, got %d", len(want), len(changes))
+	}
+
+	for _, g := range []Grant{
+		{Type: GrantUser, Permissions: []string{"send"}},
+		{Type: GrantSet, Name: "backup", Permissions: []string{"send"}},
+		{Type: GrantCreate, Scope: ScopeLocal, Permissions: []string{"send"}},
+		{Type: GrantEveryone, Permissions: []string{"send,receive"}},
+	} {
+		if err := client.Allow(ctx, "tank/home", g); err == nil {
+			t.Errorf("Expected error for %+v", g)
+		}
+	}
+}
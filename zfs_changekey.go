@@ -0,0 +1,271 @@
+package gzfs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeKeyOptions controls zfs change-key.
+type ChangeKeyOptions struct {
+	// Inherit makes the dataset inherit its parent's encryption root and key (-i).
+	// The key fields are ignored.
+	Inherit bool
+	// Load loads the current key first if it is not loaded yet.
+	Load bool
+
+	// Key is the new key material in KeyFormat. It is saved in the client's KeyStore
+	// and keylocation is taken from the store unless KeyLocation is given.
+	Key string
+	// Stdin supplies the new key when keylocation is prompt and Key is empty.
+	Stdin io.Reader
+
+	// KeyFormat, KeyLocation and PBKDF2Iters change the matching properties. An empty
+	// KeyFormat keeps the current format.
+	KeyFormat   KeyFormat
+	KeyLocation string
+	PBKDF2Iters uint64
+}
+
+// KeyRotationResult reports the outcome of rotating one encryption root.
+type KeyRotationResult struct {
+	Dataset string `json:"dataset"`
+	Err     error  `json:"-"`
+}
+
+func changeKeyArgs(name string, opts ChangeKeyOptions, location string) []string {
+	args := []string{"change-key"}
+
+	if opts.Inherit {
+		return append(args, "-i", name)
+	}
+
+	if opts.KeyFormat != "" {
+		args = append(args, "-o", "keyformat="+string(opts.KeyFormat))
+	}
+	if location != "" {
+		args = append(args, "-o", "keylocation="+location)
+	}
+	if opts.PBKDF2Iters > 0 {
+		args = append(args, "-o", "pbkdf2iters="+strconv.FormatUint(opts.PBKDF2Iters, 10))
+	}
+
+	return append(args, name)
+}
+
+func (z *zfs) ensureKeyLoaded(ctx context.Context, name string) error {
+	props, err := z.GetProperties(ctx, []string{name}, []string{"keystatus"}, GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(props[name]["keystatus"].Value) == "available" {
+		return nil
+	}
+
+	return z.LoadKey(ctx, name, false)
+}
+
+// ChangeKey changes the wrapping key of the encryption root name, or makes name
+// inherit its parent's key, in which case the key stored for name is removed. A new
+// Key passed on stdin is saved in the KeyStore once change-key succeeded; one zfs
+// reads from a file location is saved first and the previous key is restored if
+// change-key fails.
+func (z *zfs) ChangeKey(ctx context.Context, name string, opts ChangeKeyOptions) error {
+	if name == "" {
+		return fmt.Errorf("dataset name is empty")
+	}
+	if strings.Contains(name, "@") {
+		return fmt.Errorf("cannot change key for snapshots")
+	}
+	if opts.Inherit && (opts.Key != "" || opts.KeyFormat != "" || opts.KeyLocation != "" || opts.PBKDF2Iters > 0) {
+		return fmt.Errorf("change_key_inherit_conflicts_with_key_options")
+	}
+
+	if opts.Load {
+		if err := z.ensureKeyLoaded(ctx, name); err != nil {
+			return fmt.Errorf("change_key_load_failed: %w", err)
+		}
+	}
+
+	if opts.Inherit {
+		legacy, err := z.legacyKeyPath(ctx, name)
+		if err != nil {
+			return fmt.Errorf("change_key_failed: resolving stored key: %w", err)
+		}
+
+		if _, _, err := z.cmd.RunBytes(ctx, nil, changeKeyArgs(name, opts, "")...); err != nil {
+			return fmt.Errorf("change_key_failed: %w", err)
+		}
+
+		if err := z.removeStoredKey(context.WithoutCancel(ctx), name, legacy); err != nil {
+			return fmt.Errorf("change_key_succeeded_but_key_cleanup_failed: %w", err)
+		}
+		return nil
+	}
+
+	if opts.Key == "" {
+		if _, _, err := z.cmd.RunBytes(ctx, opts.Stdin, changeKeyArgs(name, opts, opts.KeyLocation)...); err != nil {
+			return fmt.Errorf("change_key_failed: %w", err)
+		}
+		return nil
+	}
+
+	format := opts.KeyFormat
+	if format == "" {
+		props, err := z.GetProperties(ctx, []string{name}, []string{"keyformat"}, GetOptions{})
+		if err != nil {
+			return err
+		}
+		format = KeyFormat(strings.TrimSpace(props[name]["keyformat"].Value))
+	}
+
+	key := []byte(opts.Key)
+	if err := ValidateKey(format, key); err != nil {
+		return err
+	}
+
+	store := z.keyStore()
+	location := opts.KeyLocation
+	if location == "" {
+		location = store.Location(name)
+	}
+	args := changeKeyArgs(name, opts, location)
+
+	if input := keyInput(location, format, key); input != nil {
+		if _, _, err := z.cmd.RunBytes(ctx, input, args...); err != nil {
+			return fmt.Errorf("change_key_failed: %w", err)
+		}
+		if err := store.Store(context.WithoutCancel(ctx), name, key); err != nil {
+			return fmt.Errorf("change_key_succeeded_but_store_failed: %w", err)
+		}
+		return nil
+	}
+
+	previous, err := store.Load(ctx, name)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return fmt.Errorf("change_key_failed: reading stored key: %w", err)
+	}
+	hadPrevious := err == nil
+
+	if err := store.Store(ctx, name, key); err != nil {
+		return err
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, args...); err != nil {
+		// Put the old key back even if ctx was cancelled while zfs ran.
+		rctx := context.WithoutCancel(ctx)
+
+		var restoreErr error
+		if hadPrevious {
+			restoreErr = store.Store(rctx, name, previous)
+		} else {
+			restoreErr = store.Remove(rctx, name)
+		}
+		if restoreErr != nil {
+			return fmt.Errorf("change_key_failed: %w (restoring stored key: %v)", err, restoreErr)
+		}
+		return fmt.Errorf("change_key_failed: %w", err)
+	}
+
+	return nil
+}
+
+// EncryptionRoots returns the encryption roots at or below name, parents first.
+func (z *zfs) EncryptionRoots(ctx context.Context, name string) ([]string, error) {
+	props, err := z.GetProperties(ctx, []string{name}, []string{"encryptionroot"}, GetOptions{
+		Recursive: true,
+		Types:     []DatasetType{DatasetTypeFilesystem, DatasetTypeVolume},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []string
+	for ds, p := range props {
+		if strings.TrimSpace(p["encryptionroot"].Value) == ds {
+			roots = append(roots, ds)
+		}
+	}
+
+	sort.Strings(roots)
+	return roots, nil
+}
+
+// RotateKeys changes the key of every encryption root at or below name, parents
+// first. newKey supplies the options for each root; rotation continues past failures
+// and every root is reported. The error is only set if the roots cannot be listed.
+func (z *zfs) RotateKeys(ctx context.Context, name string, newKey func(root string) (ChangeKeyOptions, error)) ([]KeyRotationResult, error) {
+	roots, err := z.EncryptionRoots(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("list_encryption_roots_failed: %w", err)
+	}
+
+	results := make([]KeyRotationResult, 0, len(roots))
+	for _, root := range roots {
+		if err := ctx.Err(); err != nil {
+			results = append(results, KeyRotationResult{Dataset: root, Err: err})
+			continue
+		}
+
+		opts, err := newKey(root)
+		if err == nil {
+			err = z.ChangeKey(ctx, root, opts)
+		}
+		results = append(results, KeyRotationResult{Dataset: root, Err: err})
+	}
+
+	return results, nil
+}
+
+// GenerateKey returns random key material in format: 64 hex digits, 32 raw bytes,
+// or a 43 character passphrase.
+func GenerateKey(format KeyFormat) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	switch format {
+	case KeyFormatHex:
+		return hex.EncodeToString(buf), nil
+	case KeyFormatRaw:
+		return string(buf), nil
+	case KeyFormatPassphrase, "":
+		return base64.RawURLEncoding.EncodeToString(buf), nil
+	default:
+		return "", fmt.Errorf("invalid_key_format: %q", format)
+	}
+}
+
+func (d *Dataset) ChangeKey(ctx context.Context, opts ChangeKeyOptions) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+	if d.Type == DatasetTypeSnapshot {
+		return fmt.Errorf("cannot change key for snapshots")
+	}
+
+	return d.z.ChangeKey(ctx, d.Name, opts)
+}
+
+func (d *Dataset) RotateKeys(ctx context.Context, newKey func(root string) (ChangeKeyOptions, error)) ([]KeyRotationResult, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.RotateKeys(ctx, d.Name, newKey)
+}
@@ -0,0 +1,244 @@
+package gzfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func TestChangeKeyArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     ChangeKeyOptions
+		location string
+		want     string
+	}{
+		{"inherit", ChangeKeyOptions{Inherit: true}, "", "change-key -i tank/a/b"},
+		{"format and location", ChangeKeyOptions{KeyFormat: KeyFormatHex, PBKDF2Iters: 500000}, "file:///keys/x",
+			"change-key -o keyformat=hex -o keylocation=file:///keys/x -o pbkdf2iters=500000 tank/a/b"},
+		{"plain", ChangeKeyOptions{}, "", "change-key tank/a/b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(changeKeyArgs("tank/a/b", tt.opts, tt.location), " "); got != tt.want {
+				t.Errorf("changeKeyArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZFS_ChangeKey(t *testing.T) {
+	ctx := context.Background()
+	runner := newStdinRunner()
+	store := NewMemoryKeyStore()
+	store.Store(ctx, "tank/enc", []byte("old-passphrase"))
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: runner,
+		},
+		keys: store,
+	}
+
+	runner.AddCommand("zfs get -p keystatus tank/enc -j", datasetListJSON(
+		testDataset{name: "tank/enc", props: map[string]string{"keystatus": "unavailable|NONE"}},
+	), "", nil)
+	runner.AddCommand("zfs get -p keylocation,keyformat tank/enc -j", datasetListJSON(
+		testDataset{name: "tank/enc", props: map[string]string{
+			"keylocation": "prompt|LOCAL",
+			"keyformat":   "passphrase|NONE",
+		}},
+	), "", nil)
+	runner.AddCommand("zfs load-key tank/enc", "", "", nil)
+
+	changeCmd := "zfs change-key -o keyformat=passphrase -o keylocation=prompt tank/enc"
+	runner.AddCommand(changeCmd, "", "", nil)
+
+	err := client.ChangeKey(ctx, "tank/enc", ChangeKeyOptions{
+		Load:      true,
+		Key:       "new-passphrase",
+		KeyFormat: KeyFormatPassphrase,
+	})
+	if err != nil {
+		t.Fatalf("ChangeKey returned error: %v", err)
+	}
+
+	if got := runner.stdin["zfs load-key tank/enc"]; got != "old-passphrase\n" {
+		t.Errorf("load-key received %q", got)
+	}
+	if got := runner.stdin[changeCmd]; got != "new-passphrase\n" {
+		t.Errorf("change-key received %q", got)
+	}
+	if key, _ := store.Load(ctx, "tank/enc"); string(key) != "new-passphrase" {
+		t.Errorf("stored key = %q", key)
+	}
+
+	runner.AddCommand(changeCmd, "", "permission denied", fmt.Errorf("exit status 1"))
+	if err := client.ChangeKey(ctx, "tank/enc", ChangeKeyOptions{Key: "newer-passphrase", KeyFormat: KeyFormatPassphrase}); err == nil {
+		t.Fatal("Expected change-key failure")
+	}
+	if key, _ := store.Load(ctx, "tank/enc"); string(key) != "new-passphrase" {
+		t.Errorf("stored key not restored after failure, got %q", key)
+	}
+
+	if err := client.ChangeKey(ctx, "tank/enc", ChangeKeyOptions{Inherit: true, Key: "x"}); err == nil {
+		t.Error("Expected error combining inherit with a key")
+	}
+
+	runner.AddCommand("zfs change-key -i tank/enc", "", "", nil)
+	if err := client.ChangeKey(ctx, "tank/enc", ChangeKeyOptions{Inherit: true}); err != nil {
+		t.Fatalf("ChangeKey inherit returned error: %v", err)
+	}
+	if _, err := store.Load(ctx, "tank/enc"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected stored key removed after inherit, got %v", err)
+	}
+}
+
+func TestZFS_ChangeKeyStoresAfterPrompt(t *testing.T) {
+	ctx := context.Background()
+	runner := newStdinRunner()
+	client := &zfs{
+		cmd:  Cmd{Bin: "zfs", Runner: runner},
+		keys: CommandKeyStore{Bin: "vault", Runner: runner},
+	}
+
+	changeCmd := "zfs change-key -o keyformat=passphrase -o keylocation=prompt tank/enc"
+	runner.AddCommand(changeCmd, "", "permission denied", fmt.Errorf("exit status 1"))
+
+	if err := client.ChangeKey(ctx, "tank/enc", ChangeKeyOptions{Key: "new-passphrase", KeyFormat: KeyFormatPassphrase}); err == nil {
+		t.Fatal("Expected change-key failure")
+	}
+	for _, call := range runner.CallHistory {
+		if call.Name == "vault" {
+			t.Fatalf("Key must not be stored when change-key fails: %s", call.Cmd)
+		}
+	}
+
+	runner.AddCommand(changeCmd, "", "", nil)
+	runner.AddCommand("vault store tank/enc", "", "", nil)
+
+	if err := client.ChangeKey(ctx, "tank/enc", ChangeKeyOptions{Key: "new-passphrase", KeyFormat: KeyFormatPassphrase}); err != nil {
+		t.Fatalf("ChangeKey returned error: %v", err)
+	}
+	if last := runner.GetLastCall(); last == nil || last.Cmd != "vault store tank/enc" {
+		t.Errorf("Expected key stored after change-key, last call: %+v", last)
+	}
+	if got := runner.stdin["vault store tank/enc"]; got != "new-passphrase" {
+		t.Errorf("store received %q", got)
+	}
+}
+
+// cancellingRunner cancels the context when the command fails, like a caller giving
+// up while zfs runs.
+type cancellingRunner struct {
+	*testutil.MockRunner
+	cancel context.CancelFunc
+}
+
+func (r cancellingRunner) Run(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, name string, args ...string) error {
+	err := r.MockRunner.Run(ctx, stdin, stdout, stderr, name, args...)
+	if err != nil {
+		r.cancel()
+	}
+	return err
+}
+
+// ctxKeyStore refuses to work with a cancelled context.
+type ctxKeyStore struct {
+	*MemoryKeyStore
+}
+
+func (s ctxKeyStore) Location(dataset string) string {
+	return "file:///keys/" + dataset
+}
+
+func (s ctxKeyStore) Store(ctx context.Context, dataset string, key []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.MemoryKeyStore.Store(ctx, dataset, key)
+}
+
+func TestZFS_ChangeKeyRestoresAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := cancellingRunner{MockRunner: testutil.NewMockRunner(), cancel: cancel}
+	store := ctxKeyStore{NewMemoryKeyStore()}
+	store.Store(ctx, "tank/enc", []byte("old-passphrase"))
+
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: runner}, keys: store}
+
+	runner.AddCommand("zfs change-key -o keyformat=passphrase -o keylocation=file:///keys/tank/enc tank/enc", "", "", fmt.Errorf("signal: killed"))
+
+	err := client.ChangeKey(ctx, "tank/enc", ChangeKeyOptions{Key: "new-passphrase", KeyFormat: KeyFormatPassphrase})
+	if err == nil || strings.Contains(err.Error(), "restoring stored key") {
+		t.Fatalf("Expected change-key failure with the key restored, got %v", err)
+	}
+	if key, _ := store.Load(context.Background(), "tank/enc"); string(key) != "old-passphrase" {
+		t.Errorf("stored key not restored after cancel, got %q", key)
+	}
+}
+
+func TestZFS_RotateKeys(t *testing.T) {
+	ctx := context.Background()
+	runner := newStdinRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: runner,
+		},
+	}
+
+	runner.AddCommand("zfs get -p -r -t fs,vol encryptionroot tank -j", datasetListJSON(
+		testDataset{name: "tank", props: map[string]string{"encryptionroot": "-|NONE"}},
+		testDataset{name: "tank/b", props: map[string]string{"encryptionroot": "tank/b|NONE"}},
+		testDataset{name: "tank/b/child", props: map[string]string{"encryptionroot": "tank/b|NONE"}},
+		testDataset{name: "tank/a", props: map[string]string{"encryptionroot": "tank/a|NONE"}},
+		testDataset{name: "tank/a/own", props: map[string]string{"encryptionroot": "tank/a/own|NONE"}},
+	), "", nil)
+	runner.AddCommand("zfs change-key -o keylocation=file:///keys/tank/a tank/a", "", "", nil)
+	runner.AddCommand("zfs change-key -o keylocation=file:///keys/tank/b tank/b", "", "busy", fmt.Errorf("exit status 1"))
+
+	results, err := client.RotateKeys(ctx, "tank", func(root string) (ChangeKeyOptions, error) {
+		if root == "tank/a/own" {
+			return ChangeKeyOptions{}, errors.New("no key for root")
+		}
+		return ChangeKeyOptions{KeyLocation: "file:///keys/" + root}, nil
+	})
+	if err != nil {
+		t.Fatalf("RotateKeys returned error: %v", err)
+	}
+
+	var got []string
+	for _, r := range results {
+		got = append(got, fmt.Sprintf("%s:%v", r.Dataset, r.Err == nil))
+	}
+	if want := "tank/a:true tank/a/own:false tank/b:false"; strings.Join(got, " ") != want {
+		t.Errorf("results = %v, want %s", got, want)
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	for _, format := range []KeyFormat{KeyFormatPassphrase, KeyFormatHex, KeyFormatRaw} {
+		key, err := GenerateKey(format)
+		if err != nil {
+			t.Fatalf("GenerateKey(%s) returned error: %v", format, err)
+		}
+		if err := ValidateKey(format, []byte(key)); err != nil {
+			t.Errorf("GenerateKey(%s) produced an invalid key: %v", format, err)
+		}
+	}
+
+	if _, err := GenerateKey("pem"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
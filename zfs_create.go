@@ -0,0 +1,328 @@
+package gzfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// KeyFormat is the keyformat of an encrypted dataset.
+type KeyFormat string
+
+const (
+	KeyFormatPassphrase KeyFormat = "passphrase"
+	KeyFormatHex        KeyFormat = "hex"
+	KeyFormatRaw        KeyFormat = "raw"
+)
+
+// EncryptionOptions enables native encryption on a new dataset.
+type EncryptionOptions struct {
+	// Algorithm is the encryption property value. Empty means "on".
+	Algorithm string
+	// Key is the key material in KeyFormat. When set it is saved in the client's
+	// KeyStore and keylocation is taken from the store unless KeyLocation is given.
+	Key string
+	// KeyFormat sets keyformat. Empty keeps a keyformat from Properties, or passphrase.
+	KeyFormat KeyFormat
+	// KeyLocation sets keylocation directly.
+	KeyLocation string
+	// PBKDF2Iters sets pbkdf2iters for passphrase keys. Zero leaves the zfs default.
+	PBKDF2Iters uint64
+}
+
+// FilesystemCreateOptions controls zfs create for file systems.
+type FilesystemCreateOptions struct {
+	// Parents creates missing parent datasets (-p).
+	Parents bool
+	// NoMount leaves the new file system unmounted (-u).
+	NoMount bool
+	// Encryption enables native encryption.
+	Encryption *EncryptionOptions
+	// Properties are passed as -o name=value.
+	Properties map[string]string
+}
+
+// VolumeCreateOptions controls zfs create for volumes.
+type VolumeCreateOptions struct {
+	// Size is the volume size in bytes (-V).
+	Size uint64
+	// Sparse skips the refreservation for the volume size (-s).
+	Sparse bool
+	// BlockSize sets volblocksize. Zero leaves the zfs default.
+	BlockSize uint64
+	// Parents creates missing parent datasets (-p).
+	Parents bool
+	// Encryption enables native encryption.
+	Encryption *EncryptionOptions
+	// Properties are passed as -o name=value.
+	Properties map[string]string
+}
+
+// CreatePlan describes what a create would do, as reported by zfs create -nvP.
+type CreatePlan struct {
+	Name       string            `json:"name"`
+	Properties map[string]string `json:"properties"`
+}
+
+// applyEncryption adds the encryption properties for enc to props and returns the
+// stdin zfs create needs when the key is handed over through a prompt. The key is
+// only saved in the store when write is set, so dry runs leave no trace.
+func (z *zfs) applyEncryption(ctx context.Context, name string, enc *EncryptionOptions, props map[string]string, write bool) (io.Reader, error) {
+	if enc == nil {
+		return nil, nil
+	}
+
+	switch {
+	case enc.Algorithm != "":
+		props["encryption"] = enc.Algorithm
+	case props["encryption"] == "":
+		props["encryption"] = "on"
+	}
+
+	if props["encryption"] == "off" {
+		return nil, fmt.Errorf("encryption options given but encryption=off")
+	}
+
+	// A keyformat given in Properties is kept unless KeyFormat overrides it.
+	format := enc.KeyFormat
+	switch {
+	case format != "":
+		props["keyformat"] = string(format)
+	case props["keyformat"] != "":
+		format = KeyFormat(props["keyformat"])
+	default:
+		format = KeyFormatPassphrase
+		props["keyformat"] = string(format)
+	}
+
+	if enc.PBKDF2Iters > 0 {
+		props["pbkdf2iters"] = strconv.FormatUint(enc.PBKDF2Iters, 10)
+	}
+
+	if enc.KeyLocation != "" {
+		props["keylocation"] = enc.KeyLocation
+	}
+
+	if enc.Key == "" {
+		return nil, nil
+	}
+
+	key := []byte(enc.Key)
+	if err := ValidateKey(format, key); err != nil {
+		return nil, err
+	}
+
+	store := z.keyStore()
+	if enc.KeyLocation == "" {
+		props["keylocation"] = store.Location(name)
+	}
+
+	if write {
+		if err := store.Store(ctx, name, key); err != nil {
+			return nil, err
+		}
+	}
+
+	return keyInput(props["keylocation"], format, key), nil
+}
+
+func appendPropertyArgs(args []string, props map[string]string) []string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		args = append(args, "-o", fmt.Sprintf("%s=%s", k, props[k]))
+	}
+
+	return args
+}
+
+func createArgsPrefix(dryRun, parents bool) []string {
+	args := []string{"create"}
+	if dryRun {
+		args = append(args, "-n", "-v", "-P")
+	}
+	if parents {
+		args = append(args, "-p")
+	}
+	return args
+}
+
+func (z *zfs) filesystemCreateArgs(ctx context.Context, name string, opts FilesystemCreateOptions, dryRun bool) ([]string, io.Reader, error) {
+	if name == "" {
+		return nil, nil, fmt.Errorf("dataset name is empty")
+	}
+
+	props := make(map[string]string, len(opts.Properties))
+	maps.Copy(props, opts.Properties)
+
+	if err := ValidateProperties(DatasetTypeFilesystem, props, true); err != nil {
+		return nil, nil, err
+	}
+
+	stdin, err := z.applyEncryption(ctx, name, opts.Encryption, props, !dryRun)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	args := createArgsPrefix(dryRun, opts.Parents)
+	if opts.NoMount {
+		args = append(args, "-u")
+	}
+
+	args = appendPropertyArgs(args, props)
+	return append(args, name), stdin, nil
+}
+
+func (z *zfs) volumeCreateArgs(ctx context.Context, name string, opts VolumeCreateOptions, dryRun bool) ([]string, io.Reader, error) {
+	if name == "" {
+		return nil, nil, fmt.Errorf("dataset name is empty")
+	}
+	if opts.Size == 0 {
+		return nil, nil, fmt.Errorf("invalid_volume_size: 0")
+	}
+
+	props := make(map[string]string, len(opts.Properties))
+	maps.Copy(props, opts.Properties)
+
+	if _, ok := props["volsize"]; ok {
+		return nil, nil, fmt.Errorf("volsize must be given as Size, not as a property")
+	}
+
+	if opts.BlockSize > 0 {
+		if v, ok := props["volblocksize"]; ok && ParseSize(v) != opts.BlockSize {
+			return nil, nil, fmt.Errorf("conflicting volblocksize %q and BlockSize %d", v, opts.BlockSize)
+		}
+		props["volblocksize"] = strconv.FormatUint(opts.BlockSize, 10)
+	}
+
+	if err := ValidateProperties(DatasetTypeVolume, props, true); err != nil {
+		return nil, nil, err
+	}
+
+	stdin, err := z.applyEncryption(ctx, name, opts.Encryption, props, !dryRun)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	args := createArgsPrefix(dryRun, opts.Parents)
+	if opts.Sparse {
+		args = append(args, "-s")
+	}
+	args = append(args, "-V", strconv.FormatUint(opts.Size, 10))
+
+	args = appendPropertyArgs(args, props)
+	return append(args, name), stdin, nil
+}
+
+func parseCreatePlan(name string, out []byte) (*CreatePlan, error) {
+	plan := &CreatePlan{Name: name, Properties: map[string]string{}}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+
+		switch {
+		case len(fields) >= 2 && fields[0] == "create":
+			plan.Name = fields[1]
+		case len(fields) == 3 && fields[0] == "property":
+			plan.Properties[fields[1]] = fields[2]
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse create plan: %w", err)
+	}
+
+	return plan, nil
+}
+
+// CreateFilesystemWithOptions creates the file system name and returns it.
+func (z *zfs) CreateFilesystemWithOptions(ctx context.Context, name string, opts FilesystemCreateOptions) (*Dataset, error) {
+	args, stdin, err := z.filesystemCreateArgs(ctx, name, opts, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, stdin, args...); err != nil {
+		return nil, err
+	}
+
+	return z.Get(ctx, name, false)
+}
+
+// PlanFilesystemCreate reports what CreateFilesystemWithOptions would create without
+// creating anything.
+func (z *zfs) PlanFilesystemCreate(ctx context.Context, name string, opts FilesystemCreateOptions) (*CreatePlan, error) {
+	args, stdin, err := z.filesystemCreateArgs(ctx, name, opts, true)
+	if err != nil {
+		return nil, err
+	}
+
+	out, _, err := z.cmd.RunBytes(ctx, stdin, args...)
+	if err != nil {
+		return nil, fmt.Errorf("create_plan_failed: %w", err)
+	}
+
+	return parseCreatePlan(name, out)
+}
+
+// CreateVolumeWithOptions creates the volume name and returns it.
+func (z *zfs) CreateVolumeWithOptions(ctx context.Context, name string, opts VolumeCreateOptions) (*Dataset, error) {
+	args, stdin, err := z.volumeCreateArgs(ctx, name, opts, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, stdin, args...); err != nil {
+		return nil, err
+	}
+
+	return z.Get(ctx, name, false)
+}
+
+// PlanVolumeCreate reports what CreateVolumeWithOptions would create without creating
+// anything.
+func (z *zfs) PlanVolumeCreate(ctx context.Context, name string, opts VolumeCreateOptions) (*CreatePlan, error) {
+	args, stdin, err := z.volumeCreateArgs(ctx, name, opts, true)
+	if err != nil {
+		return nil, err
+	}
+
+	out, _, err := z.cmd.RunBytes(ctx, stdin, args...)
+	if err != nil {
+		return nil, fmt.Errorf("create_plan_failed: %w", err)
+	}
+
+	return parseCreatePlan(name, out)
+}
+
+// legacyMinKeyLen is the shortest encryptionKey the map-based create functions
+// have always accepted.
+const legacyMinKeyLen = 32
+
+// legacyEncryption turns the encryptionKey pseudo-property of the map-based create
+// functions into EncryptionOptions.
+func legacyEncryption(props map[string]string) (*EncryptionOptions, error) {
+	key := props["encryptionKey"]
+	delete(props, "encryptionKey")
+
+	if key == "" || props["encryption"] == "off" {
+		return nil, nil
+	}
+
+	if len(key) < legacyMinKeyLen || len(key) > 512 {
+		return nil, fmt.Errorf("invalid_encryption_key_length")
+	}
+
+	return &EncryptionOptions{Key: key}, nil
+}
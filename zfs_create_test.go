@@ -0,0 +1,155 @@
+package gzfs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func TestFilesystemCreateArgs(t *testing.T) {
+	args, _, err := (&zfs{}).filesystemCreateArgs(context.Background(), "tank/a/b", FilesystemCreateOptions{
+		Parents: true,
+		NoMount: true,
+		Encryption: &EncryptionOptions{
+			KeyFormat:   KeyFormatHex,
+			KeyLocation: "prompt",
+			PBKDF2Iters: 350000,
+		},
+		Properties: map[string]string{"compression": "zstd", "atime": "off"},
+	}, false)
+	if err != nil {
+		t.Fatalf("filesystemCreateArgs returned error: %v", err)
+	}
+
+	want := "create -p -u -o atime=off -o compression=zstd -o encryption=on -o keyformat=hex -o keylocation=prompt -o pbkdf2iters=350000 tank/a/b"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+
+	args, _, err = (&zfs{}).filesystemCreateArgs(context.Background(), "tank/x", FilesystemCreateOptions{
+		Encryption: &EncryptionOptions{KeyLocation: "file:///keys/x"},
+		Properties: map[string]string{"keyformat": "raw"},
+	}, false)
+	if err != nil || !strings.Contains(strings.Join(args, " "), "-o keyformat=raw ") {
+		t.Errorf("Expected keyformat from Properties to be kept, got %v, %v", args, err)
+	}
+
+	if _, _, err := (&zfs{}).filesystemCreateArgs(context.Background(), "tank/x", FilesystemCreateOptions{
+		Encryption: &EncryptionOptions{Key: "short"},
+	}, true); err == nil {
+		t.Error("Expected error for short encryption key")
+	}
+
+	if _, _, err := (&zfs{}).filesystemCreateArgs(context.Background(), "tank/x", FilesystemCreateOptions{
+		Encryption: &EncryptionOptions{KeyLocation: "prompt"},
+		Properties: map[string]string{"encryption": "off"},
+	}, false); err == nil {
+		t.Error("Expected error for encryption options with encryption=off")
+	}
+}
+
+func TestVolumeCreateArgs(t *testing.T) {
+	args, _, err := (&zfs{}).volumeCreateArgs(context.Background(), "tank/vol", VolumeCreateOptions{
+		Size:       1 << 30,
+		Sparse:     true,
+		BlockSize:  16384,
+		Properties: map[string]string{"volmode": "dev"},
+	}, true)
+	if err != nil {
+		t.Fatalf("volumeCreateArgs returned error: %v", err)
+	}
+
+	want := "create -n -v -P -s -V 1073741824 -o volblocksize=16384 -o volmode=dev tank/vol"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+
+	if _, _, err := (&zfs{}).volumeCreateArgs(context.Background(), "tank/vol", VolumeCreateOptions{}, false); err == nil {
+		t.Error("Expected error for zero size")
+	}
+	if _, _, err := (&zfs{}).volumeCreateArgs(context.Background(), "tank/vol", VolumeCreateOptions{
+		Size:       1 << 30,
+		BlockSize:  8192,
+		Properties: map[string]string{"volblocksize": "16K"},
+	}, false); err == nil {
+		t.Error("Expected error for conflicting block sizes")
+	}
+}
+
+func TestZFS_PlanVolumeCreate(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	mockRunner.AddCommand("zfs create -n -v -P -p -V 1073741824 tank/vms/disk0",
+		"create\ttank/vms/disk0\nproperty\tvolsize\t1073741824\nproperty\trefreservation\t1108344832\n", "", nil)
+
+	plan, err := client.PlanVolumeCreate(ctx, "tank/vms/disk0", VolumeCreateOptions{Size: 1 << 30, Parents: true})
+	if err != nil {
+		t.Fatalf("PlanVolumeCreate returned error: %v", err)
+	}
+
+	if plan.Name != "tank/vms/disk0" || plan.Properties["volsize"] != "1073741824" || plan.Properties["refreservation"] != "1108344832" {
+		t.Errorf("Unexpected plan: %+v", plan)
+	}
+}
+
+func TestZFS_CreateFilesystem_Legacy(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	mockRunner.AddCommand("zfs create -o compression=lz4 -o readonly=off tank/new", "", "", nil)
+	mockRunner.AddCommand("zfs list -o "+strings.Join(dsPropList, ",")+" -p tank/new -j", datasetListJSON(
+		testDataset{name: "tank/new", typ: DatasetTypeFilesystem},
+	), "", nil)
+
+	props := map[string]string{"compression": "lz4", "quota": ""}
+	ds, err := client.CreateFilesystem(ctx, "tank/new", props)
+	if err != nil {
+		t.Fatalf("CreateFilesystem returned error: %v", err)
+	}
+	if ds == nil || ds.Name != "tank/new" {
+		t.Errorf("Unexpected dataset: %+v", ds)
+	}
+	if len(props) != 2 {
+		t.Error("CreateFilesystem mutated the caller's map")
+	}
+
+	mockRunner.AddCommand("zfs create -p -s -V 1073741824 -o readonly=off -o volmode=dev tank/vol", "", "", nil)
+	mockRunner.AddCommand("zfs list -o "+strings.Join(dsPropList, ",")+" -p tank/vol -j", datasetListJSON(
+		testDataset{name: "tank/vol", typ: DatasetTypeVolume},
+	), "", nil)
+
+	if _, err := client.CreateVolume(ctx, "tank/vol", 1<<30, map[string]string{
+		"sparse": "on", "parent": "tank", "size": "1G", "volmode": "dev",
+	}); err != nil {
+		t.Fatalf("CreateVolume returned error: %v", err)
+	}
+
+	calls := len(mockRunner.CallHistory)
+	short := map[string]string{"encryption": "on", "encryptionKey": "shortpassphrase"}
+	if _, err := client.CreateFilesystem(ctx, "tank/secret", short); err == nil || !strings.Contains(err.Error(), "invalid_encryption_key_length") {
+		t.Errorf("Expected legacy minimum key length on CreateFilesystem, got %v", err)
+	}
+	if _, err := client.CreateVolume(ctx, "tank/secretvol", 1<<30, short); err == nil || !strings.Contains(err.Error(), "invalid_encryption_key_length") {
+		t.Errorf("Expected legacy minimum key length on CreateVolume, got %v", err)
+	}
+	if len(mockRunner.CallHistory) != calls {
+		t.Errorf("No zfs command should run for a short legacy key")
+	}
+}
@@ -0,0 +1,198 @@
+package gzfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DestroyOptions controls how a dataset, snapshot range or snapshot list is destroyed.
+type DestroyOptions struct {
+	// Recursive destroys all descendants (-r).
+	Recursive bool
+	// Dependents destroys all dependents including clones outside the hierarchy (-R).
+	Dependents bool
+	// Defer marks snapshots for deferred destruction (-d).
+	Defer bool
+	// Force unmounts file systems before destroying them (-f).
+	Force bool
+
+	// RemoveKey deletes the target's key from the client's KeyStore after it has
+	// been destroyed.
+	RemoveKey bool
+
+	// AllowBusy, AllowHolds and AllowClones override the matching SafetyOptions checks.
+	AllowBusy   bool
+	AllowHolds  bool
+	AllowClones bool
+}
+
+// DestroyPlan describes what a destroy would remove, as reported by zfs destroy -nvp.
+type DestroyPlan struct {
+	Target   string   `json:"target"`
+	Datasets []string `json:"datasets"`
+	Reclaim  uint64   `json:"reclaim"`
+}
+
+// SnapshotRange returns the zfs destroy spec for the inclusive range from%to on dataset.
+// Either bound may be empty to leave that end of the range open.
+func SnapshotRange(dataset, from, to string) string {
+	return fmt.Sprintf("%s@%s%%%s", dataset, from, to)
+}
+
+// SnapshotList returns the zfs destroy spec for a comma-separated list of snapshots on
+// dataset. Entries may themselves be ranges of the form a%b.
+func SnapshotList(dataset string, snapshots ...string) string {
+	return fmt.Sprintf("%s@%s", dataset, strings.Join(snapshots, ","))
+}
+
+func validateDestroyTarget(target string) error {
+	if target == "" {
+		return fmt.Errorf("destroy target is empty")
+	}
+
+	dataset, snaps, isSnap := strings.Cut(target, "@")
+	if dataset == "" {
+		return fmt.Errorf("invalid_destroy_target: %s", target)
+	}
+	if !isSnap {
+		return nil
+	}
+
+	if snaps == "" {
+		return fmt.Errorf("invalid_destroy_target: %s", target)
+	}
+
+	for _, entry := range strings.Split(snaps, ",") {
+		if entry == "" || entry == "%" {
+			return fmt.Errorf("invalid_snapshot_spec: %s", target)
+		}
+		if strings.Count(entry, "%") > 1 || strings.ContainsAny(entry, "@/") {
+			return fmt.Errorf("invalid_snapshot_spec: %s", target)
+		}
+	}
+
+	return nil
+}
+
+func destroyArgs(target string, opts DestroyOptions, dryRun bool) []string {
+	args := []string{"destroy"}
+
+	if dryRun {
+		args = append(args, "-n", "-v", "-p")
+	}
+	if opts.Recursive {
+		args = append(args, "-r")
+	}
+	if opts.Dependents {
+		args = append(args, "-R")
+	}
+	if opts.Defer {
+		args = append(args, "-d")
+	}
+	if opts.Force {
+		args = append(args, "-f")
+	}
+
+	return append(args, target)
+}
+
+func parseDestroyPlan(target string, out []byte) (*DestroyPlan, error) {
+	plan := &DestroyPlan{Target: target, Datasets: []string{}}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "destroy":
+			plan.Datasets = append(plan.Datasets, fields[1])
+		case "reclaim":
+			plan.Reclaim = ParseUint64(fields[1])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse destroy plan: %w", err)
+	}
+
+	return plan, nil
+}
+
+// PlanDestroy reports which datasets destroying target would remove and how much space
+// would be reclaimed, without destroying anything. Target may be a dataset, a snapshot,
+// a snapshot range (fs@a%b) or a snapshot list (fs@a,b).
+func (z *zfs) PlanDestroy(ctx context.Context, target string, opts DestroyOptions) (*DestroyPlan, error) {
+	if err := validateDestroyTarget(target); err != nil {
+		return nil, err
+	}
+
+	out, _, err := z.cmd.RunBytes(ctx, nil, destroyArgs(target, opts, true)...)
+	if err != nil {
+		return nil, fmt.Errorf("destroy_plan_failed: %w", err)
+	}
+
+	return parseDestroyPlan(target, out)
+}
+
+// DestroyWithOptions destroys target, which may be a dataset, a snapshot, a snapshot
+// range or a snapshot list.
+func (z *zfs) DestroyWithOptions(ctx context.Context, target string, opts DestroyOptions) error {
+	if err := validateDestroyTarget(target); err != nil {
+		return err
+	}
+
+	if err := z.checkDestroy(ctx, target, opts); err != nil {
+		return err
+	}
+
+	removeKey := opts.RemoveKey && !strings.Contains(target, "@")
+
+	// The keylocation of a legacy key file is gone once the dataset is.
+	var legacyKey string
+	if removeKey {
+		var err error
+		if legacyKey, err = z.legacyKeyPath(ctx, target); err != nil {
+			return fmt.Errorf("error_resolving_key_location: %w", err)
+		}
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, destroyArgs(target, opts, false)...); err != nil {
+		return fmt.Errorf("dataset_destroy_failed: %w", err)
+	}
+
+	if removeKey {
+		if err := z.removeStoredKey(ctx, target, legacyKey); err != nil {
+			return fmt.Errorf("dataset_destroyed_but_key_removal_failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Dataset) PlanDestroy(ctx context.Context, recursive bool) (*DestroyPlan, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.PlanDestroy(ctx, d.Name, DestroyOptions{Recursive: recursive})
+}
+
+func (d *Dataset) DestroyWithOptions(ctx context.Context, opts DestroyOptions) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.DestroyWithOptions(ctx, d.Name, opts)
+}
@@ -0,0 +1,168 @@
+package gzfs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+const destroyPlanOutput = "destroy\ttank/app@snap-001\ndestroy\ttank/app@snap-002\ndestroy\ttank/app@snap-003\nreclaim\t123456\n"
+
+func TestSnapshotSpecs(t *testing.T) {
+	if got, want := SnapshotRange("tank/app", "a", "c"), "tank/app@a%c"; got != want {
+		t.Errorf("SnapshotRange = %q, want %q", got, want)
+	}
+	if got, want := SnapshotRange("tank/app", "", "c"), "tank/app@%c"; got != want {
+		t.Errorf("SnapshotRange open start = %q, want %q", got, want)
+	}
+	if got, want := SnapshotList("tank/app", "a", "b%d", "x"), "tank/app@a,b%d,x"; got != want {
+		t.Errorf("SnapshotList = %q, want %q", got, want)
+	}
+}
+
+func TestValidateDestroyTarget(t *testing.T) {
+	tests := []struct {
+		target      string
+		expectError bool
+	}{
+		{"tank/app", false},
+		{"tank/app@snap", false},
+		{"tank/app@a%c", false},
+		{"tank/app@%c", false},
+		{"tank/app@a,b,c%d", false},
+		{"", true},
+		{"@snap", true},
+		{"tank/app@", true},
+		{"tank/app@%", true},
+		{"tank/app@a,,b", true},
+		{"tank/app@a%b%c", true},
+		{"tank/app@a,tank/other@b", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			err := validateDestroyTarget(tt.target)
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestZFS_PlanDestroy(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	target := SnapshotRange("tank/app", "snap-001", "snap-003")
+	mockRunner.AddCommand("zfs destroy -n -v -p "+target, destroyPlanOutput, "", nil)
+
+	plan, err := client.PlanDestroy(ctx, target, DestroyOptions{})
+	if err != nil {
+		t.Fatalf("PlanDestroy returned error: %v", err)
+	}
+
+	if plan.Target != target {
+		t.Errorf("Expected target %q, got %q", target, plan.Target)
+	}
+	if len(plan.Datasets) != 3 {
+		t.Fatalf("Expected 3 datasets, got %d: %v", len(plan.Datasets), plan.Datasets)
+	}
+	if plan.Datasets[0] != "tank/app@snap-001" || plan.Datasets[2] != "tank/app@snap-003" {
+		t.Errorf("Unexpected datasets: %v", plan.Datasets)
+	}
+	if plan.Reclaim != 123456 {
+		t.Errorf("Expected reclaim 123456, got %d", plan.Reclaim)
+	}
+
+	if got := mockRunner.GetLastCall().Cmd; got != "zfs destroy -n -v -p "+target {
+		t.Errorf("Unexpected command: %s", got)
+	}
+}
+
+func TestZFS_PlanDestroyRecursive(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	mockRunner.AddCommand("zfs destroy -n -v -p -r -R tank/app", "destroy\ttank/app/child\ndestroy\ttank/app\nreclaim\t42\n", "", nil)
+	mockRunner.AddCommand("zfs destroy -n -v -p -r tank/app", "destroy\ttank/app/child\ndestroy\ttank/app\nreclaim\t40\n", "", nil)
+
+	plan, err := client.PlanDestroy(ctx, "tank/app", DestroyOptions{Recursive: true, Dependents: true})
+	if err != nil {
+		t.Fatalf("PlanDestroy returned error: %v", err)
+	}
+	if len(plan.Datasets) != 2 || plan.Reclaim != 42 {
+		t.Errorf("Unexpected plan: %+v", plan)
+	}
+
+	ds := &Dataset{z: client, Name: "tank/app", Type: DatasetTypeFilesystem}
+	plan, err = ds.PlanDestroy(ctx, true)
+	if err != nil {
+		t.Fatalf("Dataset.PlanDestroy returned error: %v", err)
+	}
+	if plan.Reclaim != 40 {
+		t.Errorf("Expected reclaim 40, got %d", plan.Reclaim)
+	}
+}
+
+func TestZFS_PlanDestroyError(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	_, err := client.PlanDestroy(ctx, "tank/app@a%b%c", DestroyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "invalid_snapshot_spec") {
+		t.Fatalf("Expected invalid_snapshot_spec error, got %v", err)
+	}
+	if len(mockRunner.CallHistory) != 0 {
+		t.Errorf("Expected no commands to run, got %d", len(mockRunner.CallHistory))
+	}
+
+	_, err = client.PlanDestroy(ctx, "tank/missing", DestroyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "destroy_plan_failed") {
+		t.Fatalf("Expected destroy_plan_failed error, got %v", err)
+	}
+}
+
+func TestZFS_DestroyWithOptions(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	target := SnapshotList("tank/app", "a", "c%e")
+	mockRunner.AddCommand("zfs destroy -d "+target, "", "", nil)
+
+	if err := client.DestroyWithOptions(ctx, target, DestroyOptions{Defer: true}); err != nil {
+		t.Fatalf("DestroyWithOptions returned error: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GetOptions controls zfs get. The zero value fetches the properties of the named
+// datasets only, whatever their source.
+type GetOptions struct {
+	// Recursive includes all descendants (-r).
+	Recursive bool
+	// Depth limits recursion to the given depth (-d). Zero means unlimited.
+	Depth int
+	// Sources keeps only properties with one of these sources (-s).
+	Sources []PropertyOrigin
+	// Types restricts the datasets considered (-t).
+	Types []DatasetType
+}
+
+func getPropertiesArgs(names, props []string, opts GetOptions) []string {
+	args := append([]string{"get"}, zfsArgs...)
+
+	if opts.Recursive {
+		args = append(args, "-r")
+	}
+
+	if opts.Depth > 0 {
+		args = append(args, "-d", strconv.Itoa(opts.Depth))
+	}
+
+	if len(opts.Sources) > 0 {
+		sources := make([]string, len(opts.Sources))
+		for i, s := range opts.Sources {
+			sources[i] = string(s)
+		}
+		args = append(args, "-s", strings.Join(sources, ","))
+	}
+
+	if len(opts.Types) > 0 {
+		types := make([]string, len(opts.Types))
+		for i, t := range opts.Types {
+			types[i] = toZfsType(t)
+		}
+		args = append(args, "-t", strings.Join(types, ","))
+	}
+
+	if len(props) == 0 {
+		args = append(args, "all")
+	} else {
+		args = append(args, strings.Join(props, ","))
+	}
+
+	return append(args, names...)
+}
+
+func validateGetOptions(props []string, opts GetOptions) error {
+	if opts.Depth < 0 {
+		return fmt.Errorf("invalid_get_depth: %d", opts.Depth)
+	}
+
+	for _, prop := range props {
+		if prop == "" || strings.ContainsAny(prop, ", \t") {
+			return fmt.Errorf("invalid_property_selection: %q", prop)
+		}
+	}
+
+	for _, s := range opts.Sources {
+		switch s {
+		case OriginLocal, OriginInherited, OriginReceived, OriginDefault, OriginTemporary, OriginNone:
+		default:
+			return fmt.Errorf("invalid_property_source: %q", s)
+		}
+	}
+
+	for _, t := range opts.Types {
+		if toZfsType(t) == "" {
+			return fmt.Errorf("invalid_dataset_type: %q", t)
+		}
+	}
+
+	return nil
+}
+
+// GetProperties fetches props (all properties when empty) for names with a single zfs
+// get and returns them keyed by dataset and then property name. With no names, every
+// dataset is considered. Datasets with no property left after source filtering are
+// omitted.
+func (z *zfs) GetProperties(ctx context.Context, names, props []string, opts GetOptions) (map[string]map[string]ZFSProperty, error) {
+	if err := validateGetOptions(props, opts); err != nil {
+		return nil, err
+	}
+
+	var resp DatasetList
+
+	if err := z.cmd.runJSONAllowEmpty(ctx, &resp, getPropertiesArgs(names, props, opts)...); err != nil {
+		return nil, fmt.Errorf("get_properties_failed: %w", err)
+	}
+
+	result := make(map[string]map[string]ZFSProperty, len(resp.Datasets))
+	for name, ds := range resp.Datasets {
+		if ds == nil || len(ds.Properties) == 0 {
+			continue
+		}
+		result[name] = ds.Properties
+	}
+
+	return result, nil
+}
+
+func (d *Dataset) GetProperties(ctx context.Context, props []string, opts GetOptions) (map[string]map[string]ZFSProperty, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.GetProperties(ctx, []string{d.Name}, props, opts)
+}
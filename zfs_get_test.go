@@ -0,0 +1,88 @@
+package gzfs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func TestGetPropertiesArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		props []string
+		opts  GetOptions
+		want  string
+	}{
+		{"defaults to all", []string{"tank"}, nil, GetOptions{}, "get -p all tank"},
+		{"recursive local", []string{"tank/vm"}, nil,
+			GetOptions{Recursive: true, Sources: []PropertyOrigin{OriginLocal}},
+			"get -p -r -s local all tank/vm"},
+		{"depth sources types", []string{"backup", "tank"}, []string{"compression", "quota"},
+			GetOptions{Depth: 2, Sources: []PropertyOrigin{OriginLocal, OriginReceived}, Types: []DatasetType{DatasetTypeFilesystem, DatasetTypeVolume}},
+			"get -p -d 2 -s local,received -t fs,vol compression,quota backup tank"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(getPropertiesArgs(tt.names, tt.props, tt.opts), " ")
+			if got != tt.want {
+				t.Errorf("getPropertiesArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZFS_GetProperties(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	mockRunner.AddCommand("zfs get -p -r -s received all backup -j", datasetListJSON(
+		testDataset{name: "backup/app", props: map[string]string{
+			"compression": "zstd|RECEIVED",
+			"com.ourco:x": "1|RECEIVED",
+		}},
+		testDataset{name: "backup/app/db", props: map[string]string{"recordsize": "16384|RECEIVED"}},
+		testDataset{name: "backup"},
+	), "", nil)
+
+	got, err := client.GetProperties(ctx, []string{"backup"}, nil, GetOptions{
+		Recursive: true,
+		Sources:   []PropertyOrigin{OriginReceived},
+	})
+	if err != nil {
+		t.Fatalf("GetProperties returned error: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 datasets, got %d: %v", len(got), got)
+	}
+	if got["backup/app"]["compression"].Value != "zstd" || got["backup/app/db"]["recordsize"].Value != "16384" {
+		t.Errorf("Unexpected properties: %v", got)
+	}
+	if len(mockRunner.CallHistory) != 1 {
+		t.Errorf("Expected a single zfs get, got %d calls", len(mockRunner.CallHistory))
+	}
+
+	mockRunner.AddCommand("zfs get -p -s local all tank/empty -j", "", "", nil)
+	got, err = client.GetProperties(ctx, []string{"tank/empty"}, nil, GetOptions{Sources: []PropertyOrigin{OriginLocal}})
+	if err != nil || len(got) != 0 {
+		t.Errorf("Expected no properties, got %v, %v", got, err)
+	}
+
+	if _, err := client.GetProperties(ctx, nil, []string{"a,b"}, GetOptions{}); err == nil {
+		t.Error("Expected error for invalid property name")
+	}
+	if _, err := client.GetProperties(ctx, nil, nil, GetOptions{Sources: []PropertyOrigin{"bogus"}}); err == nil {
+		t.Error("Expected error for invalid source")
+	}
+}
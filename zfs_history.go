@@ -0,0 +1,278 @@
+package gzfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DiffChange is the change type reported by zfs diff.
+type DiffChange string
+
+const (
+	DiffAdded    DiffChange = "+"
+	DiffRemoved  DiffChange = "-"
+	DiffModified DiffChange = "M"
+	DiffRenamed  DiffChange = "R"
+)
+
+// DiffEntry is one line of zfs diff output. NewPath is only set for renames.
+type DiffEntry struct {
+	Change  DiffChange `json:"change"`
+	Path    string     `json:"path"`
+	NewPath string     `json:"newPath,omitempty"`
+}
+
+// FileChangeKind is how a file differs from the previous snapshot.
+type FileChangeKind string
+
+const (
+	FileCreated  FileChangeKind = "created"
+	FileModified FileChangeKind = "modified"
+	FileDeleted  FileChangeKind = "deleted"
+)
+
+// FileChange is the first snapshot in which a file appeared, changed or was gone.
+// Size, ModTime and Hash describe the new version and are empty for deletions.
+type FileChange struct {
+	Snapshot string         `json:"snapshot"`
+	Kind     FileChangeKind `json:"kind"`
+	Size     int64          `json:"size"`
+	ModTime  time.Time      `json:"modTime"`
+	Hash     string         `json:"hash,omitempty"`
+}
+
+// FileHistoryOptions controls FileHistory.
+type FileHistoryOptions struct {
+	// Hash compares the SHA-256 of regular files in addition to size and mtime, which
+	// catches edits that kept both.
+	Hash bool
+	// UseDiff asks zfs diff which snapshots touched the file and only inspects those.
+	// It needs the diff permission on the dataset.
+	UseDiff bool
+}
+
+// unescapeDiffPath decodes the \NNNN octal escapes zfs diff uses for spaces,
+// backslashes and non-printable bytes.
+func unescapeDiffPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+5 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+5], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 4
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+func parseDiff(out []byte) ([]DiffEntry, error) {
+	entries := []DiffEntry{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		e := DiffEntry{Change: DiffChange(fields[0])}
+
+		switch {
+		case e.Change == DiffRenamed && len(fields) == 3:
+			e.Path, e.NewPath = unescapeDiffPath(fields[1]), unescapeDiffPath(fields[2])
+		case (e.Change == DiffAdded || e.Change == DiffRemoved || e.Change == DiffModified) && len(fields) == 2:
+			e.Path = unescapeDiffPath(fields[1])
+		default:
+			return nil, fmt.Errorf("unexpected_diff_output: %q", line)
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse diff output: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Diff lists the changes between snapshot from and to, which is a later snapshot of
+// the same file system or the file system itself.
+func (z *zfs) Diff(ctx context.Context, from, to string) ([]DiffEntry, error) {
+	if !strings.Contains(from, "@") {
+		return nil, fmt.Errorf("invalid_diff_source: %s is not a snapshot", from)
+	}
+	if to == "" {
+		return nil, fmt.Errorf("diff target is empty")
+	}
+
+	out, _, err := z.cmd.RunBytes(ctx, nil, "diff", "-H", from, to)
+	if err != nil {
+		return nil, fmt.Errorf("diff_failed: %w", err)
+	}
+
+	return parseDiff(out)
+}
+
+// diffTouches reports whether entries change path, or rename or remove a directory
+// above it. zfs diff only lists the directory in that case, not what it contains.
+func diffTouches(entries []DiffEntry, path string) bool {
+	above := func(dir string) bool {
+		return dir != "" && strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+	}
+
+	for _, e := range entries {
+		if e.Path == path || e.NewPath == path {
+			return true
+		}
+		if (e.Change == DiffRenamed || e.Change == DiffRemoved) && (above(e.Path) || above(e.NewPath)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// FileHistory walks the snapshots of the file system, oldest first, and reports every
+// snapshot in which rel, relative to the mountpoint, first appeared, changed or was
+// deleted.
+func (d *Dataset) FileHistory(ctx context.Context, rel string, opts FileHistoryOptions) ([]FileChange, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+
+	mountpoint, err := d.z.mountpointOf(ctx, d.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	snaps, err := d.snapshotNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	livePath := pathUnder(mountpoint, rel)
+	changes := []FileChange{}
+
+	var current *FileChange
+	for i, snap := range snaps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if opts.UseDiff && i > 0 {
+			entries, err := d.z.Diff(ctx, snaps[i-1], snap)
+			if err != nil {
+				return nil, err
+			}
+			if !diffTouches(entries, livePath) {
+				continue
+			}
+		}
+
+		_, short, _ := strings.Cut(snap, "@")
+		p := pathUnder(filepath.Join(mountpoint, snapshotDir, short), rel)
+
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			if current != nil {
+				changes = append(changes, FileChange{Snapshot: snap, Kind: FileDeleted})
+				current = nil
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("snapshot_file_stat_failed: %w", err)
+		}
+
+		version := FileChange{Snapshot: snap, Size: info.Size(), ModTime: info.ModTime()}
+		if opts.Hash && info.Mode().IsRegular() {
+			if version.Hash, err = hashFile(p); err != nil {
+				return nil, fmt.Errorf("snapshot_file_hash_failed: %w", err)
+			}
+		}
+
+		switch {
+		case current == nil:
+			version.Kind = FileCreated
+		case current.Size != version.Size || !current.ModTime.Equal(version.ModTime) || current.Hash != version.Hash:
+			version.Kind = FileModified
+		default:
+			continue
+		}
+
+		changes = append(changes, version)
+		current = &changes[len(changes)-1]
+	}
+
+	return changes, nil
+}
+
+// FileHistory is Dataset.FileHistory for an absolute path, resolved to the mounted
+// file system that contains it.
+func (z *zfs) FileHistory(ctx context.Context, path string, opts FileHistoryOptions) ([]FileChange, error) {
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("invalid_path: %q is not absolute", path)
+	}
+	path = filepath.Clean(path)
+
+	mounts, err := z.Mounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var best MountRecord
+	for _, m := range mounts {
+		mp := filepath.Clean(m.Mountpoint)
+		within := path == mp || strings.HasPrefix(path, strings.TrimSuffix(mp, "/")+"/")
+		if within && len(mp) > len(best.Mountpoint) {
+			best = MountRecord{Dataset: m.Dataset, Mountpoint: mp}
+		}
+	}
+	if best.Dataset == "" {
+		return nil, fmt.Errorf("path_not_on_zfs: %s", path)
+	}
+
+	rel, err := filepath.Rel(best.Mountpoint, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return (&Dataset{z: z, Name: best.Dataset}).FileHistory(ctx, rel, opts)
+}
@@ -0,0 +1,158 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func TestParseDiff(t *testing.T) {
+	entries, err := parseDiff([]byte("M\t/tank/home/alice/\n" +
+		"+\t/tank/home/alice/my\\0040report.doc\n" +
+		"R\t/tank/home/alice/a\t/tank/home/alice/b\n"))
+	if err != nil {
+		t.Fatalf("parseDiff returned error: %v", err)
+	}
+
+	if len(entries) != 3 || entries[1].Path != "/tank/home/alice/my report.doc" || entries[2].NewPath != "/tank/home/alice/b" {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+
+	if _, err := parseDiff([]byte("X\t/a\n")); err == nil {
+		t.Error("Expected error for an unknown change type")
+	}
+}
+
+func TestZFS_FileHistory(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+
+	mockRunner.AddCommand("zfs mount -j", `{"datasets": {
+		"tank": {"name": "tank", "mountpoint": "/"},
+		"tank/home": {"name": "tank/home", "mountpoint": "`+root+`"}
+	}}`, "", nil)
+
+	var snaps []testDataset
+	for i := 1; i <= 6; i++ {
+		snaps = append(snaps, testDataset{name: fmt.Sprintf("tank/home@s%d", i), props: map[string]string{"createtxg": fmt.Sprintf("%d|NONE", i*10)}})
+	}
+	mockRunner.AddCommand("zfs get -p -d 1 -t snap createtxg tank/home -j", datasetListJSON(snaps...), "", nil)
+
+	mtime := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	file := func(snap, content string, mtime time.Time) {
+		writeSnapshotFile(t, filepath.Join(root, ".zfs", "snapshot", snap, "alice", "report.doc"), content, 0o644, mtime)
+	}
+	// s1: missing, s2: created, s3: unchanged, s4: same size and mtime but new
+	// content, s5: deleted, s6: recreated.
+	os.MkdirAll(filepath.Join(root, ".zfs", "snapshot", "s1"), 0o755)
+	file("s2", "draft", mtime)
+	file("s3", "draft", mtime)
+	file("s4", "final", mtime)
+	os.MkdirAll(filepath.Join(root, ".zfs", "snapshot", "s5"), 0o755)
+	file("s6", "redone", mtime.Add(time.Hour))
+
+	summarize := func(changes []FileChange) string {
+		var got []string
+		for _, c := range changes {
+			got = append(got, strings.TrimPrefix(c.Snapshot, "tank/home@")+":"+string(c.Kind))
+		}
+		return strings.Join(got, " ")
+	}
+
+	changes, err := client.FileHistory(ctx, filepath.Join(root, "alice", "report.doc"), FileHistoryOptions{})
+	if err != nil {
+		t.Fatalf("FileHistory returned error: %v", err)
+	}
+	if got, want := summarize(changes), "s2:created s5:deleted s6:created"; got != want {
+		t.Errorf("FileHistory = %s, want %s", got, want)
+	}
+
+	changes, err = client.FileHistory(ctx, filepath.Join(root, "alice", "report.doc"), FileHistoryOptions{Hash: true})
+	if err != nil {
+		t.Fatalf("FileHistory returned error: %v", err)
+	}
+	if got, want := summarize(changes), "s2:created s4:modified s5:deleted s6:created"; got != want {
+		t.Errorf("FileHistory with hashes = %s, want %s", got, want)
+	}
+	if changes[0].Size != 5 || changes[0].Hash == "" || changes[2].Hash != "" {
+		t.Errorf("Unexpected change details: %+v", changes)
+	}
+
+	// With zfs diff only the snapshots that touched the file are inspected. The s4
+	// edit kept size and mtime, so neither mode reports it without hashes.
+	path := filepath.Join(root, "alice", "report.doc")
+	diffs := map[int]string{2: "+", 4: "M", 5: "-", 6: "+"}
+	for i := 2; i <= 6; i++ {
+		out := ""
+		if change, ok := diffs[i]; ok {
+			out = change + "\t" + path + "\n"
+		}
+		mockRunner.AddCommand(fmt.Sprintf("zfs diff -H tank/home@s%d tank/home@s%d", i-1, i), out, "", nil)
+	}
+
+	changes, err = client.FileHistory(ctx, path, FileHistoryOptions{UseDiff: true})
+	if err != nil {
+		t.Fatalf("FileHistory with diff returned error: %v", err)
+	}
+	if got, want := summarize(changes), "s2:created s5:deleted s6:created"; got != want {
+		t.Errorf("FileHistory with diff = %s, want %s", got, want)
+	}
+
+	if _, err := client.FileHistory(ctx, "relative/path", FileHistoryOptions{}); err == nil {
+		t.Error("Expected error for a relative path")
+	}
+}
+
+func TestZFS_FileHistoryRenamedDirectory(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+
+	mockRunner.AddCommand("zfs mount -j", `{"datasets": {"tank/home": {"name": "tank/home", "mountpoint": "`+root+`"}}}`, "", nil)
+
+	var snaps []testDataset
+	for i := 1; i <= 4; i++ {
+		snaps = append(snaps, testDataset{name: fmt.Sprintf("tank/home@s%d", i), props: map[string]string{"createtxg": fmt.Sprintf("%d|NONE", i*10)}})
+	}
+	mockRunner.AddCommand("zfs get -p -d 1 -t snap createtxg tank/home -j", datasetListJSON(snaps...), "", nil)
+
+	// alice/ is renamed away at s3 and back at s4; zfs diff only names the directory.
+	mtime := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for snap, dir := range map[string]string{"s1": "alice", "s2": "alice", "s3": "alice.old", "s4": "alice"} {
+		writeSnapshotFile(t, filepath.Join(root, ".zfs", "snapshot", snap, dir, "report.doc"), "draft", 0o644, mtime)
+	}
+
+	alice, old := filepath.Join(root, "alice"), filepath.Join(root, "alice.old")
+	mockRunner.AddCommand("zfs diff -H tank/home@s1 tank/home@s2", "", "", nil)
+	mockRunner.AddCommand("zfs diff -H tank/home@s2 tank/home@s3", "R\t"+alice+"\t"+old+"\n", "", nil)
+	mockRunner.AddCommand("zfs diff -H tank/home@s3 tank/home@s4", "R\t"+old+"\t"+alice+"\n", "", nil)
+
+	path := filepath.Join(alice, "report.doc")
+	var results []string
+	for _, opts := range []FileHistoryOptions{{}, {UseDiff: true}} {
+		changes, err := client.FileHistory(ctx, path, opts)
+		if err != nil {
+			t.Fatalf("FileHistory(%+v) returned error: %v", opts, err)
+		}
+
+		var got []string
+		for _, c := range changes {
+			got = append(got, strings.TrimPrefix(c.Snapshot, "tank/home@")+":"+string(c.Kind))
+		}
+		results = append(results, strings.Join(got, " "))
+	}
+
+	want := "s1:created s3:deleted s4:created"
+	if results[0] != want || results[1] != want {
+		t.Errorf("FileHistory = %q, with diff = %q, want %q for both", results[0], results[1], want)
+	}
+}
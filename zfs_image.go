@@ -0,0 +1,334 @@
+package gzfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const defaultImageBlockSize = 1 << 20
+
+// imageSizeAlign rounds the size of volumes created for an image up to a multiple of
+// every valid volblocksize.
+const imageSizeAlign = 128 << 10
+
+// ImageOptions controls raw image export and import.
+type ImageOptions struct {
+	// BlockSize is the copy unit and the granularity at which zero blocks are
+	// skipped. Zero means 1 MiB.
+	BlockSize int
+	// Progress is called after every block with the bytes copied so far and the total.
+	Progress func(done, total uint64)
+	// Verify computes a SHA-256 checksum while copying, reads the destination back
+	// and fails if the two differ.
+	Verify bool
+	// Overwrite allows exporting over an existing image file.
+	Overwrite bool
+}
+
+// ImportImageOptions controls ImportImage.
+type ImportImageOptions struct {
+	ImageOptions
+	// Create creates the target volume. A zero Size is taken from the image, rounded
+	// up to a multiple of 128 KiB. When nil the volume must already exist and be at
+	// least as large as the image. A created volume is destroyed if the import fails.
+	Create *VolumeCreateOptions
+}
+
+// ImageResult reports a raw image copy.
+type ImageResult struct {
+	// Bytes is the logical size copied.
+	Bytes uint64 `json:"bytes"`
+	// SkippedBytes is the part of Bytes that was all zeros and left unwritten.
+	SkippedBytes uint64 `json:"skippedBytes"`
+	// Checksum is the hex SHA-256 of the copied data when Verify was set.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+func (o ImageOptions) blockSize() int {
+	if o.BlockSize <= 0 {
+		return defaultImageBlockSize
+	}
+	return o.BlockSize
+}
+
+func isZeroBlock(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// copyImage copies total bytes from src to dst, leaving all-zero blocks unwritten when
+// skipZeros is set so that dst stays sparse.
+func copyImage(ctx context.Context, dst io.WriterAt, src io.Reader, total uint64, skipZeros bool, opts ImageOptions) (*ImageResult, error) {
+	buf := make([]byte, opts.blockSize())
+	res := &ImageResult{}
+
+	var sum hash.Hash
+	if opts.Verify {
+		sum = sha256.New()
+	}
+
+	for res.Bytes < total {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		want := uint64(len(buf))
+		if total-res.Bytes < want {
+			want = total - res.Bytes
+		}
+
+		n, err := io.ReadFull(src, buf[:want])
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, fmt.Errorf("image_size_mismatch: source ended after %d of %d bytes", res.Bytes+uint64(n), total)
+			}
+			return nil, err
+		}
+
+		block := buf[:n]
+		if sum != nil {
+			sum.Write(block)
+		}
+
+		if skipZeros && isZeroBlock(block) {
+			res.SkippedBytes += uint64(n)
+		} else if _, err := dst.WriteAt(block, int64(res.Bytes)); err != nil {
+			return nil, err
+		}
+
+		res.Bytes += uint64(n)
+		if opts.Progress != nil {
+			opts.Progress(res.Bytes, total)
+		}
+	}
+
+	if sum != nil {
+		res.Checksum = hex.EncodeToString(sum.Sum(nil))
+	}
+
+	return res, nil
+}
+
+func checksumFile(ctx context.Context, path string, size uint64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	buf := make([]byte, defaultImageBlockSize)
+	var done uint64
+
+	for done < size {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		want := uint64(len(buf))
+		if size-done < want {
+			want = size - done
+		}
+
+		n, err := io.ReadFull(f, buf[:want])
+		sum.Write(buf[:n])
+		done += uint64(n)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+func verifyImage(ctx context.Context, path string, res *ImageResult) error {
+	got, err := checksumFile(ctx, path, res.Bytes)
+	if err != nil {
+		return fmt.Errorf("image_verify_failed: %w", err)
+	}
+	if got != res.Checksum {
+		return fmt.Errorf("image_checksum_mismatch: wrote %s, read back %s", res.Checksum, got)
+	}
+	return nil
+}
+
+// exportImage copies size bytes from the device at devicePath into a sparse image file.
+func exportImage(ctx context.Context, devicePath, imagePath string, size uint64, opts ImageOptions) (*ImageResult, error) {
+	src, err := os.Open(devicePath)
+	if err != nil {
+		return nil, fmt.Errorf("zvol_device_not_found: %w", err)
+	}
+	defer src.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !opts.Overwrite {
+		flags |= os.O_EXCL
+	}
+
+	dst, err := os.OpenFile(imagePath, flags, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("image_create_failed: %w", err)
+	}
+
+	res, err := copyImage(ctx, dst, src, size, true, opts)
+	if err == nil {
+		// Trailing zero blocks were skipped, so extend the file to its full size.
+		err = dst.Truncate(int64(size))
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(imagePath)
+		return nil, fmt.Errorf("image_export_failed: %w", err)
+	}
+
+	if opts.Verify {
+		if err := verifyImage(ctx, imagePath, res); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// importImage writes the image at imagePath onto the device at devicePath. Zero blocks
+// are only skipped when the device is known to read back as zeros.
+func importImage(ctx context.Context, imagePath, devicePath string, deviceSize uint64, zeroed bool, opts ImageOptions) (*ImageResult, error) {
+	src, err := os.Open(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("image_open_failed: %w", err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("image_open_failed: %w", err)
+	}
+
+	size := uint64(info.Size())
+	if size > deviceSize {
+		return nil, fmt.Errorf("image_larger_than_volume: image is %d bytes, volume %d", size, deviceSize)
+	}
+
+	dst, err := os.OpenFile(devicePath, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("zvol_device_not_found: %w", err)
+	}
+
+	res, err := copyImage(ctx, dst, src, size, zeroed, opts)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("image_import_failed: %w", err)
+	}
+
+	if opts.Verify {
+		if err := verifyImage(ctx, devicePath, res); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+func (z *zfs) volumeSize(ctx context.Context, name string) (uint64, error) {
+	props, err := z.GetProperties(ctx, []string{name}, []string{"volsize"}, GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	size := ParseSize(props[name]["volsize"].Value)
+	if size == 0 {
+		return 0, fmt.Errorf("not_a_volume: %s", name)
+	}
+
+	return size, nil
+}
+
+// ExportImage dumps the volume or volume snapshot name to a sparse raw image at
+// imagePath. The image is exactly volsize bytes long. Snapshot devices only exist
+// while the volume has snapdev=visible.
+func (z *zfs) ExportImage(ctx context.Context, name, imagePath string, opts ImageOptions) (*ImageResult, error) {
+	size, err := z.volumeSize(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return exportImage(ctx, filepath.Join(zvolRoot, name), imagePath, size, opts)
+}
+
+// ImportImage writes the raw image at imagePath into the volume name, creating it
+// first when opts.Create is set.
+func (z *zfs) ImportImage(ctx context.Context, imagePath, name string, opts ImportImageOptions) (*ImageResult, error) {
+	info, err := os.Stat(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("image_open_failed: %w", err)
+	}
+
+	if opts.Create == nil {
+		return z.importImageInto(ctx, imagePath, name, false, opts.ImageOptions)
+	}
+
+	create := *opts.Create
+	if create.Size == 0 {
+		create.Size = (uint64(info.Size()) + imageSizeAlign - 1) / imageSizeAlign * imageSizeAlign
+	}
+	if create.Size < uint64(info.Size()) {
+		return nil, fmt.Errorf("image_larger_than_volume: image is %d bytes, volume %d", info.Size(), create.Size)
+	}
+
+	if _, err := z.CreateVolumeWithOptions(ctx, name, create); err != nil {
+		return nil, fmt.Errorf("image_volume_create_failed: %w", err)
+	}
+
+	res, err := z.importImageInto(ctx, imagePath, name, true, opts.ImageOptions)
+	if err != nil {
+		// Do not leave a half-written volume behind, even if ctx was cancelled.
+		destroy := DestroyOptions{RemoveKey: create.Encryption != nil}
+		if destroyErr := z.DestroyWithOptions(context.WithoutCancel(ctx), name, destroy); destroyErr != nil {
+			return nil, fmt.Errorf("%w (removing created volume: %v)", err, destroyErr)
+		}
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (z *zfs) importImageInto(ctx context.Context, imagePath, name string, fresh bool, opts ImageOptions) (*ImageResult, error) {
+	size, err := z.volumeSize(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	vol := &Volume{z: z, Name: name}
+	device, err := vol.WaitForDevice(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return importImage(ctx, imagePath, device, size, fresh, opts)
+}
+
+func (v *Volume) ExportImage(ctx context.Context, imagePath string, opts ImageOptions) (*ImageResult, error) {
+	return v.z.ExportImage(ctx, v.Name, imagePath, opts)
+}
+
+func (v *Volume) ImportImage(ctx context.Context, imagePath string, opts ImageOptions) (*ImageResult, error) {
+	return v.z.ImportImage(ctx, imagePath, v.Name, ImportImageOptions{ImageOptions: opts})
+}
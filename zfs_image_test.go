@@ -0,0 +1,167 @@
+package gzfs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func writeTestDevice(t *testing.T, path string, size int, data map[int]byte) []byte {
+	t.Helper()
+
+	content := make([]byte, size)
+	for off, b := range data {
+		content[off] = b
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return content
+}
+
+func TestZFS_ExportImage(t *testing.T) {
+	root := t.TempDir()
+	oldRoot := zvolRoot
+	zvolRoot = filepath.Join(root, "zvol")
+	defer func() { zvolRoot = oldRoot }()
+
+	const size = 64 << 10
+	content := writeTestDevice(t, filepath.Join(zvolRoot, "tank/vol@snap"), size, map[int]byte{
+		10:         0xaa,
+		40<<10 + 1: 0xbb,
+	})
+
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+	mockRunner.AddCommand("zfs get -p volsize tank/vol@snap -j", datasetListJSON(
+		testDataset{name: "tank/vol@snap", props: map[string]string{"volsize": "65536|LOCAL"}},
+	), "", nil)
+
+	var calls int
+	image := filepath.Join(root, "disk.img")
+	res, err := client.ExportImage(context.Background(), "tank/vol@snap", image, ImageOptions{
+		BlockSize: 8 << 10,
+		Verify:    true,
+		Progress: func(done, total uint64) {
+			calls++
+			if total != size || done > total {
+				t.Errorf("Unexpected progress %d/%d", done, total)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("ExportImage returned error: %v", err)
+	}
+
+	if res.Bytes != size || res.SkippedBytes != size-16<<10 || res.Checksum == "" || calls != 8 {
+		t.Errorf("Unexpected result: %+v, progress calls %d", res, calls)
+	}
+
+	got, _ := os.ReadFile(image)
+	if !bytes.Equal(got, content) {
+		t.Error("Exported image differs from the device")
+	}
+
+	if _, err := client.ExportImage(context.Background(), "tank/vol@snap", image, ImageOptions{}); err == nil {
+		t.Error("Expected error exporting over an existing image")
+	}
+	if _, err := client.ExportImage(context.Background(), "tank/vol@snap", image, ImageOptions{Overwrite: true}); err != nil {
+		t.Errorf("Overwrite export returned error: %v", err)
+	}
+
+	short := filepath.Join(root, "short")
+	writeTestDevice(t, short, 1000, nil)
+	if _, err := exportImage(context.Background(), short, filepath.Join(root, "short.img"), 4096, ImageOptions{}); err == nil || !strings.Contains(err.Error(), "image_size_mismatch") {
+		t.Errorf("Expected size mismatch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "short.img")); !os.IsNotExist(err) {
+		t.Error("Partial image should be removed")
+	}
+}
+
+func TestZFS_ImportImage(t *testing.T) {
+	root := t.TempDir()
+	oldRoot, oldInterval := zvolRoot, zvolPollInterval
+	zvolRoot, zvolPollInterval = filepath.Join(root, "zvol"), 1
+	defer func() { zvolRoot, zvolPollInterval = oldRoot, oldInterval }()
+
+	image := filepath.Join(root, "disk.img")
+	content := writeTestDevice(t, image, 100<<10, map[int]byte{0: 1, 99 << 10: 2})
+
+	// The freshly created volume reads back as zeros.
+	device := filepath.Join(zvolRoot, "tank/vms/new")
+	writeTestDevice(t, device, 128<<10, nil)
+
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+	mockRunner.AddCommand("zfs create -p -V 131072 tank/vms/new", "", "", nil)
+	mockRunner.AddCommand("zfs list -o "+strings.Join(dsPropList, ",")+" -p tank/vms/new -j", datasetListJSON(
+		testDataset{name: "tank/vms/new", typ: DatasetTypeVolume},
+	), "", nil)
+	mockRunner.AddCommand("zfs get -p volsize tank/vms/new -j", datasetListJSON(
+		testDataset{name: "tank/vms/new", props: map[string]string{"volsize": "131072|LOCAL"}},
+	), "", nil)
+
+	res, err := client.ImportImage(context.Background(), image, "tank/vms/new", ImportImageOptions{
+		ImageOptions: ImageOptions{BlockSize: 4 << 10, Verify: true},
+		Create:       &VolumeCreateOptions{Parents: true},
+	})
+	if err != nil {
+		t.Fatalf("ImportImage returned error: %v", err)
+	}
+
+	if res.Bytes != 100<<10 || res.SkippedBytes != 92<<10 {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+
+	got, _ := os.ReadFile(device)
+	if !bytes.Equal(got[:len(content)], content) {
+		t.Error("Device content differs from the image")
+	}
+
+	calls := len(mockRunner.CallHistory)
+	if _, err := client.ImportImage(context.Background(), image, "tank/vms/tiny", ImportImageOptions{
+		Create: &VolumeCreateOptions{Size: 64 << 10},
+	}); err == nil || !strings.Contains(err.Error(), "image_larger_than_volume") {
+		t.Errorf("Expected explicit size check failure, got %v", err)
+	}
+	if len(mockRunner.CallHistory) != calls {
+		t.Error("No volume should be created when the image does not fit")
+	}
+
+	// zfs reports a smaller volume than requested, so the copy fails after create.
+	mockRunner.AddCommand("zfs create -V 131072 tank/vms/odd", "", "", nil)
+	mockRunner.AddCommand("zfs list -o "+strings.Join(dsPropList, ",")+" -p tank/vms/odd -j", datasetListJSON(
+		testDataset{name: "tank/vms/odd", typ: DatasetTypeVolume},
+	), "", nil)
+	mockRunner.AddCommand("zfs get -p volsize tank/vms/odd -j", datasetListJSON(
+		testDataset{name: "tank/vms/odd", props: map[string]string{"volsize": "65536|LOCAL"}},
+	), "", nil)
+	mockRunner.AddCommand("zfs destroy tank/vms/odd", "", "", nil)
+	writeTestDevice(t, filepath.Join(zvolRoot, "tank/vms/odd"), 64<<10, nil)
+
+	if _, err := client.ImportImage(context.Background(), image, "tank/vms/odd", ImportImageOptions{
+		Create: &VolumeCreateOptions{},
+	}); err == nil || !strings.Contains(err.Error(), "image_larger_than_volume") {
+		t.Errorf("Expected copy failure, got %v", err)
+	}
+	if last := mockRunner.GetLastCall(); last == nil || last.Cmd != "zfs destroy tank/vms/odd" {
+		t.Errorf("Expected the created volume to be destroyed, last call: %+v", last)
+	}
+
+	small := filepath.Join(root, "small")
+	writeTestDevice(t, small, 4096, nil)
+	if _, err := importImage(context.Background(), image, small, 4096, false, ImageOptions{}); err == nil || !strings.Contains(err.Error(), "image_larger_than_volume") {
+		t.Errorf("Expected size check failure, got %v", err)
+	}
+}
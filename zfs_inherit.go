@@ -0,0 +1,181 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// PropertyLink is one dataset on the path from a dataset to where a property is set.
+type PropertyLink struct {
+	Dataset string            `json:"dataset"`
+	Value   string            `json:"value"`
+	Source  ZFSPropertySource `json:"source"`
+}
+
+// PropertyExplanation answers why a property has its value on a dataset.
+type PropertyExplanation struct {
+	Dataset  string `json:"dataset"`
+	Property string `json:"property"`
+	Value    string `json:"value"`
+
+	// Origin is the source of the value on Dataset itself.
+	Origin PropertyOrigin `json:"origin"`
+
+	// SetOn is the dataset holding the value and SetAs how it was set there (local,
+	// received or temporary). Both are empty for default values.
+	SetOn string         `json:"setOn"`
+	SetAs PropertyOrigin `json:"setAs"`
+
+	// Chain lists Dataset followed by each ancestor up to SetOn, or up to the pool
+	// root when the value is a default.
+	Chain []PropertyLink `json:"chain"`
+}
+
+func inheritArgs(name, prop string, recursive, received bool) []string {
+	args := []string{"inherit"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	if received {
+		args = append(args, "-S")
+	}
+	return append(args, prop, name)
+}
+
+// Inherit clears prop on name so it is inherited from the parent again, or reverts
+// it to the received value when received is set.
+func (z *zfs) Inherit(ctx context.Context, name, prop string, recursive, received bool) error {
+	if name == "" {
+		return fmt.Errorf("dataset name is empty")
+	}
+	if prop == "" {
+		return fmt.Errorf("property name is empty")
+	}
+
+	if schema, ok := LookupPropertySchema(prop); ok {
+		if schema.ReadOnly {
+			return &PropertyError{Property: prop, Reason: "read-only"}
+		}
+		if !schema.Inheritable && !received {
+			return &PropertyError{Property: prop, Reason: "not inheritable"}
+		}
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, inheritArgs(name, prop, recursive, received)...); err != nil {
+		return fmt.Errorf("inherit_property_failed: %w", err)
+	}
+
+	return nil
+}
+
+func datasetAncestors(name string) []string {
+	if snap, _, ok := strings.Cut(name, "@"); ok {
+		return append([]string{name}, datasetAncestors(snap)...)
+	}
+	if fs, _, ok := strings.Cut(name, "#"); ok {
+		return append([]string{name}, datasetAncestors(fs)...)
+	}
+
+	var names []string
+	for n := name; n != ""; n = parentDatasetName(n) {
+		names = append(names, n)
+	}
+	return names
+}
+
+// ExplainProperty fetches prop on name and its ancestors in one zfs get and works out
+// where the effective value was set.
+func (z *zfs) ExplainProperty(ctx context.Context, name, prop string) (*PropertyExplanation, error) {
+	if name == "" {
+		return nil, fmt.Errorf("dataset name is empty")
+	}
+	if prop == "" {
+		return nil, fmt.Errorf("property name is empty")
+	}
+
+	var resp DatasetList
+
+	ancestors := datasetAncestors(name)
+
+	args := append([]string{"get"}, zfsArgs...)
+	args = append(args, prop)
+	args = append(args, ancestors...)
+
+	if err := z.cmd.RunJSON(ctx, &resp, args...); err != nil {
+		return nil, err
+	}
+
+	return explainProperty(resp, ancestors, prop)
+}
+
+func explainProperty(resp DatasetList, ancestors []string, prop string) (*PropertyExplanation, error) {
+	exp := &PropertyExplanation{Dataset: ancestors[0], Property: prop}
+
+	for i, name := range ancestors {
+		ds, ok := resp.Datasets[name]
+		if !ok || ds == nil {
+			return nil, fmt.Errorf("dataset %q not found in zfs get output", name)
+		}
+
+		p, ok := ds.Properties[prop]
+		if !ok {
+			return nil, fmt.Errorf("property %q not found on dataset %q", prop, name)
+		}
+
+		exp.Chain = append(exp.Chain, PropertyLink{Dataset: name, Value: p.Value, Source: p.Source})
+
+		origin := p.Source.Origin()
+		if i == 0 {
+			exp.Value = p.Value
+			exp.Origin = origin
+		}
+
+		switch origin {
+		case OriginInherited:
+			if p.Source.Data == "" {
+				return nil, fmt.Errorf("inherited property %q on %q has no source dataset", prop, name)
+			}
+			continue
+		case OriginDefault, OriginNone:
+			// Snapshots and bookmarks take most properties from their file system.
+			if i+1 < len(ancestors) && strings.ContainsAny(name, "@#") {
+				continue
+			}
+			return exp, nil
+		default:
+			exp.SetOn = name
+			exp.SetAs = origin
+			return exp, nil
+		}
+	}
+
+	if exp.Origin == OriginInherited {
+		return nil, fmt.Errorf("inherited property %q on %q: source %q not found among ancestors",
+			prop, exp.Dataset, exp.Chain[0].Source.Data)
+	}
+
+	return exp, nil
+}
+
+func (d *Dataset) Inherit(ctx context.Context, prop string, recursive, received bool) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.Inherit(ctx, d.Name, prop, recursive, received)
+}
+
+func (d *Dataset) ExplainProperty(ctx context.Context, prop string) (*PropertyExplanation, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.ExplainProperty(ctx, d.Name, prop)
+}
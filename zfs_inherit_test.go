@@ -0,0 +1,89 @@
+package gzfs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func TestZFS_Inherit(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	mockRunner.AddCommand("zfs inherit -r compression tank/app", "", "", nil)
+	if err := client.Inherit(ctx, "tank/app", "compression", true, false); err != nil {
+		t.Fatalf("Inherit returned error: %v", err)
+	}
+
+	mockRunner.AddCommand("zfs inherit -S quota tank/app", "", "", nil)
+	if err := client.Inherit(ctx, "tank/app", "quota", false, true); err != nil {
+		t.Fatalf("Inherit -S returned error: %v", err)
+	}
+
+	if err := client.Inherit(ctx, "tank/app", "quota", false, false); err == nil {
+		t.Error("Expected error inheriting a non-inheritable property")
+	}
+	if err := client.Inherit(ctx, "tank/app", "used", false, false); err == nil {
+		t.Error("Expected error inheriting a read-only property")
+	}
+}
+
+func TestZFS_ExplainProperty(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	mockRunner.AddCommand("zfs get -p compression tank/app/db tank/app tank -j", datasetListJSON(
+		testDataset{name: "tank/app/db", props: map[string]string{"compression": "off|INHERITED|tank/app"}},
+		testDataset{name: "tank/app", props: map[string]string{"compression": "off|RECEIVED"}},
+		testDataset{name: "tank", props: map[string]string{"compression": "lz4|LOCAL"}},
+	), "", nil)
+
+	exp, err := client.ExplainProperty(ctx, "tank/app/db", "compression")
+	if err != nil {
+		t.Fatalf("ExplainProperty returned error: %v", err)
+	}
+
+	if exp.Value != "off" || exp.Origin != OriginInherited || exp.SetOn != "tank/app" || exp.SetAs != OriginReceived {
+		t.Errorf("Unexpected explanation: %+v", exp)
+	}
+	if len(exp.Chain) != 2 || exp.Chain[1].Dataset != "tank/app" {
+		t.Errorf("Unexpected chain: %+v", exp.Chain)
+	}
+
+	mockRunner.AddCommand("zfs get -p atime tank/app@daily tank/app tank -j", datasetListJSON(
+		testDataset{name: "tank/app@daily", props: map[string]string{"atime": "on|NONE"}},
+		testDataset{name: "tank/app", props: map[string]string{"atime": "on|INHERITED|tank"}},
+		testDataset{name: "tank", props: map[string]string{"atime": "on|DEFAULT"}},
+	), "", nil)
+
+	exp, err = client.ExplainProperty(ctx, "tank/app@daily", "atime")
+	if err != nil {
+		t.Fatalf("ExplainProperty returned error: %v", err)
+	}
+
+	if exp.Origin != OriginNone || exp.SetOn != "" || len(exp.Chain) != 3 {
+		t.Errorf("Unexpected snapshot explanation: %+v", exp)
+	}
+}
+
+func TestExplainProperty_MissingAncestor(t *testing.T) {
+	var resp DatasetList
+	if _, err := explainProperty(resp, []string{"tank/app"}, "compression"); err == nil {
+		t.Error("Expected error when the dataset is missing from the output")
+	}
+}
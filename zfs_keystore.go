@@ -0,0 +1,432 @@
+package gzfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultKeyDir is where keys are stored when Options.KeyStore is nil.
+const DefaultKeyDir = "/etc/zfs/keys"
+
+// ErrKeyNotFound is returned by KeyStore.Load when no key is stored for a dataset.
+var ErrKeyNotFound = errors.New("key_not_found")
+
+// KeyStore keeps encryption key material for datasets.
+type KeyStore interface {
+	// Location returns the keylocation zfs should use for dataset: a file:// URI
+	// zfs reads itself, or "prompt" if the key must be passed on stdin.
+	Location(dataset string) string
+	// Store saves key for dataset, replacing any previous key.
+	Store(ctx context.Context, dataset string, key []byte) error
+	// Load returns the key stored for dataset, or ErrKeyNotFound.
+	Load(ctx context.Context, dataset string) ([]byte, error)
+	// Remove deletes the key stored for dataset. Removing a missing key is not an error.
+	Remove(ctx context.Context, dataset string) error
+}
+
+// ValidateKey checks key against the length rules zfs applies to each key format.
+func ValidateKey(format KeyFormat, key []byte) error {
+	switch format {
+	case KeyFormatPassphrase, "":
+		if len(key) < 8 || len(key) > 512 {
+			return fmt.Errorf("invalid_encryption_key_length")
+		}
+	case KeyFormatHex:
+		if len(key) != 64 {
+			return fmt.Errorf("invalid_encryption_key_length")
+		}
+		if _, err := hex.DecodeString(string(key)); err != nil {
+			return fmt.Errorf("invalid_hex_encryption_key")
+		}
+	case KeyFormatRaw:
+		if len(key) != 32 {
+			return fmt.Errorf("invalid_encryption_key_length")
+		}
+	default:
+		return fmt.Errorf("invalid_key_format: %q", format)
+	}
+
+	return nil
+}
+
+// DirectoryKeyStore keeps one key file per dataset in Dir, named after a UUID derived
+// from the dataset name. zfs reads the files itself through file:// key locations.
+type DirectoryKeyStore struct {
+	Dir string
+}
+
+func (s DirectoryKeyStore) path(dataset string) string {
+	return filepath.Join(s.Dir, GenerateDeterministicUUID(dataset))
+}
+
+func (s DirectoryKeyStore) Location(dataset string) string {
+	return "file://" + s.path(dataset)
+}
+
+func (s DirectoryKeyStore) Store(ctx context.Context, dataset string, key []byte) error {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return fmt.Errorf("failed_to_create_key_dir: %w", err)
+	}
+
+	tmp := s.path(dataset) + ".tmp"
+	if err := os.WriteFile(tmp, key, 0600); err != nil {
+		return fmt.Errorf("failed_to_write_encryption_key: %w", err)
+	}
+
+	if err := os.Rename(tmp, s.path(dataset)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed_to_write_encryption_key: %w", err)
+	}
+
+	return nil
+}
+
+func (s DirectoryKeyStore) Load(ctx context.Context, dataset string) ([]byte, error) {
+	key, err := os.ReadFile(s.path(dataset))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrKeyNotFound
+	}
+	return key, err
+}
+
+func (s DirectoryKeyStore) Remove(ctx context.Context, dataset string) error {
+	if err := os.Remove(s.path(dataset)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed_to_remove_encryption_key: %w", err)
+	}
+	return nil
+}
+
+// MemoryKeyStore keeps keys in process memory and hands them to zfs on stdin.
+type MemoryKeyStore struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: make(map[string][]byte)}
+}
+
+func (s *MemoryKeyStore) Location(dataset string) string {
+	return "prompt"
+}
+
+func (s *MemoryKeyStore) Store(ctx context.Context, dataset string, key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keys == nil {
+		s.keys = make(map[string][]byte)
+	}
+	s.keys[dataset] = bytes.Clone(key)
+
+	return nil
+}
+
+func (s *MemoryKeyStore) Load(ctx context.Context, dataset string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[dataset]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return bytes.Clone(key), nil
+}
+
+func (s *MemoryKeyStore) Remove(ctx context.Context, dataset string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, dataset)
+	return nil
+}
+
+// CommandKeyStore delegates to an external program such as a vault CLI or HSM
+// wrapper. It is run as `Bin Args... store|load|remove <dataset>`; store receives the
+// key on stdin and load prints it on stdout. A load that prints nothing is treated
+// as a missing key.
+type CommandKeyStore struct {
+	Bin    string
+	Args   []string
+	Runner Runner
+}
+
+func (s CommandKeyStore) run(ctx context.Context, stdin io.Reader, op, dataset string) ([]byte, error) {
+	cmd := Cmd{Bin: s.Bin, Runner: s.Runner}
+
+	args := append(append([]string{}, s.Args...), op, dataset)
+	out, _, err := cmd.RunBytes(ctx, stdin, args...)
+	return out, err
+}
+
+func (s CommandKeyStore) Location(dataset string) string {
+	return "prompt"
+}
+
+func (s CommandKeyStore) Store(ctx context.Context, dataset string, key []byte) error {
+	if _, err := s.run(ctx, bytes.NewReader(key), "store", dataset); err != nil {
+		return fmt.Errorf("key_store_command_failed: %w", err)
+	}
+	return nil
+}
+
+func (s CommandKeyStore) Load(ctx context.Context, dataset string) ([]byte, error) {
+	out, err := s.run(ctx, nil, "load", dataset)
+	if err != nil {
+		return nil, fmt.Errorf("key_store_command_failed: %w", err)
+	}
+
+	key := bytes.TrimRight(out, "\r\n")
+	if len(key) == 0 {
+		return nil, ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+func (s CommandKeyStore) Remove(ctx context.Context, dataset string) error {
+	if _, err := s.run(ctx, nil, "remove", dataset); err != nil {
+		return fmt.Errorf("key_store_command_failed: %w", err)
+	}
+	return nil
+}
+
+// PromptKeyStore stores nothing. Every Load reads one line from In, which is usually
+// os.Stdin or a terminal, after writing a prompt naming the dataset to Out if set.
+type PromptKeyStore struct {
+	In  io.Reader
+	Out io.Writer
+
+	once   sync.Once
+	reader *bufio.Reader
+}
+
+func (s *PromptKeyStore) Location(dataset string) string {
+	return "prompt"
+}
+
+func (s *PromptKeyStore) Store(ctx context.Context, dataset string, key []byte) error {
+	return nil
+}
+
+func (s *PromptKeyStore) Load(ctx context.Context, dataset string) ([]byte, error) {
+	s.once.Do(func() {
+		in := s.In
+		if in == nil {
+			in = os.Stdin
+		}
+		s.reader = bufio.NewReader(in)
+	})
+
+	if s.Out != nil {
+		fmt.Fprintf(s.Out, "Enter key for %s: ", dataset)
+	}
+
+	line, err := s.reader.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, err
+	}
+
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+func (s *PromptKeyStore) Remove(ctx context.Context, dataset string) error {
+	return nil
+}
+
+func (z *zfs) keyStore() KeyStore {
+	if z.keys != nil {
+		return z.keys
+	}
+	return DirectoryKeyStore{Dir: DefaultKeyDir}
+}
+
+// directoryKeyStore returns the configured store if it is a DirectoryKeyStore.
+func (z *zfs) directoryKeyStore() (DirectoryKeyStore, bool) {
+	switch s := z.keyStore().(type) {
+	case DirectoryKeyStore:
+		return s, true
+	case *DirectoryKeyStore:
+		return *s, true
+	default:
+		return DirectoryKeyStore{}, false
+	}
+}
+
+// legacyKeyFile returns the file location points to when it lies in the directory
+// store but is not named after dataset.
+func legacyKeyFile(store DirectoryKeyStore, dataset, location string) string {
+	p, ok := strings.CutPrefix(strings.TrimSpace(location), "file://")
+	if !ok || filepath.Dir(p) != filepath.Clean(store.Dir) || p == store.path(dataset) {
+		return ""
+	}
+	return p
+}
+
+// legacyKeyPath returns the key file of name when its keylocation points into the
+// directory store under a different name. Keys written before the store existed
+// were named after a UUID of the dataset name and the key itself, so they can only
+// be found through keylocation; zfs load-key reads them from there as well.
+func (z *zfs) legacyKeyPath(ctx context.Context, name string) (string, error) {
+	store, ok := z.directoryKeyStore()
+	if !ok {
+		return "", nil
+	}
+
+	props, err := z.GetProperties(ctx, []string{name}, []string{"keylocation"}, GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	return legacyKeyFile(store, name, props[name]["keylocation"].Value), nil
+}
+
+// encryptionRootKeyLocations returns the keylocation of every encryption root at or
+// below name.
+func (z *zfs) encryptionRootKeyLocations(ctx context.Context, name string) (map[string]string, error) {
+	props, err := z.GetProperties(ctx, []string{name}, []string{"encryptionroot", "keylocation"}, GetOptions{
+		Recursive: true,
+		Types:     []DatasetType{DatasetTypeFilesystem, DatasetTypeVolume},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	roots := make(map[string]string)
+	for ds, p := range props {
+		if ParseString(p["encryptionroot"].Value) == ds {
+			roots[ds] = strings.TrimSpace(p["keylocation"].Value)
+		}
+	}
+
+	return roots, nil
+}
+
+// moveStoredKeys re-stores the keys of the encryption roots that were renamed from
+// oldName to newName under their new names. Only keys the store manages are moved;
+// keylocation is repointed when the store uses per-dataset locations.
+func (z *zfs) moveStoredKeys(ctx context.Context, oldName, newName string, roots map[string]string) error {
+	store := z.keyStore()
+	if _, ok := store.(*PromptKeyStore); ok {
+		return nil
+	}
+	dir, isDir := z.directoryKeyStore()
+
+	names := make([]string, 0, len(roots))
+	for name := range roots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		location := roots[name]
+		renamed := newName + strings.TrimPrefix(name, oldName)
+
+		var legacy string
+		if location != store.Location(name) {
+			if !isDir {
+				continue
+			}
+			if legacy = legacyKeyFile(dir, name, location); legacy == "" {
+				continue
+			}
+		}
+
+		var key []byte
+		var err error
+		if legacy != "" {
+			key, err = os.ReadFile(legacy)
+		} else {
+			key, err = store.Load(ctx, name)
+		}
+		if errors.Is(err, ErrKeyNotFound) || errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("load_stored_key_failed: %s: %w", name, err)
+		}
+
+		if err := store.Store(ctx, renamed, key); err != nil {
+			return err
+		}
+
+		if loc := store.Location(renamed); loc != location {
+			if _, _, err := z.cmd.RunBytes(ctx, nil, "set", "keylocation="+loc, renamed); err != nil {
+				return fmt.Errorf("set_keylocation_failed: %s: %w", renamed, err)
+			}
+		}
+
+		if err := z.removeStoredKey(ctx, name, legacy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeStoredKey deletes the key of name from the KeyStore and the legacy key file
+// resolved before the dataset was destroyed, if any.
+func (z *zfs) removeStoredKey(ctx context.Context, name, legacy string) error {
+	if err := z.keyStore().Remove(ctx, name); err != nil {
+		return err
+	}
+
+	if legacy != "" {
+		if err := os.Remove(legacy); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed_to_remove_encryption_key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// keyInput returns the stdin for a zfs command that needs a key, which is only the
+// case when keylocation is prompt. Raw keys are passed as is, the others as a line.
+func keyInput(location string, format KeyFormat, key []byte) io.Reader {
+	if location != "prompt" {
+		return nil
+	}
+	if format == KeyFormatRaw {
+		return bytes.NewReader(key)
+	}
+	return bytes.NewReader(append(bytes.Clone(key), '\n'))
+}
+
+// storedKeyInput returns the stdin for loading the key of name from the configured
+// KeyStore, or nil if zfs can find the key by itself.
+func (z *zfs) storedKeyInput(ctx context.Context, name string) (io.Reader, error) {
+	if z.keys == nil {
+		return nil, nil
+	}
+
+	props, err := z.GetProperties(ctx, []string{name}, []string{"keylocation", "keyformat"}, GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	location := strings.TrimSpace(props[name]["keylocation"].Value)
+	if location != "prompt" {
+		return nil, nil
+	}
+
+	key, err := z.keys.Load(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("load_stored_key_failed: %w", err)
+	}
+
+	return keyInput(location, KeyFormat(strings.TrimSpace(props[name]["keyformat"].Value)), key), nil
+}
@@ -0,0 +1,325 @@
+package gzfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+// stdinRunner records what each command received on stdin before handing the call
+// to the mock runner.
+type stdinRunner struct {
+	*testutil.MockRunner
+	stdin map[string]string
+}
+
+func newStdinRunner() *stdinRunner {
+	return &stdinRunner{MockRunner: testutil.NewMockRunner(), stdin: map[string]string{}}
+}
+
+func (r *stdinRunner) Run(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, name string, args ...string) error {
+	if stdin != nil {
+		b, _ := io.ReadAll(stdin)
+		r.stdin[name+" "+strings.Join(args, " ")] = string(b)
+	}
+	return r.MockRunner.Run(ctx, stdin, stdout, stderr, name, args...)
+}
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		format KeyFormat
+		key    string
+		valid  bool
+	}{
+		{KeyFormatPassphrase, "correct horse", true},
+		{KeyFormatPassphrase, "short", false},
+		{KeyFormatHex, strings.Repeat("ab", 32), true},
+		{KeyFormatHex, strings.Repeat("zz", 32), false},
+		{KeyFormatHex, "abcd", false},
+		{KeyFormatRaw, strings.Repeat("\x01", 32), true},
+		{KeyFormatRaw, strings.Repeat("\x01", 31), false},
+		{"pem", "whatever-key", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateKey(tt.format, []byte(tt.key)); (err == nil) != tt.valid {
+			t.Errorf("ValidateKey(%s, %q) error = %v, want valid %v", tt.format, tt.key, err, tt.valid)
+		}
+	}
+}
+
+func TestDirectoryKeyStore(t *testing.T) {
+	ctx := context.Background()
+	store := DirectoryKeyStore{Dir: t.TempDir() + "/keys"}
+
+	if loc := store.Location("tank/enc"); !strings.HasPrefix(loc, "file://"+store.Dir+"/") {
+		t.Errorf("Unexpected location: %s", loc)
+	}
+
+	if _, err := store.Load(ctx, "tank/enc"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	if err := store.Store(ctx, "tank/enc", []byte("secret-passphrase")); err != nil {
+		t.Fatalf("Store returned error: %v", err)
+	}
+
+	info, err := os.Stat(strings.TrimPrefix(store.Location("tank/enc"), "file://"))
+	if err != nil {
+		t.Fatalf("key file missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Unexpected key file mode: %v", info.Mode().Perm())
+	}
+
+	key, err := store.Load(ctx, "tank/enc")
+	if err != nil || string(key) != "secret-passphrase" {
+		t.Errorf("Load = %q, %v", key, err)
+	}
+
+	if err := store.Remove(ctx, "tank/enc"); err != nil {
+		t.Fatalf("Remove returned error: %v", err)
+	}
+	if err := store.Remove(ctx, "tank/enc"); err != nil {
+		t.Errorf("Removing a missing key should not fail: %v", err)
+	}
+}
+
+func TestMemoryAndPromptKeyStores(t *testing.T) {
+	ctx := context.Background()
+
+	mem := NewMemoryKeyStore()
+	key := []byte("secret-passphrase")
+	if err := mem.Store(ctx, "tank/enc", key); err != nil {
+		t.Fatalf("Store returned error: %v", err)
+	}
+	key[0] = 'X'
+	if got, err := mem.Load(ctx, "tank/enc"); err != nil || string(got) != "secret-passphrase" {
+		t.Errorf("Load = %q, %v", got, err)
+	}
+	mem.Remove(ctx, "tank/enc")
+	if _, err := mem.Load(ctx, "tank/enc"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	var prompts bytes.Buffer
+	prompt := &PromptKeyStore{In: strings.NewReader("first\r\nsecond"), Out: &prompts}
+	for _, want := range []string{"first", "second"} {
+		if got, err := prompt.Load(ctx, "tank/enc"); err != nil || string(got) != want {
+			t.Errorf("Load = %q, %v, want %q", got, err, want)
+		}
+	}
+	if _, err := prompt.Load(ctx, "tank/enc"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound at EOF, got %v", err)
+	}
+	if !strings.Contains(prompts.String(), "Enter key for tank/enc") {
+		t.Errorf("Unexpected prompt output: %q", prompts.String())
+	}
+}
+
+func TestCommandKeyStore(t *testing.T) {
+	ctx := context.Background()
+	runner := newStdinRunner()
+	store := CommandKeyStore{Bin: "vault-zfs", Args: []string{"--mount", "zfs"}, Runner: runner}
+
+	runner.AddCommand("vault-zfs --mount zfs store tank/enc", "", "", nil)
+	runner.AddCommand("vault-zfs --mount zfs load tank/enc", "secret-passphrase\n", "", nil)
+	runner.AddCommand("vault-zfs --mount zfs load tank/none", "", "", nil)
+
+	if err := store.Store(ctx, "tank/enc", []byte("secret-passphrase")); err != nil {
+		t.Fatalf("Store returned error: %v", err)
+	}
+	if got := runner.stdin["vault-zfs --mount zfs store tank/enc"]; got != "secret-passphrase" {
+		t.Errorf("Store sent %q on stdin", got)
+	}
+
+	if key, err := store.Load(ctx, "tank/enc"); err != nil || string(key) != "secret-passphrase" {
+		t.Errorf("Load = %q, %v", key, err)
+	}
+	if _, err := store.Load(ctx, "tank/none"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestZFS_KeyStoreCreateLoadDestroy(t *testing.T) {
+	ctx := context.Background()
+	runner := newStdinRunner()
+	store := NewMemoryKeyStore()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: runner,
+		},
+		keys: store,
+	}
+
+	createCmd := "zfs create -o encryption=on -o keyformat=passphrase -o keylocation=prompt tank/enc"
+	runner.AddCommand(createCmd, "", "", nil)
+	runner.AddCommand("zfs list -o "+strings.Join(dsPropList, ",")+" -p tank/enc -j", datasetListJSON(
+		testDataset{name: "tank/enc", typ: DatasetTypeFilesystem},
+	), "", nil)
+
+	if _, err := client.CreateFilesystemWithOptions(ctx, "tank/enc", FilesystemCreateOptions{
+		Encryption: &EncryptionOptions{Key: "secret-passphrase"},
+	}); err != nil {
+		t.Fatalf("CreateFilesystemWithOptions returned error: %v", err)
+	}
+	if got := runner.stdin[createCmd]; got != "secret-passphrase\n" {
+		t.Errorf("create received %q on stdin", got)
+	}
+	if key, _ := store.Load(ctx, "tank/enc"); string(key) != "secret-passphrase" {
+		t.Errorf("key not stored, got %q", key)
+	}
+
+	runner.AddCommand("zfs get -p keylocation,keyformat tank/enc -j", datasetListJSON(
+		testDataset{name: "tank/enc", props: map[string]string{
+			"keylocation": "prompt|LOCAL",
+			"keyformat":   "passphrase|NONE",
+		}},
+	), "", nil)
+	runner.AddCommand("zfs load-key tank/enc", "", "", nil)
+
+	if err := client.LoadKey(ctx, "tank/enc", false); err != nil {
+		t.Fatalf("LoadKey returned error: %v", err)
+	}
+	if got := runner.stdin["zfs load-key tank/enc"]; got != "secret-passphrase\n" {
+		t.Errorf("load-key received %q on stdin", got)
+	}
+
+	runner.AddCommand("zfs destroy tank/enc", "", "", nil)
+	if err := client.DestroyWithOptions(ctx, "tank/enc", DestroyOptions{RemoveKey: true}); err != nil {
+		t.Fatalf("DestroyWithOptions returned error: %v", err)
+	}
+	if _, err := store.Load(ctx, "tank/enc"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected key removed after destroy, got %v", err)
+	}
+}
+
+func TestZFS_DestroyRemovesLegacyKey(t *testing.T) {
+	ctx := context.Background()
+	runner := testutil.NewMockRunner()
+	store := DirectoryKeyStore{Dir: t.TempDir()}
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: runner,
+		},
+		keys: store,
+	}
+
+	// Written before keys were named after the dataset alone.
+	legacy := filepath.Join(store.Dir, GenerateDeterministicUUID("tank/old-secret-passphrase-0123456789abcdef"))
+	if err := os.WriteFile(legacy, []byte("secret-passphrase-0123456789abcdef"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	runner.AddCommand("zfs get -p keylocation tank/old -j", datasetListJSON(
+		testDataset{name: "tank/old", props: map[string]string{"keylocation": "file://" + legacy + "|LOCAL"}},
+	), "", nil)
+	runner.AddCommand("zfs destroy tank/old", "", "", nil)
+
+	if err := client.DestroyWithOptions(ctx, "tank/old", DestroyOptions{RemoveKey: true}); err != nil {
+		t.Fatalf("DestroyWithOptions returned error: %v", err)
+	}
+	if _, err := os.Stat(legacy); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected legacy key file removed, got %v", err)
+	}
+}
+
+func TestZFS_RenameMovesStoredKeys(t *testing.T) {
+	ctx := context.Background()
+	runner := newStdinRunner()
+	store := NewMemoryKeyStore()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: runner}, keys: store}
+
+	_ = store.Store(ctx, "tank/enc", []byte("parent-passphrase"))
+	_ = store.Store(ctx, "tank/enc/db", []byte("child-passphrase"))
+
+	listCmd := func(name string) string {
+		return "zfs list -o " + strings.Join(dsPropList, ",") + " -p " + name + " -j"
+	}
+	runner.AddCommand(listCmd("tank/enc"), datasetListJSON(testDataset{name: "tank/enc", typ: DatasetTypeFilesystem}), "", nil)
+	runner.AddCommand(listCmd("tank/vault"), datasetListJSON(testDataset{name: "tank/vault", typ: DatasetTypeFilesystem}), "", nil)
+	runner.AddCommand("zfs get -p -r -t fs,vol encryptionroot,keylocation tank/enc -j", datasetListJSON(
+		testDataset{name: "tank/enc", props: map[string]string{"encryptionroot": "tank/enc|NONE", "keylocation": "prompt|LOCAL"}},
+		testDataset{name: "tank/enc/db", props: map[string]string{"encryptionroot": "tank/enc/db|NONE", "keylocation": "prompt|LOCAL"}},
+		testDataset{name: "tank/enc/web", props: map[string]string{"encryptionroot": "tank/enc|NONE", "keylocation": "none|DEFAULT"}},
+	), "", nil)
+	runner.AddCommand("zfs rename tank/enc tank/vault", "", "", nil)
+
+	if _, err := client.Rename(ctx, "tank/enc", "tank/vault", false); err != nil {
+		t.Fatalf("Rename returned error: %v", err)
+	}
+
+	for old, renamed := range map[string]string{"tank/enc": "tank/vault", "tank/enc/db": "tank/vault/db"} {
+		if _, err := store.Load(ctx, old); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("Expected key of %s removed, got %v", old, err)
+		}
+		if _, err := store.Load(ctx, renamed); err != nil {
+			t.Errorf("Expected key stored for %s, got %v", renamed, err)
+		}
+	}
+
+	runner.AddCommand("zfs get -p keylocation,keyformat tank/vault/db -j", datasetListJSON(
+		testDataset{name: "tank/vault/db", props: map[string]string{
+			"keylocation": "prompt|LOCAL",
+			"keyformat":   "passphrase|NONE",
+		}},
+	), "", nil)
+	runner.AddCommand("zfs load-key tank/vault/db", "", "", nil)
+
+	if err := client.LoadKey(ctx, "tank/vault/db", false); err != nil {
+		t.Fatalf("LoadKey after rename returned error: %v", err)
+	}
+	if got := runner.stdin["zfs load-key tank/vault/db"]; got != "child-passphrase\n" {
+		t.Errorf("load-key received %q on stdin", got)
+	}
+}
+
+func TestZFS_RenameMovesKeyFile(t *testing.T) {
+	ctx := context.Background()
+	runner := testutil.NewMockRunner()
+	store := DirectoryKeyStore{Dir: t.TempDir()}
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: runner}, keys: store}
+
+	legacy := filepath.Join(store.Dir, GenerateDeterministicUUID("tank/old-secret-passphrase-0123456789abcdef"))
+	if err := os.WriteFile(legacy, []byte("secret-passphrase-0123456789abcdef"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	runner.AddCommand("zfs list -o "+strings.Join(dsPropList, ",")+" -p tank/old -j", datasetListJSON(testDataset{name: "tank/old", typ: DatasetTypeVolume}), "", nil)
+	runner.AddCommand("zfs list -o "+strings.Join(dsPropList, ",")+" -p tank/new -j", datasetListJSON(testDataset{name: "tank/new", typ: DatasetTypeVolume}), "", nil)
+	runner.AddCommand("zfs get -p -r -t fs,vol encryptionroot,keylocation tank/old -j", datasetListJSON(
+		testDataset{name: "tank/old", props: map[string]string{"encryptionroot": "tank/old|NONE", "keylocation": "file://" + legacy + "|LOCAL"}},
+	), "", nil)
+	runner.AddCommand("zfs rename tank/old tank/new", "", "", nil)
+	runner.AddCommand("zfs set keylocation="+store.Location("tank/new")+" tank/new", "", "", nil)
+
+	if _, err := client.Rename(ctx, "tank/old", "tank/new", false); err != nil {
+		t.Fatalf("Rename returned error: %v", err)
+	}
+
+	if key, err := store.Load(ctx, "tank/new"); err != nil || string(key) != "secret-passphrase-0123456789abcdef" {
+		t.Errorf("Expected key file for tank/new, got %q, %v", key, err)
+	}
+	if _, err := os.Stat(legacy); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected legacy key file removed, got %v", err)
+	}
+
+	var repointed bool
+	for _, call := range runner.CallHistory {
+		repointed = repointed || call.Cmd == "zfs set keylocation="+store.Location("tank/new")+" tank/new"
+	}
+	if !repointed {
+		t.Error("Expected keylocation to point at the moved key file")
+	}
+}
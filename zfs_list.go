@@ -0,0 +1,247 @@
+package gzfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+)
+
+// ListOptions controls zfs list. The zero value lists the given dataset (or every
+// dataset when no name is given) without recursion.
+type ListOptions struct {
+	// Type restricts the listing to one dataset type (-t). Empty lists the zfs default.
+	Type DatasetType
+	// Recursive lists all descendants (-r).
+	Recursive bool
+	// Depth limits recursion to the given depth (-d). Zero means unlimited.
+	Depth int
+	// SortAsc and SortDesc sort by the given properties (-s and -S), in order.
+	SortAsc  []string
+	SortDesc []string
+	// Properties selects which properties to fetch: named sets ("minimal", "space",
+	// "encryption", "all"), property names, or a mix. Empty uses the default list.
+	Properties []string
+}
+
+func (z *zfs) listOptionArgs(name string, opts ListOptions) []string {
+	props := resolvePropertyList(opts.Properties)
+
+	args := append(
+		[]string{"list", "-o", strings.Join(props, ",")},
+		zfsArgs...,
+	)
+
+	if opts.Recursive {
+		args = append(args, "-r")
+	}
+
+	if opts.Depth > 0 {
+		args = append(args, "-d", strconv.Itoa(opts.Depth))
+	}
+
+	if opts.Type != "" {
+		args = append(args, "-t", toZfsType(opts.Type))
+	}
+
+	for _, prop := range opts.SortAsc {
+		args = append(args, "-s", prop)
+	}
+
+	for _, prop := range opts.SortDesc {
+		args = append(args, "-S", prop)
+	}
+
+	if name != "" {
+		args = append(args, name)
+	}
+
+	return args
+}
+
+func validateListOptions(opts ListOptions) error {
+	if opts.Depth < 0 {
+		return fmt.Errorf("invalid_list_depth: %d", opts.Depth)
+	}
+
+	for _, prop := range append(append([]string{}, opts.SortAsc...), opts.SortDesc...) {
+		if prop == "" || strings.ContainsAny(prop, ", \t") {
+			return fmt.Errorf("invalid_sort_property: %q", prop)
+		}
+	}
+
+	for _, prop := range opts.Properties {
+		if prop == "" || strings.ContainsAny(prop, ", \t") {
+			return fmt.Errorf("invalid_property_selection: %q", prop)
+		}
+	}
+
+	return nil
+}
+
+// decodeDatasetStream reads zfs list -j output from r token by token and calls fn for
+// each dataset in the order zfs emitted it, without holding the whole listing in
+// memory. It reports whether fn stopped the iteration early.
+func decodeDatasetStream(r io.Reader, fn func(*Dataset) bool) (bool, error) {
+	dec := json.NewDecoder(r)
+
+	expectDelim := func(want json.Delim) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if d, ok := tok.(json.Delim); !ok || d != want {
+			return fmt.Errorf("expected %q, got %v", want, tok)
+		}
+		return nil
+	}
+
+	if err := expectDelim('{'); err != nil {
+		return false, err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return false, err
+		}
+
+		if key, _ := tok.(string); key != "datasets" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		if err := expectDelim('{'); err != nil {
+			return false, err
+		}
+
+		for dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return false, err
+			}
+
+			var d Dataset
+			if err := dec.Decode(&d); err != nil {
+				return false, err
+			}
+
+			if !fn(&d) {
+				return true, nil
+			}
+		}
+
+		if err := expectDelim('}'); err != nil {
+			return false, err
+		}
+	}
+
+	return false, expectDelim('}')
+}
+
+func (z *zfs) listOrdered(ctx context.Context, args ...string) ([]*Dataset, error) {
+	args = append(args, "-j")
+	out, _, err := z.cmd.RunBytes(ctx, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	datasets := make([]*Dataset, 0)
+	_, err = decodeDatasetStream(bytes.NewReader(out), func(d *Dataset) bool {
+		z.hydrateDataset(d)
+		datasets = append(datasets, d)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON from %s: %w", z.cmd.Bin, err)
+	}
+
+	return datasets, nil
+}
+
+// ListWithOptions lists datasets in the order zfs returns them, honouring the sort
+// and depth settings in opts.
+func (z *zfs) ListWithOptions(ctx context.Context, name string, opts ListOptions) ([]*Dataset, error) {
+	if err := validateListOptions(opts); err != nil {
+		return nil, err
+	}
+
+	return z.listOrdered(ctx, z.listOptionArgs(name, opts)...)
+}
+
+// Iter streams datasets from zfs list as they are decoded. Breaking out of the loop
+// stops the underlying command.
+func (z *zfs) Iter(ctx context.Context, name string, opts ListOptions) iter.Seq2[*Dataset, error] {
+	return func(yield func(*Dataset, error) bool) {
+		if err := validateListOptions(opts); err != nil {
+			yield(nil, err)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		args := append(z.listOptionArgs(name, opts), "-j")
+
+		pr, pw := io.Pipe()
+		runErrCh := make(chan error, 1)
+
+		go func() {
+			var stderr bytes.Buffer
+			err := z.cmd.RunStream(ctx, nil, pw, &stderr, args...)
+			pw.CloseWithError(err)
+			runErrCh <- err
+		}()
+
+		stopped, decodeErr := decodeDatasetStream(pr, func(d *Dataset) bool {
+			z.hydrateDataset(d)
+			return yield(d, nil)
+		})
+
+		if stopped {
+			cancel()
+			_ = pr.Close()
+			<-runErrCh
+			return
+		}
+
+		// Drain anything left so the command can exit.
+		_, _ = io.Copy(io.Discard, pr)
+
+		if runErr := <-runErrCh; runErr != nil {
+			yield(nil, runErr)
+			return
+		}
+
+		if decodeErr != nil {
+			yield(nil, fmt.Errorf("failed to decode JSON from %s: %w", z.cmd.Bin, decodeErr))
+		}
+	}
+}
+
+// GetWithOptions is Get with an explicit property selection and listing options.
+// It returns nil if name is not part of the listing.
+func (z *zfs) GetWithOptions(ctx context.Context, name string, opts ListOptions) (*Dataset, error) {
+	if name == "" {
+		return nil, fmt.Errorf("dataset name is empty")
+	}
+
+	datasets, err := z.ListWithOptions(ctx, name, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range datasets {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,252 @@
+package gzfs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+const orderedListJSON = `{
+  "output_version": {"command": "zfs list", "vers_major": 0, "vers_minor": 1},
+  "datasets": {
+    "tank/zeta": {"name": "tank/zeta", "type": "FILESYSTEM", "pool": "tank", "createtxg": "9",
+      "properties": {"used": {"value": "300", "source": {"type": "none", "data": ""}}}},
+    "tank/alpha": {"name": "tank/alpha", "type": "FILESYSTEM", "pool": "tank", "createtxg": "4",
+      "properties": {"used": {"value": "200", "source": {"type": "none", "data": ""}}}},
+    "tank/mid": {"name": "tank/mid", "type": "FILESYSTEM", "pool": "tank", "createtxg": "7",
+      "properties": {"used": {"value": "100", "source": {"type": "none", "data": ""}}}}
+  }
+}`
+
+func TestZFS_ListOptionArgs(t *testing.T) {
+	client := &zfs{cmd: Cmd{Bin: "zfs"}}
+
+	args := client.listOptionArgs("tank", ListOptions{
+		Type:     DatasetTypeSnapshot,
+		Depth:    2,
+		SortAsc:  []string{"createtxg"},
+		SortDesc: []string{"used", "name"},
+	})
+
+	want := "list -o " + strings.Join(dsPropList, ",") + " -p -d 2 -t snap -s createtxg -S used -S name tank"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+}
+
+func TestValidateListOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        ListOptions
+		expectError bool
+	}{
+		{"zero value", ListOptions{}, false},
+		{"depth and sort", ListOptions{Depth: 1, SortAsc: []string{"name"}}, false},
+		{"negative depth", ListOptions{Depth: -1}, true},
+		{"empty sort property", ListOptions{SortAsc: []string{""}}, true},
+		{"injected sort property", ListOptions{SortDesc: []string{"used,name"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateListOptions(tt.opts)
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestZFS_ListWithOptionsPreservesOrder(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	opts := ListOptions{Recursive: true, SortDesc: []string{"createtxg"}}
+	mockRunner.AddCommand("zfs "+strings.Join(client.listOptionArgs("tank", opts), " ")+" -j", orderedListJSON, "", nil)
+
+	for i := 0; i < 5; i++ {
+		datasets, err := client.ListWithOptions(ctx, "tank", opts)
+		if err != nil {
+			t.Fatalf("ListWithOptions returned error: %v", err)
+		}
+
+		var names []string
+		for _, d := range datasets {
+			if d.z == nil {
+				t.Error("Dataset should have zfs client reference")
+			}
+			names = append(names, d.Name)
+		}
+
+		if got, want := strings.Join(names, ","), "tank/zeta,tank/alpha,tank/mid"; got != want {
+			t.Fatalf("order = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestZFS_Iter(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	mockRunner.AddCommand("zfs "+strings.Join(client.listOptionArgs("tank", ListOptions{Recursive: true}), " ")+" -j", orderedListJSON, "", nil)
+
+	var names []string
+	var used []uint64
+	for ds, err := range client.Iter(ctx, "tank", ListOptions{Recursive: true}) {
+		if err != nil {
+			t.Fatalf("Iter returned error: %v", err)
+		}
+		names = append(names, ds.Name)
+		used = append(used, ds.Used)
+	}
+
+	if got, want := strings.Join(names, ","), "tank/zeta,tank/alpha,tank/mid"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+	if len(used) != 3 || used[0] != 300 {
+		t.Errorf("datasets not hydrated: %v", used)
+	}
+
+	var first []string
+	for ds, err := range client.Iter(ctx, "tank", ListOptions{Recursive: true}) {
+		if err != nil {
+			t.Fatalf("Iter returned error: %v", err)
+		}
+		first = append(first, ds.Name)
+		break
+	}
+	if len(first) != 1 || first[0] != "tank/zeta" {
+		t.Errorf("early stop yielded %v", first)
+	}
+}
+
+func TestZFS_IterErrors(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	var errs int
+	for _, err := range client.Iter(ctx, "tank/missing", ListOptions{}) {
+		if err == nil {
+			t.Fatal("Expected error for failing command")
+		}
+		errs++
+	}
+	if errs != 1 {
+		t.Errorf("Expected exactly one error, got %d", errs)
+	}
+
+	mockRunner.AddCommand("zfs "+strings.Join(client.listOptionArgs("tank/bad", ListOptions{}), " ")+" -j", `{"datasets": {"tank/bad": `, "", nil)
+
+	errs = 0
+	for _, err := range client.Iter(ctx, "tank/bad", ListOptions{}) {
+		if err == nil || !strings.Contains(err.Error(), "failed to decode JSON") {
+			t.Fatalf("Expected decode error, got %v", err)
+		}
+		errs++
+	}
+	if errs != 1 {
+		t.Errorf("Expected exactly one error, got %d", errs)
+	}
+}
+
+func TestZFS_PropertySelection(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	spaceJSON := datasetListJSON(
+		testDataset{name: "tank/app", typ: DatasetTypeFilesystem, props: map[string]string{
+			"guid": "42", "used": "1000", "usedbysnapshots": "300", "logicalreferenced": "900",
+		}},
+	)
+	spaceProps := strings.Join(resolvePropertyList([]string{"space"}), ",")
+
+	mockRunner.AddCommand("zfs list -o "+spaceProps+" -p tank/app -j", spaceJSON, "", nil)
+	mockRunner.AddCommand("zfs list -o name,creation,com.ourco:tag -p -t fs tank/app -j", spaceJSON, "", nil)
+
+	ds, err := client.GetWithOptions(ctx, "tank/app", ListOptions{Properties: []string{"space"}})
+	if err != nil {
+		t.Fatalf("GetWithOptions returned error: %v", err)
+	}
+	if ds == nil {
+		t.Fatal("Expected dataset")
+	}
+	if ds.Used != 1000 || ds.GUID != "42" {
+		t.Errorf("typed fields not hydrated: used=%d guid=%q", ds.Used, ds.GUID)
+	}
+	if ds.Mountpoint != "" || ds.Available != 0 {
+		t.Errorf("fields not fetched should stay empty: %+v", ds)
+	}
+	if ds.Properties["usedbysnapshots"].Value != "300" {
+		t.Errorf("Expected usedbysnapshots to be available")
+	}
+
+	mockRunner.AddCommand("zfs list -o "+spaceProps+" -p -r -t fs tank -j", spaceJSON, "", nil)
+	datasets, err := client.ListWithOptions(ctx, "tank", ListOptions{
+		Type:       DatasetTypeFilesystem,
+		Recursive:  true,
+		Properties: []string{"space"},
+	})
+	if err != nil {
+		t.Fatalf("ListWithOptions returned error: %v", err)
+	}
+	if len(datasets) != 1 || datasets[0].z != client {
+		t.Fatalf("Expected datasets bound to the listing client, got %+v", datasets)
+	}
+
+	// A later Get through the dataset's client must fetch the full default list.
+	mockRunner.AddCommand("zfs list -o "+strings.Join(dsPropList, ",")+" -p tank/app -j", spaceJSON, "", nil)
+	if _, err := datasets[0].z.Get(ctx, "tank/app", false); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if last := mockRunner.GetLastCall(); last == nil || !strings.Contains(last.Cmd, strings.Join(dsPropList, ",")) {
+		t.Errorf("Expected Get to use the default property list, got %+v", last)
+	}
+
+	ds, err = client.GetWithOptions(ctx, "tank/app", ListOptions{
+		Type:       DatasetTypeFilesystem,
+		Properties: []string{"creation", "com.ourco:tag"},
+	})
+	if err != nil {
+		t.Fatalf("GetWithOptions returned error: %v", err)
+	}
+	if ds == nil || ds.Name != "tank/app" {
+		t.Fatalf("Unexpected dataset: %+v", ds)
+	}
+
+	if _, err := client.ListWithOptions(ctx, "tank", ListOptions{Properties: []string{"used,quota"}}); err == nil {
+		t.Error("Expected error for invalid property selection")
+	}
+}
@@ -0,0 +1,284 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MountRecord is one mounted file system as reported by zfs mount.
+type MountRecord struct {
+	Dataset    string `json:"name"`
+	Mountpoint string `json:"mountpoint"`
+}
+
+type mountList struct {
+	OutputVersion OutputVersion           `json:"output_version"`
+	Datasets      map[string]*MountRecord `json:"datasets"`
+}
+
+// MountOptions controls MountAll.
+type MountOptions struct {
+	// Overlay allows mounting over non-empty directories (-O).
+	Overlay bool
+	// Options are temporary mount options (-o).
+	Options []string
+}
+
+// UnmountOptions controls UnmountAll.
+type UnmountOptions struct {
+	// Force unmounts even if the file system is busy (-f).
+	Force bool
+	// Diagnose looks up the processes holding a file system open when its unmount
+	// fails, from /proc.
+	Diagnose bool
+}
+
+// MountResult reports the outcome of mounting or unmounting one file system.
+type MountResult struct {
+	Dataset    string       `json:"dataset"`
+	Mountpoint string       `json:"mountpoint"`
+	Err        error        `json:"-"`
+	Holders    []PathHolder `json:"holders,omitempty"`
+}
+
+// mountDepth orders mounts so that a mountpoint is mounted before anything inside it.
+// It counts path components, so "/" sorts before "/data".
+func mountDepth(mountpoint string) int {
+	trimmed := strings.Trim(mountpoint, "/")
+	if trimmed == "" {
+		return 0
+	}
+	return strings.Count(trimmed, "/") + 1
+}
+
+// sortByMountpoint orders names parent-first by mountpoint, or children-first when
+// reverse is set. Ties are broken by dataset name.
+func sortByMountpoint(names []string, mountpoint func(string) string, reverse bool) {
+	sort.SliceStable(names, func(i, j int) bool {
+		di, dj := mountDepth(mountpoint(names[i])), mountDepth(mountpoint(names[j]))
+		if di == dj {
+			if reverse {
+				return names[i] > names[j]
+			}
+			return names[i] < names[j]
+		}
+		if reverse {
+			return di > dj
+		}
+		return di < dj
+	})
+}
+
+func isMountableMountpoint(mountpoint string) bool {
+	switch mountpoint {
+	case "", "-", "none", "legacy":
+		return false
+	default:
+		return true
+	}
+}
+
+// Mounts returns the mounted ZFS file systems, parents first.
+func (z *zfs) Mounts(ctx context.Context) ([]MountRecord, error) {
+	var resp mountList
+
+	if err := z.cmd.runJSONAllowEmpty(ctx, &resp, "mount"); err != nil {
+		return nil, fmt.Errorf("list_mounts_failed: %w", err)
+	}
+
+	byName := make(map[string]MountRecord, len(resp.Datasets))
+	names := make([]string, 0, len(resp.Datasets))
+	for name, rec := range resp.Datasets {
+		if rec == nil {
+			continue
+		}
+		if rec.Dataset == "" {
+			rec.Dataset = name
+		}
+		byName[name] = *rec
+		names = append(names, name)
+	}
+
+	sortByMountpoint(names, func(n string) string { return byName[n].Mountpoint }, false)
+
+	mounts := make([]MountRecord, len(names))
+	for i, n := range names {
+		mounts[i] = byName[n]
+	}
+
+	return mounts, nil
+}
+
+// mountpointOf returns where name is currently mounted, legacy mounts included.
+func (z *zfs) mountpointOf(ctx context.Context, name string) (string, error) {
+	mounts, err := z.Mounts(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, m := range mounts {
+		if m.Dataset == name && m.Mountpoint != "" {
+			return m.Mountpoint, nil
+		}
+	}
+
+	return "", fmt.Errorf("dataset_not_mounted: %s", name)
+}
+
+// pathUnder joins rel to root without letting it escape root.
+func pathUnder(root, rel string) string {
+	return filepath.Join(root, filepath.Clean(string(filepath.Separator)+rel))
+}
+
+var mountProps = []string{"canmount", "mountpoint", "mounted", "keystatus"}
+
+func (z *zfs) mountState(ctx context.Context, root string) (map[string]map[string]ZFSProperty, error) {
+	var names []string
+	opts := GetOptions{Types: []DatasetType{DatasetTypeFilesystem}}
+	if root != "" {
+		names = []string{root}
+		opts.Recursive = true
+	}
+
+	return z.GetProperties(ctx, names, mountProps, opts)
+}
+
+func hasFailedAncestor(name string, failed map[string]bool) string {
+	for p := parentDatasetName(name); p != ""; p = parentDatasetName(p) {
+		if failed[p] {
+			return p
+		}
+	}
+	return ""
+}
+
+// MountAll mounts every unmounted file system at or below root (every pool when root
+// is empty) with canmount=on and a mountpoint other than legacy or none, parents
+// first. Children of a file system that failed to mount are skipped. The error is
+// only set if the file systems cannot be listed.
+func (z *zfs) MountAll(ctx context.Context, root string, opts MountOptions) ([]MountResult, error) {
+	props, err := z.mountState(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func(ds, prop string) string {
+		return strings.TrimSpace(props[ds][prop].Value)
+	}
+
+	var names []string
+	for ds := range props {
+		if value(ds, "canmount") == string(CanMountOn) && value(ds, "mounted") != "yes" && isMountableMountpoint(value(ds, "mountpoint")) {
+			names = append(names, ds)
+		}
+	}
+	sortByMountpoint(names, func(n string) string { return value(n, "mountpoint") }, false)
+
+	args := []string{"mount"}
+	if opts.Overlay {
+		args = append(args, "-O")
+	}
+	if len(opts.Options) > 0 {
+		args = append(args, "-o", strings.Join(opts.Options, ","))
+	}
+
+	results := make([]MountResult, 0, len(names))
+	failed := make(map[string]bool)
+
+	for _, ds := range names {
+		res := MountResult{Dataset: ds, Mountpoint: value(ds, "mountpoint")}
+
+		switch {
+		case hasFailedAncestor(ds, failed) != "":
+			res.Err = fmt.Errorf("parent_mount_failed: %s", hasFailedAncestor(ds, failed))
+		case value(ds, "keystatus") == "unavailable":
+			res.Err = fmt.Errorf("key_unavailable: %s", ds)
+		case ctx.Err() != nil:
+			res.Err = ctx.Err()
+		default:
+			if _, _, err := z.cmd.RunBytes(ctx, nil, append(args, ds)...); err != nil {
+				res.Err = fmt.Errorf("mount_failed: %w", err)
+			}
+		}
+
+		if res.Err != nil {
+			failed[ds] = true
+		}
+		results = append(results, res)
+	}
+
+	return results, nil
+}
+
+// UnmountAll unmounts every mounted file system at or below root (every pool when
+// root is empty), children first. File systems with a legacy mountpoint are left to
+// umount(8). Parents of a file system that failed to unmount are skipped. The error
+// is only set if the file systems cannot be listed.
+func (z *zfs) UnmountAll(ctx context.Context, root string, opts UnmountOptions) ([]MountResult, error) {
+	props, err := z.mountState(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func(ds, prop string) string {
+		return strings.TrimSpace(props[ds][prop].Value)
+	}
+
+	var names []string
+	for ds := range props {
+		if value(ds, "mounted") == "yes" && isMountableMountpoint(value(ds, "mountpoint")) {
+			names = append(names, ds)
+		}
+	}
+	sortByMountpoint(names, func(n string) string { return value(n, "mountpoint") }, true)
+
+	args := []string{"unmount"}
+	if opts.Force {
+		args = append(args, "-f")
+	}
+
+	results := make([]MountResult, 0, len(names))
+	failed := make(map[string]bool)
+
+	for _, ds := range names {
+		res := MountResult{Dataset: ds, Mountpoint: value(ds, "mountpoint")}
+
+		var busyChild string
+		for f := range failed {
+			if strings.HasPrefix(f, ds+"/") {
+				busyChild = f
+				break
+			}
+		}
+
+		switch {
+		case busyChild != "":
+			res.Err = fmt.Errorf("child_unmount_failed: %s", busyChild)
+		case ctx.Err() != nil:
+			res.Err = ctx.Err()
+		default:
+			if _, _, err := z.cmd.RunBytes(ctx, nil, append(args, ds)...); err != nil {
+				res.Err = fmt.Errorf("unmount_failed: %w", err)
+				if opts.Diagnose {
+					res.Holders, _ = findPathHolders(procRoot, res.Mountpoint)
+				}
+			}
+		}
+
+		if res.Err != nil {
+			failed[ds] = true
+		}
+		results = append(results, res)
+	}
+
+	return results, nil
+}
+
+// MountHolders returns the processes holding files, working directories or roots
+// under mountpoint, read from /proc. It fails where /proc has no such entries.
+func MountHolders(mountpoint string) ([]PathHolder, error) {
+	return findPathHolders(procRoot, mountpoint)
+}
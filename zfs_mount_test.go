@@ -0,0 +1,162 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+const zfsMountJSON = `{
+  "output_version": {"command": "zfs mount", "vers_major": 0, "vers_minor": 1},
+  "datasets": {
+    "tank/home/alice": {"name": "tank/home/alice", "mountpoint": "/home/alice"},
+    "tank": {"name": "tank", "mountpoint": "/tank"},
+    "tank/home": {"name": "tank/home", "mountpoint": "/home"}
+  }
+}`
+
+func mountStateJSON(entries ...[4]string) string {
+	var datasets []testDataset
+	for _, e := range entries {
+		datasets = append(datasets, testDataset{name: e[0], props: map[string]string{
+			"canmount":   e[1] + "|DEFAULT",
+			"mountpoint": e[2] + "|DEFAULT",
+			"mounted":    e[3] + "|NONE",
+			"keystatus":  "-|NONE",
+		}})
+	}
+	return datasetListJSON(datasets...)
+}
+
+func TestZFS_Mounts(t *testing.T) {
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+
+	mockRunner.AddCommand("zfs mount -j", zfsMountJSON, "", nil)
+
+	mounts, err := client.Mounts(context.Background())
+	if err != nil {
+		t.Fatalf("Mounts returned error: %v", err)
+	}
+
+	var got []string
+	for _, m := range mounts {
+		got = append(got, m.Dataset+"="+m.Mountpoint)
+	}
+	if want := "tank=/tank tank/home=/home tank/home/alice=/home/alice"; strings.Join(got, " ") != want {
+		t.Errorf("Mounts() = %v, want %s", got, want)
+	}
+}
+
+func TestSortByMountpoint(t *testing.T) {
+	mountpoints := map[string]string{
+		"zroot/DATA":      "/data",
+		"zroot/ROOT":      "/",
+		"zroot/DATA/home": "/data/home",
+		"zroot/var":       "/var",
+	}
+	lookup := func(n string) string { return mountpoints[n] }
+
+	names := []string{"zroot/DATA/home", "zroot/DATA", "zroot/var", "zroot/ROOT"}
+	sortByMountpoint(names, lookup, false)
+	if got, want := strings.Join(names, " "), "zroot/ROOT zroot/DATA zroot/var zroot/DATA/home"; got != want {
+		t.Errorf("mount order = %s, want %s", got, want)
+	}
+
+	sortByMountpoint(names, lookup, true)
+	if got, want := strings.Join(names, " "), "zroot/DATA/home zroot/var zroot/DATA zroot/ROOT"; got != want {
+		t.Errorf("unmount order = %s, want %s", got, want)
+	}
+}
+
+func TestZFS_MountAll(t *testing.T) {
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+
+	mockRunner.AddCommand("zfs get -p -r -t fs canmount,mountpoint,mounted,keystatus tank -j", mountStateJSON(
+		[4]string{"tank", "on", "/tank", "yes"},
+		[4]string{"tank/srv", "on", "/srv", "no"},
+		[4]string{"tank/srv/www", "on", "/srv/www", "no"},
+		[4]string{"tank/srv/www/static", "on", "/srv/www/static", "no"},
+		[4]string{"tank/legacy", "on", "legacy", "no"},
+		[4]string{"tank/none", "on", "none", "no"},
+		[4]string{"tank/noauto", "noauto", "/noauto", "no"},
+		[4]string{"tank/off", "off", "/off", "no"},
+		[4]string{"tank/data", "on", "/data", "no"},
+	), "", nil)
+	mockRunner.AddCommand("zfs mount -o noatime tank/data", "", "", nil)
+	mockRunner.AddCommand("zfs mount -o noatime tank/srv", "", "", nil)
+	mockRunner.AddCommand("zfs mount -o noatime tank/srv/www", "", "not empty", fmt.Errorf("exit status 1"))
+
+	results, err := client.MountAll(context.Background(), "tank", MountOptions{Options: []string{"noatime"}})
+	if err != nil {
+		t.Fatalf("MountAll returned error: %v", err)
+	}
+
+	var got []string
+	for _, r := range results {
+		got = append(got, fmt.Sprintf("%s:%v", r.Dataset, r.Err == nil))
+	}
+	if want := "tank/data:true tank/srv:true tank/srv/www:false tank/srv/www/static:false"; strings.Join(got, " ") != want {
+		t.Errorf("MountAll results = %v, want %s", got, want)
+	}
+	if !strings.Contains(results[3].Err.Error(), "parent_mount_failed: tank/srv/www") {
+		t.Errorf("Unexpected child error: %v", results[3].Err)
+	}
+}
+
+func TestZFS_UnmountAll(t *testing.T) {
+	root := t.TempDir()
+	mountpoint := filepath.Join(root, "srv", "www")
+	proc := filepath.Join(root, "proc", "42")
+	if err := os.MkdirAll(filepath.Join(proc, "fd"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(proc, "comm"), []byte("nginx\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(mountpoint, "index.html"), filepath.Join(proc, "fd", "7")); err != nil {
+		t.Fatal(err)
+	}
+
+	oldProcRoot := procRoot
+	procRoot = filepath.Join(root, "proc")
+	defer func() { procRoot = oldProcRoot }()
+
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+
+	mockRunner.AddCommand("zfs get -p -r -t fs canmount,mountpoint,mounted,keystatus tank/srv -j", mountStateJSON(
+		[4]string{"tank/srv", "on", filepath.Join(root, "srv"), "yes"},
+		[4]string{"tank/srv/www", "on", mountpoint, "yes"},
+		[4]string{"tank/srv/logs", "noauto", filepath.Join(root, "srv", "logs"), "yes"},
+		[4]string{"tank/srv/legacy", "on", "legacy", "yes"},
+	), "", nil)
+	mockRunner.AddCommand("zfs unmount tank/srv/www", "", "target is busy", fmt.Errorf("exit status 1"))
+	mockRunner.AddCommand("zfs unmount tank/srv/logs", "", "", nil)
+
+	results, err := client.UnmountAll(context.Background(), "tank/srv", UnmountOptions{Diagnose: true})
+	if err != nil {
+		t.Fatalf("UnmountAll returned error: %v", err)
+	}
+
+	var got []string
+	for _, r := range results {
+		got = append(got, fmt.Sprintf("%s:%v", r.Dataset, r.Err == nil))
+	}
+	if want := "tank/srv/www:false tank/srv/logs:true tank/srv:false"; strings.Join(got, " ") != want {
+		t.Errorf("UnmountAll results = %v, want %s", got, want)
+	}
+
+	if len(results[0].Holders) != 1 || results[0].Holders[0].Command != "nginx" {
+		t.Errorf("Expected nginx as holder, got %+v", results[0].Holders)
+	}
+	if !strings.Contains(results[2].Err.Error(), "child_unmount_failed") {
+		t.Errorf("Unexpected parent error: %v", results[2].Err)
+	}
+}
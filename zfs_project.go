@@ -0,0 +1,369 @@
+package gzfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProjectRecord is the project ID and inherit flag of a file or directory, as listed
+// by zfs project.
+type ProjectRecord struct {
+	Path    string `json:"path"`
+	ID      uint32 `json:"id"`
+	Inherit bool   `json:"inherit"`
+}
+
+// ProjectMismatch is a file reported by zfs project -c. ID and Expected are only set
+// when the project ID differs; otherwise the inherit flag is missing.
+type ProjectMismatch struct {
+	Path           string `json:"path"`
+	ID             uint32 `json:"id,omitempty"`
+	Expected       uint32 `json:"expected,omitempty"`
+	MissingInherit bool   `json:"missingInherit"`
+}
+
+// ProjectScope limits which files of a directory zfs project acts on.
+type ProjectScope struct {
+	// Recursive descends into subdirectories (-r).
+	Recursive bool
+	// Directory acts on the directory itself rather than its contents (-d).
+	Directory bool
+}
+
+// ProjectSetOptions controls SetProject.
+type ProjectSetOptions struct {
+	// Recursive assigns the ID to the whole tree (-r).
+	Recursive bool
+	// Inherit sets the inherit flag so new files get the ID of their directory (-s).
+	Inherit bool
+}
+
+// ProjectCheckOptions controls CheckProject.
+type ProjectCheckOptions struct {
+	ProjectScope
+	// ID is the expected project ID (-p). Zero checks against the ID of each
+	// directory given.
+	ID uint32
+}
+
+// ProjectDirectoryOptions controls CreateProjectDirectory.
+type ProjectDirectoryOptions struct {
+	ID uint32
+	// Quota and ObjQuota are the projectquota and projectobjquota limits. Zero leaves
+	// the quota unset.
+	Quota    uint64
+	ObjQuota uint64
+	// Mode is the permission of the new directory. Zero means 0755.
+	Mode os.FileMode
+}
+
+func projectScopeArgs(args []string, scope ProjectScope) ([]string, error) {
+	if scope.Recursive && scope.Directory {
+		return nil, fmt.Errorf("invalid_project_scope: recursive and directory are mutually exclusive")
+	}
+	if scope.Recursive {
+		args = append(args, "-r")
+	}
+	if scope.Directory {
+		args = append(args, "-d")
+	}
+	return args, nil
+}
+
+func validateProjectPaths(paths []string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no paths given")
+	}
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("invalid_project_path: %q is not absolute", p)
+		}
+	}
+	return nil
+}
+
+// parseProjectList parses lines of the form "<id> <P|-> <path>".
+func parseProjectList(out []byte) ([]ProjectRecord, error) {
+	records := []ProjectRecord{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimLeft(scanner.Text(), " ")
+		if line == "" {
+			continue
+		}
+
+		id, rest, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("unexpected_project_output: %q", line)
+		}
+		flag, path, ok := strings.Cut(rest, " ")
+		if !ok || (flag != "P" && flag != "-") {
+			return nil, fmt.Errorf("unexpected_project_output: %q", line)
+		}
+
+		n, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected_project_output: %q", line)
+		}
+
+		records = append(records, ProjectRecord{Path: path, ID: uint32(n), Inherit: flag == "P"})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse project output: %w", err)
+	}
+
+	return records, nil
+}
+
+// parseProjectCheck parses the mismatches reported by zfs project -c, of the form
+// "<path> - project ID is not set properly (<id>/<expected>)" or
+// "<path> - project inherit flag is not set".
+func parseProjectCheck(out []byte) ([]ProjectMismatch, error) {
+	mismatches := []ProjectMismatch{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		i := strings.LastIndex(line, " - ")
+		if i < 0 {
+			return nil, fmt.Errorf("unexpected_project_output: %q", line)
+		}
+		m := ProjectMismatch{Path: line[:i]}
+		reason := line[i+3:]
+
+		switch {
+		case strings.HasPrefix(reason, "project inherit flag is not set"):
+			m.MissingInherit = true
+		case strings.HasPrefix(reason, "project ID is not set properly"):
+			ids := reason[strings.LastIndex(reason, "(")+1:]
+			cur, expected, ok := strings.Cut(strings.TrimSuffix(ids, ")"), "/")
+			if !ok {
+				return nil, fmt.Errorf("unexpected_project_output: %q", line)
+			}
+			m.ID = uint32(ParseUint64(cur))
+			m.Expected = uint32(ParseUint64(expected))
+		default:
+			return nil, fmt.Errorf("unexpected_project_output: %q", line)
+		}
+
+		mismatches = append(mismatches, m)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse project output: %w", err)
+	}
+
+	return mismatches, nil
+}
+
+// ListProjects returns the project ID and inherit flag of paths, or of their contents
+// for directories unless scope.Directory is set.
+func (z *zfs) ListProjects(ctx context.Context, scope ProjectScope, paths ...string) ([]ProjectRecord, error) {
+	if err := validateProjectPaths(paths); err != nil {
+		return nil, err
+	}
+
+	args, err := projectScopeArgs([]string{"project"}, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	out, _, err := z.cmd.RunBytes(ctx, nil, append(args, paths...)...)
+	if err != nil {
+		return nil, fmt.Errorf("project_list_failed: %w", err)
+	}
+
+	return parseProjectList(out)
+}
+
+// SetProject assigns project id to paths.
+func (z *zfs) SetProject(ctx context.Context, id uint32, opts ProjectSetOptions, paths ...string) error {
+	if err := validateProjectPaths(paths); err != nil {
+		return err
+	}
+
+	args := []string{"project", "-p", strconv.FormatUint(uint64(id), 10)}
+	if opts.Recursive {
+		args = append(args, "-r")
+	}
+	if opts.Inherit {
+		args = append(args, "-s")
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, append(args, paths...)...); err != nil {
+		return fmt.Errorf("project_set_failed: %w", err)
+	}
+
+	return nil
+}
+
+// ClearProject clears the inherit flag of paths and, unless keepID is set, resets
+// their project ID to 0.
+func (z *zfs) ClearProject(ctx context.Context, keepID, recursive bool, paths ...string) error {
+	if err := validateProjectPaths(paths); err != nil {
+		return err
+	}
+
+	args := []string{"project", "-C"}
+	if keepID {
+		args = append(args, "-k")
+	}
+	if recursive {
+		args = append(args, "-r")
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, append(args, paths...)...); err != nil {
+		return fmt.Errorf("project_clear_failed: %w", err)
+	}
+
+	return nil
+}
+
+// CheckProject reports the files under paths whose project ID or inherit flag does
+// not match. An empty result means the tree is consistent.
+func (z *zfs) CheckProject(ctx context.Context, opts ProjectCheckOptions, paths ...string) ([]ProjectMismatch, error) {
+	if err := validateProjectPaths(paths); err != nil {
+		return nil, err
+	}
+
+	args, err := projectScopeArgs([]string{"project", "-c"}, opts.ProjectScope)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ID > 0 {
+		args = append(args, "-p", strconv.FormatUint(uint64(opts.ID), 10))
+	}
+
+	out, _, err := z.cmd.RunBytes(ctx, nil, append(args, paths...)...)
+	if err != nil {
+		return nil, fmt.Errorf("project_check_failed: %w", err)
+	}
+
+	return parseProjectCheck(out)
+}
+
+// ProjectPath resolves rel against the current mountpoint of the file system and
+// refuses paths that would escape it.
+func (d *Dataset) ProjectPath(ctx context.Context, rel string) (string, error) {
+	if d == nil {
+		return "", fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return "", fmt.Errorf("no zfs client attached")
+	}
+
+	mountpoint, err := d.z.mountpointOf(ctx, d.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return pathUnder(mountpoint, rel), nil
+}
+
+func (d *Dataset) projectPaths(ctx context.Context, rels []string) ([]string, error) {
+	if len(rels) == 0 {
+		rels = []string{"."}
+	}
+
+	paths := make([]string, len(rels))
+	for i, rel := range rels {
+		p, err := d.ProjectPath(ctx, rel)
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = p
+	}
+
+	return paths, nil
+}
+
+// ListProjects lists the project IDs of paths relative to the mountpoint, or of the
+// root of the file system when none are given.
+func (d *Dataset) ListProjects(ctx context.Context, scope ProjectScope, rels ...string) ([]ProjectRecord, error) {
+	paths, err := d.projectPaths(ctx, rels)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.z.ListProjects(ctx, scope, paths...)
+}
+
+func (d *Dataset) SetProject(ctx context.Context, id uint32, opts ProjectSetOptions, rels ...string) error {
+	paths, err := d.projectPaths(ctx, rels)
+	if err != nil {
+		return err
+	}
+
+	return d.z.SetProject(ctx, id, opts, paths...)
+}
+
+func (d *Dataset) ClearProject(ctx context.Context, keepID, recursive bool, rels ...string) error {
+	paths, err := d.projectPaths(ctx, rels)
+	if err != nil {
+		return err
+	}
+
+	return d.z.ClearProject(ctx, keepID, recursive, paths...)
+}
+
+func (d *Dataset) CheckProject(ctx context.Context, opts ProjectCheckOptions, rels ...string) ([]ProjectMismatch, error) {
+	paths, err := d.projectPaths(ctx, rels)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.z.CheckProject(ctx, opts, paths...)
+}
+
+// CreateProjectDirectory creates the directory rel under the mountpoint, assigns it
+// project opts.ID with the inherit flag so everything created inside is charged to
+// the project, and sets the project quotas. The directory may already exist.
+func (d *Dataset) CreateProjectDirectory(ctx context.Context, rel string, opts ProjectDirectoryOptions) (string, error) {
+	if opts.ID == 0 {
+		return "", fmt.Errorf("invalid_project_id: 0 is the default project")
+	}
+
+	path, err := d.ProjectPath(ctx, rel)
+	if err != nil {
+		return "", err
+	}
+
+	mode := opts.Mode
+	if mode == 0 {
+		mode = 0o755
+	}
+
+	if err := os.MkdirAll(path, mode); err != nil {
+		return "", fmt.Errorf("project_directory_create_failed: %w", err)
+	}
+
+	if err := d.z.SetProject(ctx, opts.ID, ProjectSetOptions{Recursive: true, Inherit: true}, path); err != nil {
+		return "", err
+	}
+
+	id := strconv.FormatUint(uint64(opts.ID), 10)
+	if opts.Quota > 0 {
+		if err := d.z.SetQuota(ctx, d.Name, QuotaProject, id, opts.Quota); err != nil {
+			return "", err
+		}
+	}
+	if opts.ObjQuota > 0 {
+		if err := d.z.SetQuota(ctx, d.Name, QuotaProjectObject, id, opts.ObjQuota); err != nil {
+			return "", err
+		}
+	}
+
+	return path, nil
+}
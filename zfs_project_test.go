@@ -0,0 +1,75 @@
+package gzfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func TestParseProjectOutput(t *testing.T) {
+	records, err := parseProjectList([]byte("    0 - /tank/share/readme\n   42 P /tank/share/team a\n"))
+	if err != nil {
+		t.Fatalf("parseProjectList returned error: %v", err)
+	}
+	if len(records) != 2 || records[0].ID != 0 || records[0].Inherit || records[1].Path != "/tank/share/team a" || records[1].ID != 42 || !records[1].Inherit {
+		t.Errorf("Unexpected records: %+v", records)
+	}
+
+	mismatches, err := parseProjectCheck([]byte(
+		"/tank/share/team/x - project ID is not set properly (0/42)\n" +
+			"/tank/share/team/sub - project inherit flag is not set\n"))
+	if err != nil {
+		t.Fatalf("parseProjectCheck returned error: %v", err)
+	}
+	if len(mismatches) != 2 || mismatches[0].ID != 0 || mismatches[0].Expected != 42 || !mismatches[1].MissingInherit {
+		t.Errorf("Unexpected mismatches: %+v", mismatches)
+	}
+
+	if _, err := parseProjectList([]byte("x P /a\n")); err == nil {
+		t.Error("Expected error for a malformed line")
+	}
+}
+
+func TestDataset_CreateProjectDirectory(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+	ds := &Dataset{z: client, Name: "tank/share"}
+
+	mockRunner.AddCommand("zfs mount -j", `{"datasets": {"tank/share": {"name": "tank/share", "mountpoint": "`+root+`"}}}`, "", nil)
+	dir := filepath.Join(root, "teams", "infra")
+	mockRunner.AddCommand("zfs project -p 42 -r -s "+dir, "", "", nil)
+	mockRunner.AddCommand("zfs set projectquota@42=5368709120 tank/share", "", "", nil)
+	mockRunner.AddCommand("zfs project -c -r -p 42 "+dir, dir+"/old - project ID is not set properly (0/42)\n", "", nil)
+
+	path, err := ds.CreateProjectDirectory(ctx, "teams/infra", ProjectDirectoryOptions{ID: 42, Quota: 5 << 30})
+	if err != nil {
+		t.Fatalf("CreateProjectDirectory returned error: %v", err)
+	}
+	if path != dir {
+		t.Errorf("path = %s, want %s", path, dir)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Errorf("Directory was not created: %v", err)
+	}
+	if last := mockRunner.GetLastCall(); last == nil || strings.Join(last.Args, " ") != "set projectquota@42=5368709120 tank/share" {
+		t.Errorf("Unexpected last call: %+v", last)
+	}
+
+	mismatches, err := ds.CheckProject(ctx, ProjectCheckOptions{ProjectScope: ProjectScope{Recursive: true}, ID: 42}, "teams/infra")
+	if err != nil || len(mismatches) != 1 || mismatches[0].Path != dir+"/old" {
+		t.Errorf("CheckProject = %+v, %v", mismatches, err)
+	}
+
+	if p, err := ds.ProjectPath(ctx, "../../etc"); err != nil || p != filepath.Join(root, "etc") {
+		t.Errorf("ProjectPath escaped the mountpoint: %s, %v", p, err)
+	}
+	if _, err := (&Dataset{z: client, Name: "tank/other"}).ProjectPath(ctx, "x"); err == nil {
+		t.Error("Expected error for an unmounted dataset")
+	}
+}
@@ -0,0 +1,297 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypedProperty is a parsed property value together with where it came from.
+// Present is false when the property was not part of the fetched property set.
+// DatasetProperties.Changes treats a non-zero Value as set, but setting a property
+// to its zero value (off, none, 0) also needs Present, so build new values with
+// NewTypedProperty or Set.
+type TypedProperty[T comparable] struct {
+	Value   T                 `json:"value"`
+	Source  ZFSPropertySource `json:"source"`
+	Present bool              `json:"present"`
+}
+
+// NewTypedProperty returns a present property holding v.
+func NewTypedProperty[T comparable](v T) TypedProperty[T] {
+	return TypedProperty[T]{Value: v, Present: true}
+}
+
+// Set stores v and marks the property present.
+func (p *TypedProperty[T]) Set(v T) {
+	p.Value = v
+	p.Present = true
+}
+
+// IsSet reports whether the property carries a value, either because it was
+// fetched or set, or because Value is not the zero value.
+func (p TypedProperty[T]) IsSet() bool {
+	var zero T
+	return p.Present || p.Value != zero
+}
+
+type CompressionType string
+
+const (
+	CompressionOff  CompressionType = "off"
+	CompressionOn   CompressionType = "on"
+	CompressionLZ4  CompressionType = "lz4"
+	CompressionLZJB CompressionType = "lzjb"
+	CompressionGzip CompressionType = "gzip"
+	CompressionZLE  CompressionType = "zle"
+	CompressionZstd CompressionType = "zstd"
+)
+
+type ChecksumType string
+
+const (
+	ChecksumOn        ChecksumType = "on"
+	ChecksumOff       ChecksumType = "off"
+	ChecksumFletcher2 ChecksumType = "fletcher2"
+	ChecksumFletcher4 ChecksumType = "fletcher4"
+	ChecksumSHA256    ChecksumType = "sha256"
+	ChecksumSHA512    ChecksumType = "sha512"
+	ChecksumSkein     ChecksumType = "skein"
+	ChecksumEdonR     ChecksumType = "edonr"
+	ChecksumBlake3    ChecksumType = "blake3"
+	ChecksumNoParity  ChecksumType = "noparity"
+)
+
+type DedupType string
+
+const (
+	DedupOff    DedupType = "off"
+	DedupOn     DedupType = "on"
+	DedupVerify DedupType = "verify"
+)
+
+type SyncType string
+
+const (
+	SyncStandard SyncType = "standard"
+	SyncAlways   SyncType = "always"
+	SyncDisabled SyncType = "disabled"
+)
+
+type CacheType string
+
+const (
+	CacheAll      CacheType = "all"
+	CacheNone     CacheType = "none"
+	CacheMetadata CacheType = "metadata"
+)
+
+type CanMountType string
+
+const (
+	CanMountOn     CanMountType = "on"
+	CanMountOff    CanMountType = "off"
+	CanMountNoAuto CanMountType = "noauto"
+)
+
+type VolModeType string
+
+const (
+	VolModeDefault VolModeType = "default"
+	VolModeFull    VolModeType = "full"
+	VolModeGeom    VolModeType = "geom"
+	VolModeDev     VolModeType = "dev"
+	VolModeNone    VolModeType = "none"
+)
+
+type ACLModeType string
+
+const (
+	ACLModeDiscard     ACLModeType = "discard"
+	ACLModeGroupmask   ACLModeType = "groupmask"
+	ACLModePassthrough ACLModeType = "passthrough"
+	ACLModeRestricted  ACLModeType = "restricted"
+)
+
+// DatasetProperties holds the commonly used native properties in typed form.
+type DatasetProperties struct {
+	Quota          TypedProperty[uint64] `json:"quota"`
+	RefQuota       TypedProperty[uint64] `json:"refquota"`
+	Reservation    TypedProperty[uint64] `json:"reservation"`
+	RefReservation TypedProperty[uint64] `json:"refreservation"`
+	RecordSize     TypedProperty[uint64] `json:"recordsize"`
+	VolSize        TypedProperty[uint64] `json:"volsize"`
+	VolBlockSize   TypedProperty[uint64] `json:"volblocksize"`
+	LogicalUsed    TypedProperty[uint64] `json:"logicalused"`
+	Written        TypedProperty[uint64] `json:"written"`
+
+	Compression  TypedProperty[CompressionType] `json:"compression"`
+	Checksum     TypedProperty[ChecksumType]    `json:"checksum"`
+	Dedup        TypedProperty[DedupType]       `json:"dedup"`
+	Sync         TypedProperty[SyncType]        `json:"sync"`
+	PrimaryCache TypedProperty[CacheType]       `json:"primarycache"`
+	CanMount     TypedProperty[CanMountType]    `json:"canmount"`
+	VolMode      TypedProperty[VolModeType]     `json:"volmode"`
+	ACLMode      TypedProperty[ACLModeType]     `json:"aclmode"`
+
+	ReadOnly TypedProperty[bool] `json:"readonly"`
+	Atime    TypedProperty[bool] `json:"atime"`
+	Mounted  TypedProperty[bool] `json:"mounted"`
+
+	Creation TypedProperty[time.Time] `json:"creation"`
+}
+
+func typedProperty[T comparable](props map[string]ZFSProperty, name string, parse func(string) T) TypedProperty[T] {
+	prop, ok := props[name]
+	if !ok {
+		return TypedProperty[T]{}
+	}
+
+	return TypedProperty[T]{
+		Value:   parse(prop.Value),
+		Source:  prop.Source,
+		Present: true,
+	}
+}
+
+func parseEnum[T ~string](value string) T {
+	return T(ParseString(value))
+}
+
+func parseOnOff(value string) bool {
+	switch strings.TrimSpace(value) {
+	case "on", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseCreation parses a creation property in either parsable (-p, Unix seconds) or
+// human-readable form. It returns the zero time if value is neither.
+func ParseCreation(value string) time.Time {
+	v := strings.TrimSpace(value)
+	if v == "" || v == "-" {
+		return time.Time{}
+	}
+
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0)
+	}
+
+	if t, err := time.ParseInLocation("Mon Jan _2 15:04 2006", v, time.Local); err == nil {
+		return t
+	}
+
+	return time.Time{}
+}
+
+func parseDatasetProperties(props map[string]ZFSProperty) DatasetProperties {
+	return DatasetProperties{
+		Quota:          typedProperty(props, "quota", ParseSize),
+		RefQuota:       typedProperty(props, "refquota", ParseSize),
+		Reservation:    typedProperty(props, "reservation", ParseSize),
+		RefReservation: typedProperty(props, "refreservation", ParseSize),
+		RecordSize:     typedProperty(props, "recordsize", ParseSize),
+		VolSize:        typedProperty(props, "volsize", ParseSize),
+		VolBlockSize:   typedProperty(props, "volblocksize", ParseSize),
+		LogicalUsed:    typedProperty(props, "logicalused", ParseSize),
+		Written:        typedProperty(props, "written", ParseSize),
+
+		Compression:  typedProperty(props, "compression", parseEnum[CompressionType]),
+		Checksum:     typedProperty(props, "checksum", parseEnum[ChecksumType]),
+		Dedup:        typedProperty(props, "dedup", parseEnum[DedupType]),
+		Sync:         typedProperty(props, "sync", parseEnum[SyncType]),
+		PrimaryCache: typedProperty(props, "primarycache", parseEnum[CacheType]),
+		CanMount:     typedProperty(props, "canmount", parseEnum[CanMountType]),
+		VolMode:      typedProperty(props, "volmode", parseEnum[VolModeType]),
+		ACLMode:      typedProperty(props, "aclmode", parseEnum[ACLModeType]),
+
+		ReadOnly: typedProperty(props, "readonly", parseOnOff),
+		Atime:    typedProperty(props, "atime", parseOnOff),
+		Mounted:  typedProperty(props, "mounted", parseOnOff),
+
+		Creation: typedProperty(props, "creation", ParseCreation),
+	}
+}
+
+func formatQuota(v uint64) string {
+	if v == 0 {
+		return "none"
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func formatSize(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
+
+func formatOnOff(v bool) string {
+	if v {
+		return "on"
+	}
+	return "off"
+}
+
+func appendChanged[T comparable](kv []string, name string, next, prev TypedProperty[T], format func(T) string) []string {
+	if !next.IsSet() || (prev.IsSet() && next.Value == prev.Value) {
+		return kv
+	}
+	return append(kv, name, format(next.Value))
+}
+
+// Changes returns the name/value pairs of settable properties in p that differ from
+// prev, ready to pass to Dataset.SetProperties. Read-only properties are ignored.
+func (p DatasetProperties) Changes(prev DatasetProperties) []string {
+	var kv []string
+
+	kv = appendChanged(kv, "quota", p.Quota, prev.Quota, formatQuota)
+	kv = appendChanged(kv, "refquota", p.RefQuota, prev.RefQuota, formatQuota)
+	kv = appendChanged(kv, "reservation", p.Reservation, prev.Reservation, formatQuota)
+	kv = appendChanged(kv, "refreservation", p.RefReservation, prev.RefReservation, formatQuota)
+	kv = appendChanged(kv, "recordsize", p.RecordSize, prev.RecordSize, formatSize)
+	kv = appendChanged(kv, "volsize", p.VolSize, prev.VolSize, formatSize)
+
+	kv = appendChanged(kv, "compression", p.Compression, prev.Compression, func(v CompressionType) string { return string(v) })
+	kv = appendChanged(kv, "checksum", p.Checksum, prev.Checksum, func(v ChecksumType) string { return string(v) })
+	kv = appendChanged(kv, "dedup", p.Dedup, prev.Dedup, func(v DedupType) string { return string(v) })
+	kv = appendChanged(kv, "sync", p.Sync, prev.Sync, func(v SyncType) string { return string(v) })
+	kv = appendChanged(kv, "primarycache", p.PrimaryCache, prev.PrimaryCache, func(v CacheType) string { return string(v) })
+	kv = appendChanged(kv, "canmount", p.CanMount, prev.CanMount, func(v CanMountType) string { return string(v) })
+	kv = appendChanged(kv, "volmode", p.VolMode, prev.VolMode, func(v VolModeType) string { return string(v) })
+	kv = appendChanged(kv, "aclmode", p.ACLMode, prev.ACLMode, func(v ACLModeType) string { return string(v) })
+
+	kv = appendChanged(kv, "readonly", p.ReadOnly, prev.ReadOnly, formatOnOff)
+	kv = appendChanged(kv, "atime", p.Atime, prev.Atime, formatOnOff)
+
+	return kv
+}
+
+// UpdateProperties sets every property in p that differs from the dataset's current
+// typed properties and records the new values on success.
+func (d *Dataset) UpdateProperties(ctx context.Context, p DatasetProperties) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+
+	kv := p.Changes(d.Typed)
+	if len(kv) == 0 {
+		return nil
+	}
+
+	if err := d.SetProperties(ctx, kv...); err != nil {
+		return err
+	}
+
+	if d.Properties == nil {
+		d.Properties = make(map[string]ZFSProperty)
+	}
+	for i := 0; i < len(kv); i += 2 {
+		d.Properties[kv[i]] = ZFSProperty{Value: kv[i+1], Source: ZFSPropertySource{Type: "LOCAL"}}
+	}
+	d.Typed = parseDatasetProperties(d.Properties)
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package gzfs
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func typedPropertiesJSON() string {
+	return datasetListJSON(
+		testDataset{name: "tank/app", typ: DatasetTypeFilesystem, txg: "5", props: map[string]string{
+			"quota":        "10737418240|LOCAL",
+			"refquota":     "none|DEFAULT",
+			"recordsize":   "131072|INHERITED|tank",
+			"logicalused":  "4096|NONE",
+			"compression":  "zstd|LOCAL",
+			"checksum":     "on|DEFAULT",
+			"sync":         "disabled|LOCAL",
+			"canmount":     "noauto|LOCAL",
+			"primarycache": "metadata|RECEIVED",
+			"readonly":     "off|DEFAULT",
+			"atime":        "on|TEMPORARY",
+			"mounted":      "yes|NONE",
+			"creation":     "1700000000|NONE",
+		}},
+	)
+}
+
+func TestParseDatasetProperties(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	mockRunner.AddCommand("zfs list -o "+strings.Join(dsPropList, ",")+" -p tank/app -j", typedPropertiesJSON(), "", nil)
+
+	ds, err := client.Get(ctx, "tank/app", false)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+
+	p := ds.Typed
+
+	if !p.Quota.Present || p.Quota.Value != 10737418240 || p.Quota.Source.Type != "LOCAL" {
+		t.Errorf("Unexpected quota: %+v", p.Quota)
+	}
+	if !p.RefQuota.Present || p.RefQuota.Value != 0 {
+		t.Errorf("Unexpected refquota: %+v", p.RefQuota)
+	}
+	if p.RecordSize.Value != 131072 || p.RecordSize.Source.Data != "tank" {
+		t.Errorf("Unexpected recordsize: %+v", p.RecordSize)
+	}
+	if p.LogicalUsed.Value != 4096 {
+		t.Errorf("Unexpected logicalused: %+v", p.LogicalUsed)
+	}
+	if p.Compression.Value != CompressionZstd || p.Sync.Value != SyncDisabled || p.CanMount.Value != CanMountNoAuto {
+		t.Errorf("Unexpected enums: %+v %+v %+v", p.Compression, p.Sync, p.CanMount)
+	}
+	if p.PrimaryCache.Value != CacheMetadata || p.PrimaryCache.Source.Type != "RECEIVED" {
+		t.Errorf("Unexpected primarycache: %+v", p.PrimaryCache)
+	}
+	if p.ReadOnly.Value || !p.Atime.Value || !p.Mounted.Value {
+		t.Errorf("Unexpected booleans: readonly=%v atime=%v mounted=%v", p.ReadOnly.Value, p.Atime.Value, p.Mounted.Value)
+	}
+	if !p.Creation.Value.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Unexpected creation: %v", p.Creation.Value)
+	}
+	if p.VolSize.Present || p.VolMode.Present {
+		t.Error("Properties not fetched should not be present")
+	}
+}
+
+func TestParseCreation(t *testing.T) {
+	if got := ParseCreation("1700000000"); !got.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("ParseCreation(epoch) = %v", got)
+	}
+
+	human := ParseCreation("Tue Nov 14 22:13 2023")
+	if human.Year() != 2023 || human.Month() != time.November || human.Day() != 14 {
+		t.Errorf("ParseCreation(human) = %v", human)
+	}
+
+	if !ParseCreation("-").IsZero() || !ParseCreation("garbage").IsZero() {
+		t.Error("Expected zero time for unparsable values")
+	}
+}
+
+func TestDatasetProperties_Changes(t *testing.T) {
+	prev := parseDatasetProperties(map[string]ZFSProperty{
+		"quota":       {Value: "1024"},
+		"compression": {Value: "lz4"},
+		"readonly":    {Value: "off"},
+		"mounted":     {Value: "yes"},
+	})
+
+	next := prev
+	next.Quota.Value = 0
+	next.Compression.Value = CompressionZstd
+	next.Mounted.Value = false
+	next.Sync = TypedProperty[SyncType]{Value: SyncAlways, Present: true}
+
+	got := strings.Join(next.Changes(prev), " ")
+	want := "quota none compression zstd sync always"
+	if got != want {
+		t.Errorf("Changes() = %q, want %q", got, want)
+	}
+
+	if kv := prev.Changes(prev); len(kv) != 0 {
+		t.Errorf("Expected no changes, got %v", kv)
+	}
+
+	var fresh DatasetProperties
+	fresh.Compression.Value = CompressionLZ4
+	fresh.ReadOnly.Set(false)
+	fresh.RecordSize = NewTypedProperty[uint64](1 << 20)
+	fresh.Atime.Value = false
+
+	got = strings.Join(fresh.Changes(DatasetProperties{}), " ")
+	want = "recordsize 1048576 compression lz4 readonly off"
+	if got != want {
+		t.Errorf("Changes() on fresh properties = %q, want %q", got, want)
+	}
+}
+
+func TestDataset_UpdateProperties(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	mockRunner.AddCommand("zfs list -o "+strings.Join(dsPropList, ",")+" -p tank/app -j", typedPropertiesJSON(), "", nil)
+	mockRunner.AddCommand("zfs set recordsize=1048576 readonly=on tank/app", "", "", nil)
+
+	ds, err := client.Get(ctx, "tank/app", false)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+
+	p := ds.Typed
+	p.RecordSize.Value = 1 << 20
+	p.ReadOnly.Value = true
+
+	if err := ds.UpdateProperties(ctx, p); err != nil {
+		t.Fatalf("UpdateProperties returned error: %v", err)
+	}
+
+	if ds.Typed.RecordSize.Value != 1<<20 || ds.Typed.RecordSize.Source.Type != "LOCAL" || !ds.Typed.ReadOnly.Value {
+		t.Errorf("Typed properties not refreshed: %+v %+v", ds.Typed.RecordSize, ds.Typed.ReadOnly)
+	}
+
+	calls := len(mockRunner.CallHistory)
+	if err := ds.UpdateProperties(ctx, ds.Typed); err != nil {
+		t.Fatalf("UpdateProperties returned error: %v", err)
+	}
+	if len(mockRunner.CallHistory) != calls {
+		t.Error("Expected no command when nothing changed")
+	}
+}
@@ -0,0 +1,358 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotDir is where the snapshots of a mounted file system can be browsed.
+const snapshotDir = ".zfs/snapshot"
+
+// SnapshotFile is a path as it exists in one snapshot.
+type SnapshotFile struct {
+	Snapshot string      `json:"snapshot"`
+	Path     string      `json:"path"`
+	Size     int64       `json:"size"`
+	ModTime  time.Time   `json:"modTime"`
+	Mode     os.FileMode `json:"mode"`
+}
+
+// RestoreOptions controls Dataset.Restore.
+type RestoreOptions struct {
+	// Target is the absolute path to restore to. Empty restores in place.
+	Target string
+	// Overwrite replaces existing files. Directories are merged, so files that only
+	// exist in the target are kept.
+	Overwrite bool
+	// PreserveOwner, PreserveMode and PreserveTimes copy ownership, permission bits
+	// and modification times from the snapshot. Without PreserveMode new files get
+	// 0644 and new directories 0755.
+	PreserveOwner bool
+	PreserveMode  bool
+	PreserveTimes bool
+}
+
+// RestoreResult reports what Restore copied.
+type RestoreResult struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Files    int    `json:"files"`
+	Dirs     int    `json:"dirs"`
+	Symlinks int    `json:"symlinks"`
+	Bytes    int64  `json:"bytes"`
+}
+
+func (d *Dataset) snapshotNames(ctx context.Context) ([]string, error) {
+	all, err := d.z.GetProperties(ctx, []string{d.Name}, []string{"createtxg"},
+		GetOptions{Depth: 1, Types: []DatasetType{DatasetTypeSnapshot}})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(all))
+	for name := range all {
+		if strings.HasPrefix(name, d.Name+"@") {
+			names = append(names, name)
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		ti, tj := ParseUint64(all[names[i]]["createtxg"].Value), ParseUint64(all[names[j]]["createtxg"].Value)
+		if ti != tj {
+			return ti < tj
+		}
+		return names[i] < names[j]
+	})
+
+	return names, nil
+}
+
+// SnapshotFiles returns the snapshots, oldest first, in which rel exists, with its
+// size, mode and modification time in each. Rel is relative to the mountpoint.
+func (d *Dataset) SnapshotFiles(ctx context.Context, rel string) ([]SnapshotFile, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+
+	mountpoint, err := d.z.mountpointOf(ctx, d.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	snaps, err := d.snapshotNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []SnapshotFile{}
+	for _, snap := range snaps {
+		_, short, _ := strings.Cut(snap, "@")
+		p := pathUnder(filepath.Join(mountpoint, snapshotDir, short), rel)
+
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("snapshot_file_stat_failed: %w", err)
+		}
+
+		files = append(files, SnapshotFile{
+			Snapshot: snap,
+			Path:     p,
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+			Mode:     info.Mode(),
+		})
+	}
+
+	return files, nil
+}
+
+// Restore copies rel, a file or directory tree relative to the mountpoint, out of
+// snapshot back into the file system or to opts.Target. Snapshot is either the short
+// name or the full dataset@snap name.
+func (d *Dataset) Restore(ctx context.Context, snapshot, rel string, opts RestoreOptions) (*RestoreResult, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+
+	if ds, short, ok := strings.Cut(snapshot, "@"); ok {
+		if ds != d.Name {
+			return nil, fmt.Errorf("snapshot_not_of_dataset: %s is not a snapshot of %s", snapshot, d.Name)
+		}
+		snapshot = short
+	}
+	if snapshot == "" || strings.ContainsAny(snapshot, "/@") {
+		return nil, fmt.Errorf("invalid_snapshot_name: %q", snapshot)
+	}
+	if opts.Target != "" && !filepath.IsAbs(opts.Target) {
+		return nil, fmt.Errorf("invalid_restore_target: %q is not absolute", opts.Target)
+	}
+
+	mountpoint, err := d.z.mountpointOf(ctx, d.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RestoreResult{
+		Source: pathUnder(filepath.Join(mountpoint, snapshotDir, snapshot), rel),
+		Target: opts.Target,
+	}
+	if res.Target == "" {
+		res.Target = pathUnder(mountpoint, rel)
+	}
+
+	if _, err := os.Lstat(res.Source); err != nil {
+		return nil, fmt.Errorf("restore_source_not_found: %w", err)
+	}
+	if _, err := os.Lstat(res.Target); err == nil && !opts.Overwrite {
+		return nil, fmt.Errorf("restore_target_exists: %s", res.Target)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(res.Target), 0o755); err != nil {
+		return nil, fmt.Errorf("restore_failed: %w", err)
+	}
+
+	if err := restoreTree(ctx, res, opts); err != nil {
+		return res, fmt.Errorf("restore_failed: %w", err)
+	}
+
+	return res, nil
+}
+
+func restoreTree(ctx context.Context, res *RestoreResult, opts RestoreOptions) error {
+	type dirMeta struct {
+		path    string
+		info    fs.FileInfo
+		created bool
+	}
+	var dirs []dirMeta
+
+	err := filepath.WalkDir(res.Source, func(src string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(res.Source, src)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(res.Target, relPath)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			created, err := restoreDir(dst, info, opts)
+			if err != nil {
+				return err
+			}
+			dirs = append(dirs, dirMeta{dst, info, created})
+			res.Dirs++
+		case mode.IsRegular():
+			n, err := restoreFile(src, dst, info, opts)
+			if err != nil {
+				return err
+			}
+			res.Files++
+			res.Bytes += n
+		case mode&fs.ModeSymlink != 0:
+			if err := restoreSymlink(src, dst, info, opts); err != nil {
+				return err
+			}
+			res.Symlinks++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Directory times change as entries are created in them, so set them last.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := applyMetadata(dirs[i].path, dirs[i].info, opts, dirs[i].created); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreDir creates dst unless it already exists and reports whether it did. The
+// directory must stay writable while its entries are restored, so it is created 0700
+// and gets its final mode from applyMetadata once the walk is done.
+func restoreDir(dst string, info fs.FileInfo, opts RestoreOptions) (bool, error) {
+	existing, err := os.Lstat(dst)
+	if err == nil {
+		if !existing.IsDir() {
+			return false, fmt.Errorf("%s exists and is not a directory", dst)
+		}
+		if perm := existing.Mode().Perm(); opts.PreserveMode && perm&0o700 != 0o700 {
+			return false, os.Chmod(dst, perm|0o700)
+		}
+		return false, nil
+	}
+	if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	return true, os.Mkdir(dst, 0o700)
+}
+
+func restoreFile(src, dst string, info fs.FileInfo, opts RestoreOptions) (int64, error) {
+	if existing, err := os.Lstat(dst); err == nil && existing.IsDir() {
+		return 0, fmt.Errorf("%s exists and is a directory", dst)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	// Copy next to the destination and rename so a failed restore never leaves a
+	// truncated file in place of the original.
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".restore-*")
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(tmp, in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = applyMetadata(tmp.Name(), info, opts, true)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func restoreSymlink(src, dst string, info fs.FileInfo, opts RestoreOptions) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+
+	if existing, err := os.Lstat(dst); err == nil {
+		if existing.IsDir() {
+			return fmt.Errorf("%s exists and is a directory", dst)
+		}
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Symlink(target, dst); err != nil {
+		return err
+	}
+
+	if opts.PreserveOwner {
+		if uid, gid, ok := fileOwner(info); ok {
+			return os.Lchown(dst, uid, gid)
+		}
+	}
+
+	return nil
+}
+
+// applyMetadata sets the preserved attributes of info on path. Paths that were just
+// created also get the default mode when the mode is not preserved.
+func applyMetadata(path string, info fs.FileInfo, opts RestoreOptions, created bool) error {
+	if opts.PreserveOwner {
+		if uid, gid, ok := fileOwner(info); ok {
+			if err := os.Lchown(path, uid, gid); err != nil {
+				return err
+			}
+		}
+	}
+
+	if opts.PreserveMode || created {
+		perm := os.FileMode(0o644)
+		if info.IsDir() {
+			perm = 0o755
+		}
+		if opts.PreserveMode {
+			perm = info.Mode().Perm() | info.Mode()&(fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)
+		}
+		if err := os.Chmod(path, perm); err != nil {
+			return err
+		}
+	}
+
+	if opts.PreserveTimes {
+		if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package gzfs
+
+import "io/fs"
+
+func fileOwner(info fs.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
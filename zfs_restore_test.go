@@ -0,0 +1,164 @@
+package gzfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func writeSnapshotFile(t *testing.T, path, content string, mode os.FileMode, mtime time.Time) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newRestoreTestDataset(t *testing.T) (*Dataset, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+
+	mockRunner.AddCommand("zfs mount -j", `{"datasets": {"tank/home": {"name": "tank/home", "mountpoint": "`+root+`"}}}`, "", nil)
+	mockRunner.AddCommand("zfs get -p -d 1 -t snap createtxg tank/home -j", datasetListJSON(
+		testDataset{name: "tank/home@daily-2", props: map[string]string{"createtxg": "300|NONE"}},
+		testDataset{name: "tank/home@daily-1", props: map[string]string{"createtxg": "200|NONE"}},
+		testDataset{name: "tank/home@hourly", props: map[string]string{"createtxg": "250|NONE"}},
+	), "", nil)
+
+	return &Dataset{z: client, Name: "tank/home"}, root
+}
+
+func TestDataset_SnapshotFiles(t *testing.T) {
+	ds, root := newRestoreTestDataset(t)
+	snaps := filepath.Join(root, ".zfs", "snapshot")
+
+	day1 := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	writeSnapshotFile(t, filepath.Join(snaps, "daily-1", "alice", "notes.txt"), "v1", 0o600, day1)
+	writeSnapshotFile(t, filepath.Join(snaps, "daily-2", "alice", "notes.txt"), "version 2", 0o600, day2)
+	os.MkdirAll(filepath.Join(snaps, "hourly", "bob"), 0o755)
+
+	files, err := ds.SnapshotFiles(context.Background(), "alice/notes.txt")
+	if err != nil {
+		t.Fatalf("SnapshotFiles returned error: %v", err)
+	}
+
+	if len(files) != 2 || files[0].Snapshot != "tank/home@daily-1" || files[1].Snapshot != "tank/home@daily-2" {
+		t.Fatalf("Unexpected files: %+v", files)
+	}
+	if files[0].Size != 2 || !files[0].ModTime.Equal(day1) || files[1].Size != 9 {
+		t.Errorf("Unexpected metadata: %+v", files)
+	}
+}
+
+func TestDataset_Restore(t *testing.T) {
+	ctx := context.Background()
+	ds, root := newRestoreTestDataset(t)
+	snap := filepath.Join(root, ".zfs", "snapshot", "daily-1")
+
+	mtime := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	writeSnapshotFile(t, filepath.Join(snap, "alice", "docs", "report.txt"), "quarterly", 0o640, mtime)
+	writeSnapshotFile(t, filepath.Join(snap, "alice", "docs", "sub", "data.csv"), "a,b\n", 0o600, mtime)
+	if err := os.Symlink("report.txt", filepath.Join(snap, "alice", "docs", "latest")); err != nil {
+		t.Fatal(err)
+	}
+
+	writeSnapshotFile(t, filepath.Join(root, "alice", "docs", "report.txt"), "overwritten by mistake", 0o644, time.Now())
+	writeSnapshotFile(t, filepath.Join(root, "alice", "docs", "new.txt"), "keep me", 0o644, time.Now())
+
+	if _, err := ds.Restore(ctx, "daily-1", "alice/docs", RestoreOptions{}); err == nil || !strings.Contains(err.Error(), "restore_target_exists") {
+		t.Fatalf("Expected restore over existing files to be refused, got %v", err)
+	}
+
+	alt := filepath.Join(t.TempDir(), "restored", "docs")
+	res, err := ds.Restore(ctx, "tank/home@daily-1", "alice/docs", RestoreOptions{Target: alt, PreserveMode: true, PreserveTimes: true})
+	if err != nil {
+		t.Fatalf("Restore returned error: %v", err)
+	}
+	if res.Files != 2 || res.Dirs != 2 || res.Symlinks != 1 || res.Bytes != int64(len("quarterly")+len("a,b\n")) {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+
+	info, err := os.Stat(filepath.Join(alt, "report.txt"))
+	if err != nil || info.Mode().Perm() != 0o640 || !info.ModTime().Equal(mtime) {
+		t.Errorf("Metadata not preserved: %v %v", info, err)
+	}
+	if target, _ := os.Readlink(filepath.Join(alt, "latest")); target != "report.txt" {
+		t.Errorf("Symlink not restored: %q", target)
+	}
+
+	if _, err := ds.Restore(ctx, "daily-1", "alice/docs", RestoreOptions{Overwrite: true}); err != nil {
+		t.Fatalf("In-place restore returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, "alice", "docs", "report.txt")); string(got) != "quarterly" {
+		t.Errorf("report.txt = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "alice", "docs", "new.txt")); err != nil {
+		t.Error("Files missing from the snapshot should be kept")
+	}
+
+	if _, err := ds.Restore(ctx, "tank/other@daily-1", "alice", RestoreOptions{}); err == nil {
+		t.Error("Expected error for a snapshot of another dataset")
+	}
+	if _, err := ds.Restore(ctx, "daily-1", "../../etc/passwd", RestoreOptions{Target: "/tmp/x"}); err == nil || !strings.Contains(err.Error(), "restore_source_not_found") {
+		t.Errorf("Expected escaping path to stay inside the snapshot, got %v", err)
+	}
+}
+
+func TestDataset_RestoreReadOnlyDir(t *testing.T) {
+	ctx := context.Background()
+	ds, root := newRestoreTestDataset(t)
+	snap := filepath.Join(root, ".zfs", "snapshot", "daily-1")
+
+	mtime := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	locked := filepath.Join(snap, "app", "locked")
+	writeSnapshotFile(t, filepath.Join(locked, "config.yml"), "port: 80\n", 0o444, mtime)
+	if err := os.Chmod(locked, 0o555); err != nil {
+		t.Fatal(err)
+	}
+
+	alt := filepath.Join(t.TempDir(), "app")
+	t.Cleanup(func() {
+		os.Chmod(locked, 0o755)
+		os.Chmod(filepath.Join(alt, "locked"), 0o755)
+	})
+
+	opts := RestoreOptions{Target: alt, PreserveMode: true}
+	if _, err := ds.Restore(ctx, "daily-1", "app", opts); err != nil {
+		t.Fatalf("Restore returned error: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(alt, "locked"))
+	if err != nil || info.Mode().Perm() != 0o555 {
+		t.Errorf("Directory mode not preserved: %v %v", info, err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(alt, "locked", "config.yml")); string(got) != "port: 80\n" {
+		t.Errorf("config.yml = %q", got)
+	}
+
+	// Restoring again has to write into the now read-only directory.
+	opts.Overwrite = true
+	if _, err := ds.Restore(ctx, "daily-1", "app", opts); err != nil {
+		t.Fatalf("Second restore returned error: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(alt, "locked")); err != nil || info.Mode().Perm() != 0o555 {
+		t.Errorf("Directory mode not restored after overwrite: %v %v", info, err)
+	}
+}
@@ -0,0 +1,425 @@
+package gzfs
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type PropertyKind string
+
+const (
+	PropertyKindString PropertyKind = "string"
+	PropertyKindNumber PropertyKind = "number"
+	PropertyKindSize   PropertyKind = "size"
+	PropertyKindBool   PropertyKind = "bool"
+	PropertyKindEnum   PropertyKind = "enum"
+)
+
+// PropertyTarget is a bit set of the dataset types a property applies to.
+type PropertyTarget uint8
+
+const (
+	TargetFilesystem PropertyTarget = 1 << iota
+	TargetVolume
+	TargetSnapshot
+
+	TargetDataset = TargetFilesystem | TargetVolume
+	TargetAll     = TargetFilesystem | TargetVolume | TargetSnapshot
+)
+
+const (
+	maxUserPropertyNameLen  = 256
+	maxUserPropertyValueLen = 8191
+)
+
+// PropertySchema describes a native ZFS property.
+type PropertySchema struct {
+	Name string
+	Kind PropertyKind
+	// Values lists the accepted values of an enum property.
+	Values []string
+	// Min and Max bound number and size properties when non-zero.
+	Min uint64
+	Max uint64
+	// PowerOfTwo requires size values to be a power of two.
+	PowerOfTwo bool
+	// Special lists extra literal values accepted besides the kind's own syntax,
+	// for example "none" for quotas.
+	Special []string
+
+	ReadOnly    bool
+	CreateOnly  bool
+	Inheritable bool
+	Targets     PropertyTarget
+}
+
+// PropertyError reports why a property assignment was rejected.
+type PropertyError struct {
+	Property string
+	Value    string
+	Reason   string
+}
+
+func (e *PropertyError) Error() string {
+	return fmt.Sprintf("invalid_property %s=%q: %s", e.Property, e.Value, e.Reason)
+}
+
+var (
+	cacheValues    = []string{"all", "none", "metadata"}
+	checksumValues = []string{"on", "off", "fletcher2", "fletcher4", "sha256", "noparity", "sha512", "skein", "edonr", "blake3"}
+	dedupValues    = []string{
+		"off", "on", "verify", "sha256", "sha256,verify", "sha512", "sha512,verify",
+		"skein", "skein,verify", "edonr,verify", "blake3", "blake3,verify",
+	}
+	encryptionValues = []string{
+		"off", "on", "aes-128-ccm", "aes-192-ccm", "aes-256-ccm",
+		"aes-128-gcm", "aes-192-gcm", "aes-256-gcm",
+	}
+	compressionValues = buildCompressionValues()
+)
+
+func buildCompressionValues() []string {
+	values := []string{"on", "off", "lzjb", "gzip", "zle", "lz4", "zstd", "zstd-fast"}
+	for i := 1; i <= 9; i++ {
+		values = append(values, fmt.Sprintf("gzip-%d", i))
+	}
+	for i := 1; i <= 19; i++ {
+		values = append(values, fmt.Sprintf("zstd-%d", i))
+	}
+	for _, level := range []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 500, 1000} {
+		values = append(values, fmt.Sprintf("zstd-fast-%d", level))
+	}
+	return values
+}
+
+func readOnlyProperty(name string, kind PropertyKind, targets PropertyTarget) PropertySchema {
+	return PropertySchema{Name: name, Kind: kind, ReadOnly: true, Targets: targets}
+}
+
+var propertySchemas = func() map[string]PropertySchema {
+	schemas := []PropertySchema{
+		readOnlyProperty("available", PropertyKindSize, TargetDataset),
+		readOnlyProperty("clones", PropertyKindString, TargetSnapshot),
+		readOnlyProperty("compressratio", PropertyKindString, TargetAll),
+		readOnlyProperty("createtxg", PropertyKindNumber, TargetAll),
+		readOnlyProperty("creation", PropertyKindString, TargetAll),
+		readOnlyProperty("defer_destroy", PropertyKindBool, TargetSnapshot),
+		readOnlyProperty("encryptionroot", PropertyKindString, TargetAll),
+		readOnlyProperty("filesystem_count", PropertyKindNumber, TargetFilesystem),
+		readOnlyProperty("guid", PropertyKindNumber, TargetAll),
+		readOnlyProperty("keystatus", PropertyKindString, TargetAll),
+		readOnlyProperty("logicalreferenced", PropertyKindSize, TargetAll),
+		readOnlyProperty("logicalused", PropertyKindSize, TargetDataset),
+		readOnlyProperty("mounted", PropertyKindBool, TargetFilesystem),
+		readOnlyProperty("name", PropertyKindString, TargetAll),
+		readOnlyProperty("objsetid", PropertyKindNumber, TargetAll),
+		readOnlyProperty("origin", PropertyKindString, TargetDataset),
+		readOnlyProperty("receive_resume_token", PropertyKindString, TargetDataset),
+		readOnlyProperty("redact_snaps", PropertyKindString, TargetAll),
+		readOnlyProperty("refcompressratio", PropertyKindString, TargetAll),
+		readOnlyProperty("referenced", PropertyKindSize, TargetAll),
+		readOnlyProperty("snapshot_count", PropertyKindNumber, TargetDataset),
+		readOnlyProperty("snapshots_changed", PropertyKindString, TargetDataset),
+		readOnlyProperty("type", PropertyKindString, TargetAll),
+		readOnlyProperty("used", PropertyKindSize, TargetAll),
+		readOnlyProperty("usedbychildren", PropertyKindSize, TargetDataset),
+		readOnlyProperty("usedbydataset", PropertyKindSize, TargetDataset),
+		readOnlyProperty("usedbyrefreservation", PropertyKindSize, TargetDataset),
+		readOnlyProperty("usedbysnapshots", PropertyKindSize, TargetDataset),
+		readOnlyProperty("userrefs", PropertyKindNumber, TargetSnapshot),
+		readOnlyProperty("written", PropertyKindSize, TargetAll),
+
+		{Name: "aclinherit", Kind: PropertyKindEnum, Values: []string{"discard", "noallow", "restricted", "passthrough", "passthrough-x"}, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "aclmode", Kind: PropertyKindEnum, Values: []string{"discard", "groupmask", "passthrough", "restricted"}, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "acltype", Kind: PropertyKindEnum, Values: []string{"off", "nfsv4", "posix", "noacl", "posixacl"}, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "atime", Kind: PropertyKindBool, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "canmount", Kind: PropertyKindEnum, Values: []string{"on", "off", "noauto"}, Targets: TargetFilesystem},
+		{Name: "casesensitivity", Kind: PropertyKindEnum, Values: []string{"sensitive", "insensitive", "mixed"}, CreateOnly: true, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "checksum", Kind: PropertyKindEnum, Values: checksumValues, Inheritable: true, Targets: TargetDataset},
+		{Name: "compression", Kind: PropertyKindEnum, Values: compressionValues, Inheritable: true, Targets: TargetDataset},
+		{Name: "context", Kind: PropertyKindString, Targets: TargetAll},
+		{Name: "copies", Kind: PropertyKindNumber, Min: 1, Max: 3, Inheritable: true, Targets: TargetDataset},
+		{Name: "dedup", Kind: PropertyKindEnum, Values: dedupValues, Inheritable: true, Targets: TargetDataset},
+		{Name: "defcontext", Kind: PropertyKindString, Targets: TargetAll},
+		{Name: "devices", Kind: PropertyKindBool, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "direct", Kind: PropertyKindEnum, Values: []string{"disabled", "standard", "always"}, Inheritable: true, Targets: TargetDataset},
+		{Name: "dnodesize", Kind: PropertyKindEnum, Values: []string{"legacy", "auto", "1k", "2k", "4k", "8k", "16k"}, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "encryption", Kind: PropertyKindEnum, Values: encryptionValues, CreateOnly: true, Targets: TargetDataset},
+		{Name: "exec", Kind: PropertyKindBool, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "filesystem_limit", Kind: PropertyKindNumber, Special: []string{"none"}, Targets: TargetFilesystem},
+		{Name: "fscontext", Kind: PropertyKindString, Targets: TargetAll},
+		{Name: "jailed", Kind: PropertyKindBool, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "keyformat", Kind: PropertyKindEnum, Values: []string{"raw", "hex", "passphrase"}, CreateOnly: true, Targets: TargetDataset},
+		{Name: "keylocation", Kind: PropertyKindString, Targets: TargetDataset},
+		{Name: "logbias", Kind: PropertyKindEnum, Values: []string{"latency", "throughput"}, Inheritable: true, Targets: TargetDataset},
+		{Name: "mlslabel", Kind: PropertyKindString, Inheritable: true, Targets: TargetDataset},
+		{Name: "mountpoint", Kind: PropertyKindString, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "nbmand", Kind: PropertyKindBool, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "normalization", Kind: PropertyKindEnum, Values: []string{"none", "formC", "formD", "formKC", "formKD"}, CreateOnly: true, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "overlay", Kind: PropertyKindBool, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "pbkdf2iters", Kind: PropertyKindNumber, Min: 100000, CreateOnly: true, Targets: TargetDataset},
+		{Name: "prefetch", Kind: PropertyKindEnum, Values: []string{"none", "metadata", "all"}, Inheritable: true, Targets: TargetDataset},
+		{Name: "primarycache", Kind: PropertyKindEnum, Values: cacheValues, Inheritable: true, Targets: TargetDataset},
+		{Name: "quota", Kind: PropertyKindSize, Special: []string{"none"}, Targets: TargetFilesystem},
+		{Name: "readonly", Kind: PropertyKindBool, Inheritable: true, Targets: TargetDataset},
+		{Name: "recordsize", Kind: PropertyKindSize, Min: 512, Max: 16 << 20, PowerOfTwo: true, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "redundant_metadata", Kind: PropertyKindEnum, Values: []string{"all", "most", "some", "none"}, Inheritable: true, Targets: TargetDataset},
+		{Name: "refquota", Kind: PropertyKindSize, Special: []string{"none"}, Targets: TargetFilesystem},
+		{Name: "refreservation", Kind: PropertyKindSize, Special: []string{"none", "auto"}, Targets: TargetDataset},
+		{Name: "relatime", Kind: PropertyKindBool, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "reservation", Kind: PropertyKindSize, Special: []string{"none"}, Targets: TargetDataset},
+		{Name: "rootcontext", Kind: PropertyKindString, Targets: TargetAll},
+		{Name: "secondarycache", Kind: PropertyKindEnum, Values: cacheValues, Inheritable: true, Targets: TargetDataset},
+		{Name: "setuid", Kind: PropertyKindBool, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "sharenfs", Kind: PropertyKindString, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "sharesmb", Kind: PropertyKindString, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "snapdev", Kind: PropertyKindEnum, Values: []string{"hidden", "visible"}, Inheritable: true, Targets: TargetDataset},
+		{Name: "snapdir", Kind: PropertyKindEnum, Values: []string{"hidden", "visible", "disabled"}, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "snapshot_limit", Kind: PropertyKindNumber, Special: []string{"none"}, Targets: TargetDataset},
+		{Name: "special_small_blocks", Kind: PropertyKindSize, Max: 16 << 20, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "sync", Kind: PropertyKindEnum, Values: []string{"standard", "always", "disabled"}, Inheritable: true, Targets: TargetDataset},
+		{Name: "utf8only", Kind: PropertyKindBool, CreateOnly: true, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "version", Kind: PropertyKindNumber, Min: 1, Max: 5, Special: []string{"current"}, Targets: TargetFilesystem},
+		{Name: "volblocksize", Kind: PropertyKindSize, Min: 512, Max: 16 << 20, PowerOfTwo: true, CreateOnly: true, Targets: TargetVolume},
+		{Name: "volmode", Kind: PropertyKindEnum, Values: []string{"default", "full", "geom", "dev", "none"}, Inheritable: true, Targets: TargetVolume},
+		{Name: "volsize", Kind: PropertyKindSize, Min: 1, Targets: TargetVolume},
+		{Name: "vscan", Kind: PropertyKindBool, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "xattr", Kind: PropertyKindEnum, Values: []string{"on", "off", "dir", "sa"}, Inheritable: true, Targets: TargetFilesystem},
+		{Name: "zoned", Kind: PropertyKindBool, Inheritable: true, Targets: TargetFilesystem},
+	}
+
+	m := make(map[string]PropertySchema, len(schemas))
+	for _, s := range schemas {
+		m[s.Name] = s
+	}
+	return m
+}()
+
+// identityPropertySchemas covers the per-user, group and project properties named
+// prefix@id, such as userquota@alice or projectobjused@42.
+var identityPropertySchemas = func() map[string]PropertySchema {
+	m := make(map[string]PropertySchema)
+	for _, who := range []string{"user", "group", "project"} {
+		m[who+"quota"] = PropertySchema{Kind: PropertyKindSize, Special: []string{"none"}, Targets: TargetFilesystem}
+		m[who+"objquota"] = PropertySchema{Kind: PropertyKindNumber, Special: []string{"none"}, Targets: TargetFilesystem}
+		m[who+"used"] = readOnlyProperty("", PropertyKindSize, TargetFilesystem)
+		m[who+"objused"] = readOnlyProperty("", PropertyKindNumber, TargetFilesystem)
+	}
+	return m
+}()
+
+// LookupPropertySchema returns the schema of a native property, including the
+// per-identity quota and usage properties. Project IDs must be numeric.
+func LookupPropertySchema(name string) (PropertySchema, bool) {
+	if s, ok := propertySchemas[name]; ok {
+		return s, true
+	}
+
+	prefix, id, ok := strings.Cut(name, "@")
+	if !ok || id == "" || strings.ContainsAny(id, "=@ \t\n") {
+		return PropertySchema{}, false
+	}
+
+	s, ok := identityPropertySchemas[prefix]
+	if !ok {
+		return PropertySchema{}, false
+	}
+	if strings.HasPrefix(prefix, "project") {
+		if _, err := strconv.ParseUint(id, 10, 32); err != nil {
+			return PropertySchema{}, false
+		}
+	}
+
+	s.Name = name
+	return s, true
+}
+
+// IsUserProperty reports whether name is a user property (module:property).
+func IsUserProperty(name string) bool {
+	return strings.Contains(name, ":")
+}
+
+func targetForType(t DatasetType) PropertyTarget {
+	switch t {
+	case DatasetTypeFilesystem:
+		return TargetFilesystem
+	case DatasetTypeVolume:
+		return TargetVolume
+	case DatasetTypeSnapshot:
+		return TargetSnapshot
+	default:
+		return 0
+	}
+}
+
+// ParseSizeStrict parses a size such as 4096, 128K, 1.5G or 16MB. Unlike ParseSize it
+// reports malformed input instead of returning zero.
+func ParseSizeStrict(value string) (uint64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	if s == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+
+	num, unit := s[:i], strings.TrimSuffix(s[i:], "B")
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	if unit == "" {
+		return uint64(f), nil
+	}
+
+	shift := strings.Index("KMGTPE", unit)
+	if shift < 0 || len(unit) != 1 {
+		return 0, fmt.Errorf("invalid size unit in %q", value)
+	}
+
+	return uint64(f * float64(uint64(1)<<(10*(shift+1)))), nil
+}
+
+func (s PropertySchema) checkValue(value string) string {
+	for _, special := range s.Special {
+		if value == special {
+			return ""
+		}
+	}
+
+	switch s.Kind {
+	case PropertyKindBool:
+		if value != "on" && value != "off" {
+			return "expected on or off"
+		}
+	case PropertyKindEnum:
+		for _, v := range s.Values {
+			if value == v {
+				return ""
+			}
+		}
+		return "expected one of " + strings.Join(s.Values, ", ")
+	case PropertyKindNumber:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return "expected a non-negative integer"
+		}
+		return s.checkRange(n, strconv.FormatUint(s.Min, 10), strconv.FormatUint(s.Max, 10))
+	case PropertyKindSize:
+		n, err := ParseSizeStrict(value)
+		if err != nil {
+			return err.Error()
+		}
+		if s.PowerOfTwo && bits.OnesCount64(n) != 1 {
+			return "must be a power of two"
+		}
+		return s.checkRange(n, formatSizeHuman(s.Min), formatSizeHuman(s.Max))
+	case PropertyKindString:
+		if strings.ContainsAny(value, "\n\x00") {
+			return "must not contain newlines or NUL bytes"
+		}
+	}
+
+	return ""
+}
+
+func (s PropertySchema) checkRange(n uint64, minLabel, maxLabel string) string {
+	if s.Min != 0 && n < s.Min {
+		if s.Max != 0 {
+			return fmt.Sprintf("must be between %s and %s", minLabel, maxLabel)
+		}
+		return fmt.Sprintf("must be at least %s", minLabel)
+	}
+	if s.Max != 0 && n > s.Max {
+		if s.Min != 0 {
+			return fmt.Sprintf("must be between %s and %s", minLabel, maxLabel)
+		}
+		return fmt.Sprintf("must be at most %s", maxLabel)
+	}
+	return ""
+}
+
+func formatSizeHuman(n uint64) string {
+	for _, unit := range []string{"E", "P", "T", "G", "M", "K"} {
+		shift := 10 * (strings.Index("KMGTPE", unit) + 1)
+		if n >= 1<<shift && n%(1<<shift) == 0 {
+			return fmt.Sprintf("%d%s", n>>shift, unit)
+		}
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+// ValidateProperty checks a single assignment against the schema. t may be empty
+// when the dataset type is unknown; creating allows create-time-only properties.
+// Names the schema does not know are accepted; use LookupPropertySchema to reject them.
+func ValidateProperty(t DatasetType, name, value string, creating bool) error {
+	if name == "" {
+		return &PropertyError{Property: name, Value: value, Reason: "property name is empty"}
+	}
+
+	if IsUserProperty(name) {
+		if len(name) > maxUserPropertyNameLen {
+			return &PropertyError{Property: name, Value: value, Reason: "user property name is too long"}
+		}
+		if len(value) > maxUserPropertyValueLen {
+			return &PropertyError{Property: name, Value: value, Reason: "user property value exceeds 8191 bytes"}
+		}
+		return nil
+	}
+
+	schema, ok := LookupPropertySchema(name)
+	if !ok {
+		if prefix, _, found := strings.Cut(name, "@"); found {
+			if _, known := identityPropertySchemas[prefix]; known {
+				return &PropertyError{Property: name, Value: value, Reason: "invalid identity in property name"}
+			}
+		}
+		// Properties missing from the schema, such as ones added in newer OpenZFS
+		// releases, are passed through for zfs itself to validate.
+		return nil
+	}
+
+	if schema.ReadOnly {
+		return &PropertyError{Property: name, Value: value, Reason: "property is read-only"}
+	}
+
+	if schema.CreateOnly && !creating {
+		return &PropertyError{Property: name, Value: value, Reason: "property can only be set at creation time"}
+	}
+
+	if target := targetForType(t); target != 0 && schema.Targets&target == 0 {
+		return &PropertyError{Property: name, Value: value, Reason: fmt.Sprintf("property does not apply to %s datasets", strings.ToLower(string(t)))}
+	}
+
+	if reason := schema.checkValue(value); reason != "" {
+		return &PropertyError{Property: name, Value: value, Reason: reason}
+	}
+
+	return nil
+}
+
+// ValidateProperties validates every assignment in props and returns all failures
+// joined, ordered by property name.
+func ValidateProperties(t DatasetType, props map[string]string, creating bool) error {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := ValidateProperty(t, name, props[name], creating); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,164 @@
+package gzfs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func TestParseSizeStrict(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    uint64
+		expectError bool
+	}{
+		{"4096", 4096, false},
+		{"128K", 128 << 10, false},
+		{"128k", 128 << 10, false},
+		{"16M", 16 << 20, false},
+		{"1.5G", 3 << 29, false},
+		{"2TB", 2 << 40, false},
+		{"", 0, true},
+		{"abc", 0, true},
+		{"12Q", 0, true},
+		{"-1", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSizeStrict(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %d", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseSizeStrict(%q) = %d, want %d", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateProperty(t *testing.T) {
+	tests := []struct {
+		name     string
+		dsType   DatasetType
+		prop     string
+		value    string
+		creating bool
+		reason   string
+	}{
+		{"valid recordsize", DatasetTypeFilesystem, "recordsize", "1M", false, ""},
+		{"recordsize too small", DatasetTypeFilesystem, "recordsize", "256", false, "must be between 512 and 16M"},
+		{"recordsize too large", DatasetTypeFilesystem, "recordsize", "32M", false, "must be between 512 and 16M"},
+		{"recordsize not power of two", DatasetTypeFilesystem, "recordsize", "96K", false, "power of two"},
+		{"volblocksize on filesystem", DatasetTypeFilesystem, "volblocksize", "16K", true, "does not apply to filesystem"},
+		{"volblocksize after create", DatasetTypeVolume, "volblocksize", "16K", false, "creation time"},
+		{"volblocksize at create", DatasetTypeVolume, "volblocksize", "16K", true, ""},
+		{"read-only property", DatasetTypeFilesystem, "used", "10", false, "read-only"},
+		{"volblocksize 16M", DatasetTypeVolume, "volblocksize", "16M", true, ""},
+		{"volblocksize too large", DatasetTypeVolume, "volblocksize", "32M", true, "must be between 512 and 16M"},
+		{"unknown property passes through", DatasetTypeVolume, "volthreading", "off", false, ""},
+		{"unknown default quota passes through", DatasetTypeFilesystem, "defaultuserquota", "10G", false, ""},
+		{"bad enum", DatasetTypeFilesystem, "compression", "brotli", false, "expected one of"},
+		{"zstd level", DatasetTypeVolume, "compression", "zstd-19", false, ""},
+		{"bad bool", DatasetTypeFilesystem, "atime", "yes", false, "expected on or off"},
+		{"quota none", DatasetTypeFilesystem, "quota", "none", false, ""},
+		{"quota on volume", DatasetTypeVolume, "quota", "10G", false, "does not apply to volume"},
+		{"copies range", DatasetTypeFilesystem, "copies", "4", false, "must be between 1 and 3"},
+		{"unknown type skips target check", "", "volblocksize", "16K", true, ""},
+		{"user quota", DatasetTypeFilesystem, "userquota@alice", "10G", false, ""},
+		{"group object quota none", DatasetTypeFilesystem, "groupobjquota@staff", "none", false, ""},
+		{"project quota", "", "projectquota@42", "1T", false, ""},
+		{"project quota with name", DatasetTypeFilesystem, "projectquota@web", "1T", false, "invalid identity"},
+		{"bad user quota", DatasetTypeFilesystem, "userquota@alice", "lots", false, "invalid"},
+		{"user quota on volume", DatasetTypeVolume, "userquota@alice", "10G", false, "does not apply to volume"},
+		{"user used", DatasetTypeFilesystem, "userused@alice", "10", false, "read-only"},
+		{"unknown identity property passes through", DatasetTypeFilesystem, "userlimit@alice", "10", false, ""},
+		{"user property", DatasetTypeSnapshot, "com.ourco:owner", "alice", false, ""},
+		{"user property too long", DatasetTypeFilesystem, "com.ourco:blob", strings.Repeat("x", 8192), false, "exceeds 8191"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateProperty(tt.dsType, tt.prop, tt.value, tt.creating)
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			var perr *PropertyError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Expected *PropertyError, got %v", err)
+			}
+			if perr.Property != tt.prop {
+				t.Errorf("Expected property %q, got %q", tt.prop, perr.Property)
+			}
+			if !strings.Contains(perr.Reason, tt.reason) {
+				t.Errorf("Expected reason containing %q, got %q", tt.reason, perr.Reason)
+			}
+		})
+	}
+}
+
+func TestValidateProperties(t *testing.T) {
+	err := ValidateProperties(DatasetTypeFilesystem, map[string]string{
+		"recordsize":  "3K",
+		"compression": "lz4",
+		"atime":       "maybe",
+	}, false)
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+
+	msg := err.Error()
+	if !strings.Contains(msg, "atime") || !strings.Contains(msg, "recordsize") || strings.Contains(msg, "compression") {
+		t.Errorf("Unexpected joined error: %s", msg)
+	}
+	if strings.Index(msg, "atime") > strings.Index(msg, "recordsize") {
+		t.Errorf("Errors should be ordered by property name: %s", msg)
+	}
+}
+
+func TestSetPropertiesValidation(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	ds := &Dataset{z: client, Name: "tank/app", Type: DatasetTypeFilesystem}
+	if err := ds.SetProperties(ctx, "volsize", "10G"); err == nil {
+		t.Fatal("Expected volsize on filesystem to be rejected")
+	}
+
+	if _, err := client.CreateFilesystem(ctx, "tank/new", map[string]string{"recordsize": "100K"}); err == nil {
+		t.Fatal("Expected invalid recordsize to be rejected on create")
+	}
+
+	if _, err := client.CreateVolume(ctx, "tank/vol", 1<<30, map[string]string{"sparse": "on", "recordsize": "128K"}); err == nil {
+		t.Fatal("Expected recordsize on volume to be rejected")
+	}
+
+	if len(mockRunner.CallHistory) != 0 {
+		t.Errorf("Expected no commands to run, got %d", len(mockRunner.CallHistory))
+	}
+
+	mockRunner.AddCommand("zfs set compression=zstd tank/app", "", "", nil)
+	if err := ds.SetProperties(ctx, "compression", "zstd"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,576 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ShareStyle is the sharenfs option syntax of the platform: exportfs options on Linux
+// and exports(5) options on FreeBSD.
+type ShareStyle string
+
+const (
+	ShareStyleLinux   ShareStyle = "linux"
+	ShareStyleFreeBSD ShareStyle = "freebsd"
+)
+
+// ShareProtocol selects the protocol for ShareAll and UnshareAll.
+type ShareProtocol string
+
+const (
+	ShareNFS ShareProtocol = "nfs"
+	ShareSMB ShareProtocol = "smb"
+)
+
+// DefaultShareStyle returns the sharenfs syntax of the running platform. It only
+// applies to zfs commands run locally.
+func DefaultShareStyle() ShareStyle {
+	if runtime.GOOS == "freebsd" {
+		return ShareStyleFreeBSD
+	}
+	return ShareStyleLinux
+}
+
+// nfsShareStyle returns Options.ShareStyle, or the local platform's style when zfs
+// runs on this machine. The host behind any other Runner is unknown.
+func (z *zfs) nfsShareStyle() (ShareStyle, error) {
+	if z.shareStyle != "" {
+		return z.shareStyle, nil
+	}
+
+	switch z.cmd.Runner.(type) {
+	case nil, LocalRunner, *LocalRunner:
+		return DefaultShareStyle(), nil
+	default:
+		return "", fmt.Errorf("share_style_required: set Options.ShareStyle for a remote runner")
+	}
+}
+
+// NFSShareOptions is a typed sharenfs value. The zero value shares read-write to
+// everyone with root squashed, which renders as "on".
+type NFSShareOptions struct {
+	// Hosts restricts access to these host names, addresses and CIDR networks. Empty
+	// means everyone.
+	Hosts []string `json:"hosts,omitempty"`
+	// ReadOnly exports the file system read-only to Hosts.
+	ReadOnly bool `json:"readOnly"`
+	// ReadOnlyHosts are given read-only access while Hosts stay read-write. Linux only.
+	ReadOnlyHosts []string `json:"readOnlyHosts,omitempty"`
+	// NoRootSquash lets remote root act as root (no_root_squash, -maproot=root).
+	NoRootSquash bool `json:"noRootSquash"`
+	// AllSquash maps every remote user to nobody (all_squash, -mapall=nobody).
+	AllSquash bool `json:"allSquash"`
+	// Security lists the allowed security flavours, such as sys or krb5p.
+	Security []string `json:"security,omitempty"`
+	// Extra holds options that are passed through unchanged.
+	Extra []string `json:"extra,omitempty"`
+}
+
+// ShareInfo describes a shared file system.
+type ShareInfo struct {
+	Dataset    string `json:"dataset"`
+	Mountpoint string `json:"mountpoint"`
+	// NFS holds the parsed sharenfs options, or nil when NFS sharing is off.
+	NFS    *NFSShareOptions             `json:"nfs,omitempty"`
+	NFSRaw string                       `json:"nfsRaw"`
+	SMB    bool                         `json:"smb"`
+	SMBRaw string                       `json:"smbRaw"`
+	Source map[string]ZFSPropertySource `json:"source"`
+}
+
+func isCIDR(host string) bool {
+	_, _, err := net.ParseCIDR(host)
+	return err == nil
+}
+
+func validateShareHosts(hosts []string) error {
+	for _, h := range hosts {
+		if h == "" || (strings.ContainsAny(h, ",: \t=[]") && !isCIDR(h) && net.ParseIP(h) == nil) {
+			return fmt.Errorf("invalid_share_host: %q", h)
+		}
+	}
+	return nil
+}
+
+// linuxHostList joins hosts with colons. Networks get an @ prefix and IPv6 addresses
+// are bracketed so their colons are not taken as separators.
+func linuxHostList(hosts []string) string {
+	list := make([]string, len(hosts))
+	for i, h := range hosts {
+		addr, bits, _ := strings.Cut(h, "/")
+		if strings.Contains(addr, ":") {
+			addr = "[" + addr + "]"
+		}
+
+		if isCIDR(h) {
+			list[i] = "@" + addr + "/" + bits
+		} else {
+			list[i] = addr
+		}
+	}
+	return strings.Join(list, ":")
+}
+
+func (o NFSShareOptions) renderLinux() (string, error) {
+	var opts []string
+
+	switch {
+	case len(o.Hosts) == 0 && o.ReadOnly:
+		opts = append(opts, "ro")
+	case len(o.Hosts) == 0 && len(o.ReadOnlyHosts) > 0:
+		return "", fmt.Errorf("invalid_share_options: read-only hosts need read-write hosts or ReadOnly")
+	case len(o.Hosts) > 0 && o.ReadOnly:
+		opts = append(opts, "ro="+linuxHostList(append(append([]string{}, o.Hosts...), o.ReadOnlyHosts...)))
+	case len(o.Hosts) > 0:
+		opts = append(opts, "rw="+linuxHostList(o.Hosts))
+		if len(o.ReadOnlyHosts) > 0 {
+			opts = append(opts, "ro="+linuxHostList(o.ReadOnlyHosts))
+		}
+	}
+
+	if o.NoRootSquash {
+		opts = append(opts, "no_root_squash")
+	}
+	if o.AllSquash {
+		opts = append(opts, "all_squash")
+	}
+	if len(o.Security) > 0 {
+		opts = append(opts, "sec="+strings.Join(o.Security, ":"))
+	}
+
+	return strings.Join(append(opts, o.Extra...), ","), nil
+}
+
+func (o NFSShareOptions) renderFreeBSD() (string, error) {
+	if len(o.ReadOnlyHosts) > 0 {
+		return "", fmt.Errorf("invalid_share_options: per-host read-only access is not supported on FreeBSD")
+	}
+
+	var opts, hosts []string
+	var network string
+
+	for _, h := range o.Hosts {
+		if !isCIDR(h) {
+			hosts = append(hosts, h)
+			continue
+		}
+		if network != "" {
+			return "", fmt.Errorf("invalid_share_options: FreeBSD exports allow one network per share")
+		}
+		network = h
+	}
+
+	if o.ReadOnly {
+		opts = append(opts, "-ro")
+	}
+	if o.NoRootSquash {
+		opts = append(opts, "-maproot=root")
+	}
+	if o.AllSquash {
+		opts = append(opts, "-mapall=nobody")
+	}
+	if len(o.Security) > 0 {
+		opts = append(opts, "-sec="+strings.Join(o.Security, ":"))
+	}
+	opts = append(opts, o.Extra...)
+	if network != "" {
+		opts = append(opts, "-network="+network)
+	}
+
+	return strings.Join(append(opts, hosts...), " "), nil
+}
+
+// Render returns the sharenfs value for o in the given style.
+func (o NFSShareOptions) Render(style ShareStyle) (string, error) {
+	if o.NoRootSquash && o.AllSquash {
+		return "", fmt.Errorf("invalid_share_options: NoRootSquash and AllSquash are mutually exclusive")
+	}
+	if err := validateShareHosts(append(append([]string{}, o.Hosts...), o.ReadOnlyHosts...)); err != nil {
+		return "", err
+	}
+	for _, e := range o.Extra {
+		if e == "" || strings.Contains(e, ",") {
+			return "", fmt.Errorf("invalid_share_option: %q", e)
+		}
+	}
+
+	var value string
+	var err error
+
+	switch style {
+	case ShareStyleLinux:
+		value, err = o.renderLinux()
+	case ShareStyleFreeBSD:
+		value, err = o.renderFreeBSD()
+	default:
+		return "", fmt.Errorf("invalid_share_style: %q", style)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if value == "" {
+		return "on", nil
+	}
+	return value, nil
+}
+
+func parseLinuxHostList(list string) []string {
+	var hosts []string
+	add := func(h string) {
+		h = strings.NewReplacer("[", "", "]", "").Replace(strings.TrimPrefix(h, "@"))
+		if h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+
+	start, bracketed := 0, false
+	for i, c := range list {
+		switch {
+		case c == '[':
+			bracketed = true
+		case c == ']':
+			bracketed = false
+		case c == ':' && !bracketed:
+			add(list[start:i])
+			start = i + 1
+		}
+	}
+	add(list[start:])
+
+	return hosts
+}
+
+func parseNFSLinux(value string) *NFSShareOptions {
+	o := &NFSShareOptions{}
+
+	var rw, ro []string
+	for _, opt := range strings.Split(value, ",") {
+		key, arg, hasArg := strings.Cut(opt, "=")
+		switch {
+		case opt == "":
+		case opt == "rw":
+		case opt == "ro":
+			o.ReadOnly = true
+		case key == "rw" && hasArg:
+			rw = append(rw, parseLinuxHostList(arg)...)
+		case key == "ro" && hasArg:
+			ro = append(ro, parseLinuxHostList(arg)...)
+		case opt == "no_root_squash":
+			o.NoRootSquash = true
+		case opt == "root_squash":
+		case opt == "all_squash":
+			o.AllSquash = true
+		case key == "sec" && hasArg:
+			o.Security = strings.Split(arg, ":")
+		default:
+			o.Extra = append(o.Extra, opt)
+		}
+	}
+
+	if len(rw) > 0 {
+		o.Hosts, o.ReadOnlyHosts = rw, ro
+	} else if len(ro) > 0 {
+		o.Hosts, o.ReadOnly = ro, true
+	}
+
+	return o
+}
+
+func maskToPrefix(network, mask string) string {
+	m := net.ParseIP(mask)
+	if m == nil || m.To4() == nil {
+		return network
+	}
+	ones, bits := net.IPMask(m.To4()).Size()
+	if bits == 0 {
+		return network
+	}
+	return network + "/" + strconv.Itoa(ones)
+}
+
+func parseNFSFreeBSD(value string) *NFSShareOptions {
+	o := &NFSShareOptions{}
+
+	fields := strings.Fields(value)
+	var network, mask string
+
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		key, arg, hasArg := strings.Cut(f, "=")
+
+		// -network and -mask also accept their argument as the next word.
+		if (key == "-network" || key == "-mask") && !hasArg && i+1 < len(fields) {
+			i++
+			arg, hasArg = fields[i], true
+		}
+
+		switch {
+		case f == "-ro" || f == "-o":
+			o.ReadOnly = true
+		case key == "-maproot" && (arg == "root" || arg == "0"):
+			o.NoRootSquash = true
+		case key == "-mapall" && (arg == "nobody" || arg == "-2"):
+			o.AllSquash = true
+		case key == "-sec" && hasArg:
+			o.Security = strings.Split(arg, ":")
+		case key == "-network" && hasArg:
+			network = arg
+		case key == "-mask" && hasArg:
+			mask = arg
+		case strings.HasPrefix(f, "-"):
+			o.Extra = append(o.Extra, f)
+		default:
+			o.Hosts = append(o.Hosts, f)
+		}
+	}
+
+	if network != "" {
+		if mask != "" && !strings.Contains(network, "/") {
+			network = maskToPrefix(network, mask)
+		}
+		o.Hosts = append(o.Hosts, network)
+	}
+
+	return o
+}
+
+// ParseNFSShareOptions parses a sharenfs value. It returns nil when NFS sharing is off.
+// Options it does not model are kept in Extra.
+func ParseNFSShareOptions(value string, style ShareStyle) (*NFSShareOptions, error) {
+	value = strings.TrimSpace(value)
+
+	switch value {
+	case "", "-", "off":
+		return nil, nil
+	case "on":
+		return &NFSShareOptions{}, nil
+	}
+
+	switch style {
+	case ShareStyleLinux:
+		return parseNFSLinux(value), nil
+	case ShareStyleFreeBSD:
+		return parseNFSFreeBSD(value), nil
+	default:
+		return nil, fmt.Errorf("invalid_share_style: %q", style)
+	}
+}
+
+// SetNFSShare sets sharenfs on dataset from opts in the syntax of the zfs host. A nil
+// opts turns NFS sharing off.
+func (z *zfs) SetNFSShare(ctx context.Context, dataset string, opts *NFSShareOptions) error {
+	if dataset == "" {
+		return fmt.Errorf("dataset name is empty")
+	}
+
+	value := "off"
+	if opts != nil {
+		style, err := z.nfsShareStyle()
+		if err != nil {
+			return err
+		}
+		v, err := opts.Render(style)
+		if err != nil {
+			return err
+		}
+		value = v
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, "set", "sharenfs="+value, dataset); err != nil {
+		return fmt.Errorf("set_sharenfs_failed: %w", err)
+	}
+
+	return nil
+}
+
+// SetSMBShare turns SMB sharing of dataset on or off.
+func (z *zfs) SetSMBShare(ctx context.Context, dataset string, enabled bool) error {
+	if dataset == "" {
+		return fmt.Errorf("dataset name is empty")
+	}
+
+	value := "off"
+	if enabled {
+		value = "on"
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, "set", "sharesmb="+value, dataset); err != nil {
+		return fmt.Errorf("set_sharesmb_failed: %w", err)
+	}
+
+	return nil
+}
+
+// Share shares dataset with the protocols enabled by its sharenfs and sharesmb.
+func (z *zfs) Share(ctx context.Context, dataset string) error {
+	if dataset == "" {
+		return fmt.Errorf("dataset name is empty")
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, "share", dataset); err != nil {
+		return fmt.Errorf("share_failed: %w", err)
+	}
+
+	return nil
+}
+
+// Unshare stops sharing dataset.
+func (z *zfs) Unshare(ctx context.Context, dataset string) error {
+	if dataset == "" {
+		return fmt.Errorf("dataset name is empty")
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, "unshare", dataset); err != nil {
+		return fmt.Errorf("unshare_failed: %w", err)
+	}
+
+	return nil
+}
+
+func shareAllArgs(cmd string, protocol ShareProtocol) ([]string, error) {
+	args := []string{cmd, "-a"}
+
+	switch protocol {
+	case "":
+	case ShareNFS, ShareSMB:
+		args = append(args, string(protocol))
+	default:
+		return nil, fmt.Errorf("invalid_share_protocol: %q", protocol)
+	}
+
+	return args, nil
+}
+
+// ShareAll shares every mounted file system with sharing enabled, limited to protocol
+// unless it is empty.
+func (z *zfs) ShareAll(ctx context.Context, protocol ShareProtocol) error {
+	args, err := shareAllArgs("share", protocol)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, args...); err != nil {
+		return fmt.Errorf("share_failed: %w", err)
+	}
+
+	return nil
+}
+
+// UnshareAll stops sharing every file system, limited to protocol unless it is empty.
+func (z *zfs) UnshareAll(ctx context.Context, protocol ShareProtocol) error {
+	args, err := shareAllArgs("unshare", protocol)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, args...); err != nil {
+		return fmt.Errorf("unshare_failed: %w", err)
+	}
+
+	return nil
+}
+
+// Shares returns the mounted file systems under root, or in all pools when root is
+// empty, that have NFS or SMB sharing enabled, with their effective options.
+func (z *zfs) Shares(ctx context.Context, root string) ([]ShareInfo, error) {
+	var names []string
+	opts := GetOptions{Types: []DatasetType{DatasetTypeFilesystem}}
+	if root != "" {
+		names = []string{root}
+		opts.Recursive = true
+	}
+
+	style, err := z.nfsShareStyle()
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := z.GetProperties(ctx, names, []string{"sharenfs", "sharesmb", "mounted", "mountpoint"}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	shares := []ShareInfo{}
+	for name, props := range all {
+		if !parseOnOff(props["mounted"].Value) {
+			continue
+		}
+
+		info := ShareInfo{
+			Dataset:    name,
+			Mountpoint: props["mountpoint"].Value,
+			NFSRaw:     ParseString(props["sharenfs"].Value),
+			SMBRaw:     ParseString(props["sharesmb"].Value),
+			Source: map[string]ZFSPropertySource{
+				"sharenfs": props["sharenfs"].Source,
+				"sharesmb": props["sharesmb"].Source,
+			},
+		}
+
+		nfs, err := ParseNFSShareOptions(info.NFSRaw, style)
+		if err != nil {
+			return nil, err
+		}
+		info.NFS = nfs
+		info.SMB = info.SMBRaw != "" && info.SMBRaw != "off"
+
+		if info.NFS == nil && !info.SMB {
+			continue
+		}
+
+		shares = append(shares, info)
+	}
+
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Dataset < shares[j].Dataset })
+	return shares, nil
+}
+
+func (d *Dataset) SetNFSShare(ctx context.Context, opts *NFSShareOptions) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.SetNFSShare(ctx, d.Name, opts)
+}
+
+func (d *Dataset) SetSMBShare(ctx context.Context, enabled bool) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.SetSMBShare(ctx, d.Name, enabled)
+}
+
+func (d *Dataset) Share(ctx context.Context) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.Share(ctx, d.Name)
+}
+
+func (d *Dataset) Unshare(ctx context.Context) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.Unshare(ctx, d.Name)
+}
@@ -0,0 +1,177 @@
+package gzfs
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func TestNFSShareOptions_Render(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    NFSShareOptions
+		linux   string
+		freebsd string
+	}{
+		{"default", NFSShareOptions{}, "on", "on"},
+		{"read-only", NFSShareOptions{ReadOnly: true}, "ro", "-ro"},
+		{
+			"hosts",
+			NFSShareOptions{Hosts: []string{"10.0.0.0/24", "backup.lan"}, NoRootSquash: true, Security: []string{"sys", "krb5"}},
+			"rw=@10.0.0.0/24:backup.lan,no_root_squash,sec=sys:krb5",
+			"-maproot=root -sec=sys:krb5 -network=10.0.0.0/24 backup.lan",
+		},
+		{
+			"squash",
+			NFSShareOptions{Hosts: []string{"client"}, ReadOnly: true, AllSquash: true, Extra: []string{"async"}},
+			"ro=client,all_squash,async",
+			"-ro -mapall=nobody async client",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for style, want := range map[ShareStyle]string{ShareStyleLinux: tt.linux, ShareStyleFreeBSD: tt.freebsd} {
+				if got, err := tt.opts.Render(style); err != nil || got != want {
+					t.Errorf("Render(%s) = %q, %v, want %q", style, got, err, want)
+				}
+			}
+		})
+	}
+
+	mixed := NFSShareOptions{Hosts: []string{"admin"}, ReadOnlyHosts: []string{"10.1.0.0/16"}}
+	if got, err := mixed.Render(ShareStyleLinux); err != nil || got != "rw=admin,ro=@10.1.0.0/16" {
+		t.Errorf("Render mixed = %q, %v", got, err)
+	}
+	if _, err := mixed.Render(ShareStyleFreeBSD); err == nil {
+		t.Error("Expected error for per-host read-only access on FreeBSD")
+	}
+
+	for _, bad := range []NFSShareOptions{
+		{NoRootSquash: true, AllSquash: true},
+		{Hosts: []string{"a,b"}},
+		{Hosts: []string{"10.0.0.0/8", "192.168.0.0/16"}},
+	} {
+		if _, err := bad.Render(ShareStyleFreeBSD); err == nil {
+			t.Errorf("Expected error for %+v", bad)
+		}
+	}
+}
+
+func TestParseNFSShareOptions(t *testing.T) {
+	tests := []struct {
+		value string
+		style ShareStyle
+		want  *NFSShareOptions
+	}{
+		{"off", ShareStyleLinux, nil},
+		{"on", ShareStyleFreeBSD, &NFSShareOptions{}},
+		{
+			"rw=@10.0.0.0/24:backup.lan,ro=guest,no_root_squash,sec=sys,crossmnt",
+			ShareStyleLinux,
+			&NFSShareOptions{Hosts: []string{"10.0.0.0/24", "backup.lan"}, ReadOnlyHosts: []string{"guest"}, NoRootSquash: true, Security: []string{"sys"}, Extra: []string{"crossmnt"}},
+		},
+		{
+			"ro=client,all_squash",
+			ShareStyleLinux,
+			&NFSShareOptions{Hosts: []string{"client"}, ReadOnly: true, AllSquash: true},
+		},
+		{
+			"-ro -maproot=root -alldirs -network 192.168.1.0 -mask 255.255.255.0 nas",
+			ShareStyleFreeBSD,
+			&NFSShareOptions{Hosts: []string{"nas", "192.168.1.0/24"}, ReadOnly: true, NoRootSquash: true, Extra: []string{"-alldirs"}},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseNFSShareOptions(tt.value, tt.style)
+		if err != nil {
+			t.Errorf("ParseNFSShareOptions(%q) returned error: %v", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseNFSShareOptions(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+
+	opts := NFSShareOptions{Hosts: []string{"10.0.0.0/24"}, NoRootSquash: true, Security: []string{"krb5p"}}
+	for _, style := range []ShareStyle{ShareStyleLinux, ShareStyleFreeBSD} {
+		value, _ := opts.Render(style)
+		if got, err := ParseNFSShareOptions(value, style); err != nil || !reflect.DeepEqual(*got, opts) {
+			t.Errorf("%s round trip of %q = %+v, %v", style, value, got, err)
+		}
+	}
+
+	v6 := NFSShareOptions{Hosts: []string{"fd00::/64", "fd00::1", "backup.lan"}, ReadOnlyHosts: []string{"2001:db8::7"}}
+	value, err := v6.Render(ShareStyleLinux)
+	if want := "rw=@[fd00::]/64:[fd00::1]:backup.lan,ro=[2001:db8::7]"; err != nil || value != want {
+		t.Errorf("Render IPv6 = %q, %v, want %q", value, err, want)
+	}
+	if got, err := ParseNFSShareOptions(value, ShareStyleLinux); err != nil || !reflect.DeepEqual(*got, v6) {
+		t.Errorf("linux round trip of %q = %+v, %v", value, got, err)
+	}
+
+	if _, err := (NFSShareOptions{Hosts: []string{"[fd00::1]"}}).Render(ShareStyleLinux); err == nil {
+		t.Error("Expected error for a bracketed host")
+	}
+}
+
+func TestZFS_NFSShareStyle(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+	remote := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+
+	if err := remote.SetNFSShare(ctx, "tank/media", &NFSShareOptions{ReadOnly: true}); err == nil || !strings.Contains(err.Error(), "share_style_required") {
+		t.Errorf("Expected a remote runner to need an explicit style, got %v", err)
+	}
+	if len(mockRunner.CallHistory) != 0 {
+		t.Error("No command should run without a share style")
+	}
+
+	if style, err := (&zfs{cmd: Cmd{Bin: "zfs"}}).nfsShareStyle(); err != nil || style != DefaultShareStyle() {
+		t.Errorf("Local runner style = %q, %v", style, err)
+	}
+
+	remote.shareStyle = ShareStyleFreeBSD
+	mockRunner.AddCommand("zfs set sharenfs=-ro tank/media", "", "", nil)
+	if err := remote.SetNFSShare(ctx, "tank/media", &NFSShareOptions{ReadOnly: true}); err != nil {
+		t.Errorf("SetNFSShare returned error: %v", err)
+	}
+}
+
+func TestZFS_Shares(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}, shareStyle: ShareStyleLinux}
+
+	mockRunner.AddCommand("zfs get -p -r -t fs sharenfs,sharesmb,mounted,mountpoint tank -j", datasetListJSON(
+		testDataset{name: "tank", props: map[string]string{
+			"sharenfs": "off|DEFAULT", "sharesmb": "off|DEFAULT", "mounted": "yes|NONE", "mountpoint": "/tank|DEFAULT",
+		}},
+		testDataset{name: "tank/media", props: map[string]string{
+			"sharenfs": "on|LOCAL", "sharesmb": "on|LOCAL", "mounted": "yes|NONE", "mountpoint": "/tank/media|DEFAULT",
+		}},
+		testDataset{name: "tank/media/old", props: map[string]string{
+			"sharenfs": "on|INHERITED|tank/media", "sharesmb": "on|INHERITED|tank/media", "mounted": "no|NONE", "mountpoint": "/tank/media/old|DEFAULT",
+		}},
+	), "", nil)
+
+	shares, err := client.Shares(ctx, "tank")
+	if err != nil {
+		t.Fatalf("Shares returned error: %v", err)
+	}
+	if len(shares) != 1 || shares[0].Dataset != "tank/media" || shares[0].NFS == nil || !shares[0].SMB {
+		t.Errorf("Unexpected shares: %+v", shares)
+	}
+
+	mockRunner.AddCommand("zfs share -a nfs", "", "", nil)
+	if err := client.ShareAll(ctx, ShareNFS); err != nil {
+		t.Errorf("ShareAll returned error: %v", err)
+	}
+	if err := client.UnshareAll(ctx, "afp"); err == nil {
+		t.Error("Expected error for an unknown protocol")
+	}
+}
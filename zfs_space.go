@@ -0,0 +1,282 @@
+package gzfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SpaceKind selects the accounting reported by zfs userspace, groupspace or
+// projectspace.
+type SpaceKind string
+
+const (
+	SpaceUser    SpaceKind = "user"
+	SpaceGroup   SpaceKind = "group"
+	SpaceProject SpaceKind = "project"
+)
+
+// QuotaType is the prefix of a per-identity quota property such as userquota@alice.
+type QuotaType string
+
+const (
+	QuotaUser          QuotaType = "userquota"
+	QuotaGroup         QuotaType = "groupquota"
+	QuotaProject       QuotaType = "projectquota"
+	QuotaUserObject    QuotaType = "userobjquota"
+	QuotaGroupObject   QuotaType = "groupobjquota"
+	QuotaProjectObject QuotaType = "projectobjquota"
+)
+
+// spaceFields are requested explicitly so the column order does not depend on the
+// zfs version.
+var spaceFields = []string{"type", "name", "used", "quota", "objused", "objquota"}
+
+// SpaceOptions controls UserSpace and GroupSpace. The options do not apply to
+// ProjectSpace.
+type SpaceOptions struct {
+	// Numeric prints numeric IDs instead of resolving them to names (-n).
+	Numeric bool
+	// TranslateSIDs maps SMB SIDs to POSIX IDs (-i).
+	TranslateSIDs bool
+	// Types restricts the identity types listed (-t), such as posixuser, smbuser,
+	// posixgroup, smbgroup or all.
+	Types []string
+}
+
+// SpaceUsage is one row of zfs userspace, groupspace or projectspace. A zero Quota or
+// ObjQuota means no quota is set.
+type SpaceUsage struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Used     uint64 `json:"used"`
+	Quota    uint64 `json:"quota"`
+	ObjUsed  uint64 `json:"objUsed"`
+	ObjQuota uint64 `json:"objQuota"`
+}
+
+func spaceArgs(kind SpaceKind, dataset string, opts SpaceOptions) ([]string, error) {
+	if dataset == "" {
+		return nil, fmt.Errorf("dataset name is empty")
+	}
+
+	args := []string{string(kind) + "space", "-H", "-p", "-o", strings.Join(spaceFields, ",")}
+
+	switch kind {
+	case SpaceUser, SpaceGroup:
+		if opts.Numeric {
+			args = append(args, "-n")
+		}
+		if opts.TranslateSIDs {
+			args = append(args, "-i")
+		}
+		if len(opts.Types) > 0 {
+			args = append(args, "-t", strings.Join(opts.Types, ","))
+		}
+	case SpaceProject:
+		if opts.Numeric || opts.TranslateSIDs || len(opts.Types) > 0 {
+			return nil, fmt.Errorf("invalid_space_options: projectspace takes no identity options")
+		}
+	default:
+		return nil, fmt.Errorf("invalid_space_kind: %q", kind)
+	}
+
+	return append(args, dataset), nil
+}
+
+func parseSpace(out []byte) ([]SpaceUsage, error) {
+	usage := []SpaceUsage{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != len(spaceFields) {
+			return nil, fmt.Errorf("unexpected_space_output: %q", line)
+		}
+
+		usage = append(usage, SpaceUsage{
+			Type:     fields[0],
+			Name:     fields[1],
+			Used:     ParseUint64(fields[2]),
+			Quota:    ParseUint64(fields[3]),
+			ObjUsed:  ParseUint64(fields[4]),
+			ObjQuota: ParseUint64(fields[5]),
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse space output: %w", err)
+	}
+
+	return usage, nil
+}
+
+// Space lists the per-identity usage and quotas of dataset, which may be a file
+// system, a snapshot or a path inside a mounted file system.
+func (z *zfs) Space(ctx context.Context, kind SpaceKind, dataset string, opts SpaceOptions) ([]SpaceUsage, error) {
+	args, err := spaceArgs(kind, dataset, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out, _, err := z.cmd.RunBytes(ctx, nil, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%sspace_failed: %w", kind, err)
+	}
+
+	return parseSpace(out)
+}
+
+func (z *zfs) UserSpace(ctx context.Context, dataset string, opts SpaceOptions) ([]SpaceUsage, error) {
+	return z.Space(ctx, SpaceUser, dataset, opts)
+}
+
+func (z *zfs) GroupSpace(ctx context.Context, dataset string, opts SpaceOptions) ([]SpaceUsage, error) {
+	return z.Space(ctx, SpaceGroup, dataset, opts)
+}
+
+func (z *zfs) ProjectSpace(ctx context.Context, dataset string) ([]SpaceUsage, error) {
+	return z.Space(ctx, SpaceProject, dataset, SpaceOptions{})
+}
+
+// QuotaProperty returns the property name of quota t for id, a user or group name,
+// a numeric ID, a SID or a project ID.
+func QuotaProperty(t QuotaType, id string) (string, error) {
+	switch t {
+	case QuotaUser, QuotaGroup, QuotaUserObject, QuotaGroupObject:
+	case QuotaProject, QuotaProjectObject:
+		if _, err := strconv.ParseUint(id, 10, 32); err != nil {
+			return "", fmt.Errorf("invalid_project_id: %q", id)
+		}
+	default:
+		return "", fmt.Errorf("invalid_quota_type: %q", t)
+	}
+
+	if id == "" || strings.ContainsAny(id, "=@ \t\n") {
+		return "", fmt.Errorf("invalid_quota_id: %q", id)
+	}
+
+	return string(t) + "@" + id, nil
+}
+
+// SetQuota sets quota t for id on dataset to limit, in bytes for space quotas and in
+// objects for object quotas. A limit of zero clears the quota.
+func (z *zfs) SetQuota(ctx context.Context, dataset string, t QuotaType, id string, limit uint64) error {
+	if dataset == "" {
+		return fmt.Errorf("dataset name is empty")
+	}
+
+	prop, err := QuotaProperty(t, id)
+	if err != nil {
+		return err
+	}
+
+	value := "none"
+	if limit > 0 {
+		value = strconv.FormatUint(limit, 10)
+	}
+
+	if err := ValidateProperty(DatasetTypeFilesystem, prop, value, false); err != nil {
+		return err
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, "set", prop+"="+value, dataset); err != nil {
+		return fmt.Errorf("set_quota_failed: %w", err)
+	}
+
+	return nil
+}
+
+// ClearQuota removes quota t for id from dataset.
+func (z *zfs) ClearQuota(ctx context.Context, dataset string, t QuotaType, id string) error {
+	return z.SetQuota(ctx, dataset, t, id, 0)
+}
+
+// GetQuota returns quota t for id on dataset, or zero if none is set.
+func (z *zfs) GetQuota(ctx context.Context, dataset string, t QuotaType, id string) (uint64, error) {
+	prop, err := QuotaProperty(t, id)
+	if err != nil {
+		return 0, err
+	}
+
+	p, err := z.GetProperty(ctx, dataset, prop)
+	if err != nil {
+		return 0, err
+	}
+
+	return ParseUint64(p.Value), nil
+}
+
+func (d *Dataset) UserSpace(ctx context.Context, opts SpaceOptions) ([]SpaceUsage, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.UserSpace(ctx, d.Name, opts)
+}
+
+func (d *Dataset) GroupSpace(ctx context.Context, opts SpaceOptions) ([]SpaceUsage, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.GroupSpace(ctx, d.Name, opts)
+}
+
+func (d *Dataset) ProjectSpace(ctx context.Context) ([]SpaceUsage, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.ProjectSpace(ctx, d.Name)
+}
+
+func (d *Dataset) SetQuota(ctx context.Context, t QuotaType, id string, limit uint64) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.SetQuota(ctx, d.Name, t, id, limit)
+}
+
+func (d *Dataset) ClearQuota(ctx context.Context, t QuotaType, id string) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.ClearQuota(ctx, d.Name, t, id)
+}
+
+func (d *Dataset) GetQuota(ctx context.Context, t QuotaType, id string) (uint64, error) {
+	if d == nil {
+		return 0, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return 0, fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.GetQuota(ctx, d.Name, t, id)
+}
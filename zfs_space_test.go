@@ -0,0 +1,70 @@
+package gzfs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func TestZFS_UserSpace(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+
+	mockRunner.AddCommand("zfs userspace -H -p -o type,name,used,quota,objused,objquota -n -t posixuser tank/home",
+		"POSIX User\t0\t1536\tnone\t12\tnone\n"+
+			"POSIX User\t1000\t10737418240\t21474836480\t4200\t100000\n", "", nil)
+
+	usage, err := client.UserSpace(ctx, "tank/home", SpaceOptions{Numeric: true, Types: []string{"posixuser"}})
+	if err != nil {
+		t.Fatalf("UserSpace returned error: %v", err)
+	}
+
+	if len(usage) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(usage))
+	}
+	if u := usage[0]; u.Type != "POSIX User" || u.Name != "0" || u.Used != 1536 || u.Quota != 0 || u.ObjUsed != 12 {
+		t.Errorf("Unexpected row: %+v", u)
+	}
+	if u := usage[1]; u.Quota != 20<<30 || u.ObjQuota != 100000 {
+		t.Errorf("Unexpected row: %+v", u)
+	}
+
+	if _, err := client.Space(ctx, SpaceProject, "tank/home", SpaceOptions{Numeric: true}); err == nil {
+		t.Error("Expected error for identity options on projectspace")
+	}
+	if _, err := parseSpace([]byte("POSIX User\talice\t1\n")); err == nil {
+		t.Error("Expected error for a short row")
+	}
+}
+
+func TestZFS_SetQuota(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+	ds := &Dataset{z: client, Name: "tank/home"}
+
+	mockRunner.AddCommand("zfs set userquota@alice=10737418240 tank/home", "", "", nil)
+	mockRunner.AddCommand("zfs set projectobjquota@42=none tank/home", "", "", nil)
+
+	if err := ds.SetQuota(ctx, QuotaUser, "alice", 10<<30); err != nil {
+		t.Errorf("SetQuota returned error: %v", err)
+	}
+	if err := ds.ClearQuota(ctx, QuotaProjectObject, "42"); err != nil {
+		t.Errorf("ClearQuota returned error: %v", err)
+	}
+	if last := mockRunner.GetLastCall(); last == nil || strings.Join(last.Args, " ") != "set projectobjquota@42=none tank/home" {
+		t.Errorf("Unexpected last call: %+v", last)
+	}
+
+	for _, tt := range []struct {
+		t  QuotaType
+		id string
+	}{{QuotaProject, "alice"}, {QuotaUser, ""}, {QuotaGroup, "a=b"}, {"refquota", "alice"}} {
+		if _, err := QuotaProperty(tt.t, tt.id); err == nil {
+			t.Errorf("Expected error for %s@%s", tt.t, tt.id)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// templateNamespace holds the user properties that mark templates, their published
+// versions and the instances cloned from them.
+const templateNamespace = "gzfs.template"
+
+const (
+	templateKeyTemplate    = "template"
+	templateKeyVersion     = "version"
+	templateKeyDescription = "description"
+	templateKeySource      = "source"
+)
+
+// Template is a golden image volume. Every published version is a snapshot of the
+// volume and every instance is a clone of one of those snapshots.
+type Template struct {
+	z    *zfs
+	Name string
+}
+
+// PublishOptions controls Template.Publish.
+type PublishOptions struct {
+	Description string
+}
+
+// TemplateVersion is a published version of a template.
+type TemplateVersion struct {
+	Version     string    `json:"version"`
+	Snapshot    string    `json:"snapshot"`
+	Description string    `json:"description,omitempty"`
+	Created     time.Time `json:"created"`
+	// Instances are the clones of the version snapshot, sorted by name.
+	Instances []string `json:"instances"`
+}
+
+func validateTemplateVersion(version string) error {
+	if version == "" {
+		return fmt.Errorf("template version is empty")
+	}
+
+	for _, r := range version {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == '-', r == ':':
+		default:
+			return fmt.Errorf("invalid_template_version: %q", version)
+		}
+	}
+
+	return nil
+}
+
+// CreateTemplate creates the volume name and marks it as a template. Its contents are
+// usually filled with ImportImage before the first version is published.
+func (z *zfs) CreateTemplate(ctx context.Context, name string, opts VolumeCreateOptions) (*Template, error) {
+	marker, err := userPropertyName(templateNamespace, templateKeyTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	props := make(map[string]string, len(opts.Properties)+1)
+	for k, v := range opts.Properties {
+		props[k] = v
+	}
+	props[marker] = "yes"
+	opts.Properties = props
+
+	if _, err := z.CreateVolumeWithOptions(ctx, name, opts); err != nil {
+		return nil, fmt.Errorf("template_create_failed: %w", err)
+	}
+
+	return &Template{z: z, Name: name}, nil
+}
+
+// Template returns the template name, failing if the dataset is not marked as one.
+func (z *zfs) Template(ctx context.Context, name string) (*Template, error) {
+	value, ok, err := z.GetUserProperty(ctx, name, templateNamespace, templateKeyTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || value != "yes" {
+		return nil, fmt.Errorf("not_a_template: %s", name)
+	}
+
+	return &Template{z: z, Name: name}, nil
+}
+
+// Templates returns the names of all templates, sorted.
+func (z *zfs) Templates(ctx context.Context) ([]string, error) {
+	return z.FindByUserProperty(ctx, templateNamespace, templateKeyTemplate, "yes", false)
+}
+
+// Publish snapshots the template as version and records the version metadata on the
+// snapshot. The snapshot is destroyed again if the metadata cannot be written.
+func (t *Template) Publish(ctx context.Context, version string, opts PublishOptions) (*TemplateVersion, error) {
+	if err := validateTemplateVersion(version); err != nil {
+		return nil, err
+	}
+
+	snap, err := t.z.Snapshot(ctx, t.Name, version, false)
+	if err != nil {
+		return nil, fmt.Errorf("template_publish_failed: %w", err)
+	}
+
+	values := map[string]string{templateKeyVersion: version}
+	if opts.Description != "" {
+		values[templateKeyDescription] = opts.Description
+	}
+
+	if err := t.z.SetUserProperties(ctx, snap.Name, templateNamespace, values); err != nil {
+		if destroyErr := t.z.DestroyWithOptions(ctx, snap.Name, DestroyOptions{}); destroyErr != nil {
+			return nil, fmt.Errorf("template_publish_failed: %w (snapshot %s left behind: %v)", err, snap.Name, destroyErr)
+		}
+		return nil, fmt.Errorf("template_publish_failed: %w", err)
+	}
+
+	return t.Version(ctx, version)
+}
+
+// Versions returns the published versions of the template, oldest first.
+func (t *Template) Versions(ctx context.Context) ([]TemplateVersion, error) {
+	versionProp, _ := userPropertyName(templateNamespace, templateKeyVersion)
+	descriptionProp, _ := userPropertyName(templateNamespace, templateKeyDescription)
+
+	all, err := t.z.GetProperties(ctx, []string{t.Name},
+		[]string{versionProp, descriptionProp, "clones", "creation", "createtxg"},
+		GetOptions{Depth: 1, Types: []DatasetType{DatasetTypeSnapshot}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []TemplateVersion
+	txgs := make(map[string]uint64)
+
+	for name, props := range all {
+		dataset, _, ok := strings.Cut(name, "@")
+		if !ok || dataset != t.Name {
+			continue
+		}
+
+		prop, ok := props[versionProp]
+		if !ok || isUnsetUserProperty(prop) {
+			continue
+		}
+
+		v := TemplateVersion{
+			Version:   prop.Value,
+			Snapshot:  name,
+			Created:   ParseCreation(props["creation"].Value),
+			Instances: []string{},
+		}
+		if desc, ok := props[descriptionProp]; ok && !isUnsetUserProperty(desc) {
+			v.Description = desc.Value
+		}
+		if clones := ParseString(props["clones"].Value); clones != "" {
+			v.Instances = strings.Split(clones, ",")
+			sort.Strings(v.Instances)
+		}
+
+		txgs[name] = ParseUint64(props["createtxg"].Value)
+		versions = append(versions, v)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		if txgs[versions[i].Snapshot] != txgs[versions[j].Snapshot] {
+			return txgs[versions[i].Snapshot] < txgs[versions[j].Snapshot]
+		}
+		return versions[i].Snapshot < versions[j].Snapshot
+	})
+
+	return versions, nil
+}
+
+// Version returns a single published version of the template.
+func (t *Template) Version(ctx context.Context, version string) (*TemplateVersion, error) {
+	versions, err := t.Versions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range versions {
+		if versions[i].Version == version {
+			return &versions[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("template_version_not_found: %s@%s", t.Name, version)
+}
+
+// Instantiate clones version of the template to dest with the given properties and
+// records the template and version on the instance.
+func (t *Template) Instantiate(ctx context.Context, version, dest string, properties map[string]string) (*Dataset, error) {
+	v, err := t.Version(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	props := make(map[string]string, len(properties)+2)
+	for k, val := range properties {
+		props[k] = val
+	}
+
+	for key, val := range map[string]string{templateKeySource: t.Name, templateKeyVersion: v.Version} {
+		name, err := userPropertyName(templateNamespace, key)
+		if err != nil {
+			return nil, err
+		}
+		props[name] = val
+	}
+
+	return t.z.Clone(ctx, v.Snapshot, dest, props)
+}
+
+// Retire destroys version of the template. It is refused while the version still has
+// instances. Promoting an instance detaches it, but moves the version snapshot and all
+// earlier ones to the instance, so the version is no longer listed by the template.
+func (t *Template) Retire(ctx context.Context, version string) error {
+	v, err := t.Version(ctx, version)
+	if err != nil {
+		return err
+	}
+
+	if len(v.Instances) > 0 {
+		return fmt.Errorf("template_version_in_use: %s has %d instances: %s", v.Snapshot, len(v.Instances), strings.Join(v.Instances, ", "))
+	}
+
+	if err := t.z.DestroyWithOptions(ctx, v.Snapshot, DestroyOptions{}); err != nil {
+		return fmt.Errorf("template_retire_failed: %w", err)
+	}
+
+	return nil
+}
+
+// TemplateSource returns the template and version recorded on an instance created by
+// Template.Instantiate. It reports false for datasets that are not instances.
+func (z *zfs) TemplateSource(ctx context.Context, name string) (string, string, bool, error) {
+	props, err := z.UserProperties(ctx, name, templateNamespace)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	source, ok := props[templateKeySource]
+	if !ok || source.Source.Origin() != OriginLocal {
+		return "", "", false, nil
+	}
+
+	return source.Value, props[templateKeyVersion].Value, true, nil
+}
@@ -0,0 +1,103 @@
+package gzfs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func TestTemplate_Versions(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+	tmpl := &Template{z: client, Name: "tank/templates/debian"}
+
+	mockRunner.AddCommand("zfs get -p -d 1 -t snap gzfs.template:version,gzfs.template:description,clones,creation,createtxg tank/templates/debian -j", datasetListJSON(
+		testDataset{name: "tank/templates/debian@v2", props: map[string]string{
+			"gzfs.template:version":     "v2|LOCAL",
+			"gzfs.template:description": "-|NONE",
+			"clones":                    "|NONE",
+			"creation":                  "1700000100|NONE",
+			"createtxg":                 "200|NONE",
+		}},
+		testDataset{name: "tank/templates/debian@v1", props: map[string]string{
+			"gzfs.template:version":     "v1|LOCAL",
+			"gzfs.template:description": "bookworm base|LOCAL",
+			"clones":                    "tank/vms/web2,tank/vms/web1|NONE",
+			"creation":                  "1700000000|NONE",
+			"createtxg":                 "100|NONE",
+		}},
+		testDataset{name: "tank/templates/debian@autosnap", props: map[string]string{
+			"gzfs.template:version": "-|NONE",
+			"clones":                "|NONE",
+			"createtxg":             "150|NONE",
+		}},
+	), "", nil)
+
+	versions, err := tmpl.Versions(ctx)
+	if err != nil {
+		t.Fatalf("Versions returned error: %v", err)
+	}
+	if len(versions) != 2 || versions[0].Version != "v1" || versions[1].Version != "v2" {
+		t.Fatalf("Unexpected versions: %+v", versions)
+	}
+	if versions[0].Description != "bookworm base" || strings.Join(versions[0].Instances, ",") != "tank/vms/web1,tank/vms/web2" {
+		t.Errorf("Unexpected v1: %+v", versions[0])
+	}
+	if versions[1].Created.Unix() != 1700000100 || len(versions[1].Instances) != 0 {
+		t.Errorf("Unexpected v2: %+v", versions[1])
+	}
+
+	if err := tmpl.Retire(ctx, "v1"); err == nil || !strings.Contains(err.Error(), "template_version_in_use") {
+		t.Errorf("Expected retire of v1 to be refused, got %v", err)
+	}
+
+	mockRunner.AddCommand("zfs destroy tank/templates/debian@v2", "", "", nil)
+	if err := tmpl.Retire(ctx, "v2"); err != nil {
+		t.Errorf("Retire returned error: %v", err)
+	}
+	if last := mockRunner.GetLastCall(); last == nil || strings.Join(last.Args, " ") != "destroy tank/templates/debian@v2" {
+		t.Errorf("Unexpected last call: %+v", last)
+	}
+
+	if _, err := tmpl.Version(ctx, "v3"); err == nil || !strings.Contains(err.Error(), "template_version_not_found") {
+		t.Errorf("Expected missing version error, got %v", err)
+	}
+}
+
+func TestTemplate_Instantiate(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+	tmpl := &Template{z: client, Name: "tank/templates/debian"}
+	list := "zfs list -o " + strings.Join(dsPropList, ",") + " -p "
+
+	mockRunner.AddCommand("zfs get -p -d 1 -t snap gzfs.template:version,gzfs.template:description,clones,creation,createtxg tank/templates/debian -j", datasetListJSON(
+		testDataset{name: "tank/templates/debian@v1", props: map[string]string{
+			"gzfs.template:version": "v1|LOCAL",
+			"clones":                "|NONE",
+			"createtxg":             "100|NONE",
+		}},
+	), "", nil)
+	mockRunner.AddCommand(list+"tank/templates/debian@v1 -j", datasetListJSON(
+		testDataset{name: "tank/templates/debian@v1", typ: DatasetTypeSnapshot},
+	), "", nil)
+	mockRunner.AddCommand("zfs clone -p -o gzfs.template:source=tank/templates/debian -o gzfs.template:version=v1 -o volmode=dev tank/templates/debian@v1 tank/vms/web1", "", "", nil)
+	mockRunner.AddCommand(list+"tank/vms/web1 -j", datasetListJSON(
+		testDataset{name: "tank/vms/web1", typ: DatasetTypeVolume},
+	), "", nil)
+
+	ds, err := tmpl.Instantiate(ctx, "v1", "tank/vms/web1", map[string]string{"volmode": "dev"})
+	if err != nil {
+		t.Fatalf("Instantiate returned error: %v", err)
+	}
+	if ds.Name != "tank/vms/web1" {
+		t.Errorf("Unexpected instance: %s", ds.Name)
+	}
+
+	if _, err := tmpl.Publish(ctx, "v2@x", PublishOptions{}); err == nil {
+		t.Error("Expected error for an invalid version")
+	}
+}
@@ -892,14 +892,11 @@ func TestDataset_GetEncryptionProperties(t *testing.T) {
 			if tt.dataset != nil && tt.dataset.z != nil {
 				tt.dataset.z.cmd.Runner = mockRunner
 
-				props := []string{"encryption", "keylocation", "keyformat", "keystatus", "encryptionroot"}
-				for _, prop := range props {
-					cmd := fmt.Sprintf("zfs get -p %s %s -j", prop, tt.dataset.Name)
-					if tt.mockError {
-						mockRunner.AddCommand(cmd, "", "get error", fmt.Errorf("exit status 1"))
-					} else {
-						mockRunner.AddCommand(cmd, testutil.ZFSGetEncryptionJSON, "", nil)
-					}
+				cmd := fmt.Sprintf("zfs get -p encryption,keylocation,keyformat,keystatus,encryptionroot %s -j", tt.dataset.Name)
+				if tt.mockError {
+					mockRunner.AddCommand(cmd, "", "get error", fmt.Errorf("exit status 1"))
+				} else {
+					mockRunner.AddCommand(cmd, testutil.ZFSGetEncryptionJSON, "", nil)
 				}
 			}
 
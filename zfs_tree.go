@@ -0,0 +1,248 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DatasetNode is a file system or volume in a DatasetTree together with its
+// children, snapshots and bookmarks.
+type DatasetNode struct {
+	Dataset *Dataset `json:"dataset"`
+
+	Parent    *DatasetNode   `json:"-"`
+	Children  []*DatasetNode `json:"children"`
+	Snapshots []*Dataset     `json:"snapshots"`
+	Bookmarks []*Dataset     `json:"bookmarks"`
+}
+
+// DatasetTree is the parent/child hierarchy of the datasets below one or more roots.
+// Children are sorted by name; snapshots and bookmarks by creation txg.
+type DatasetTree struct {
+	Roots []*DatasetNode `json:"roots"`
+
+	byName map[string]*DatasetNode
+	byGUID map[string]*Dataset
+}
+
+// SubtreeUsage aggregates space and object counts for a node and its descendants.
+type SubtreeUsage struct {
+	Datasets     int    `json:"datasets"`
+	Snapshots    int    `json:"snapshots"`
+	Bookmarks    int    `json:"bookmarks"`
+	Used         uint64 `json:"used"`
+	Referenced   uint64 `json:"referenced"`
+	SnapshotUsed uint64 `json:"snapshot_used"`
+}
+
+func sortByCreation(datasets []*Dataset) {
+	sort.SliceStable(datasets, func(i, j int) bool {
+		ti, tj := ParseUint64(datasets[i].CreateTXG), ParseUint64(datasets[j].CreateTXG)
+		if ti != tj {
+			return ti < tj
+		}
+		return datasets[i].Name < datasets[j].Name
+	})
+}
+
+func buildDatasetTree(datasets []*Dataset) *DatasetTree {
+	tree := &DatasetTree{
+		byName: make(map[string]*DatasetNode),
+		byGUID: make(map[string]*Dataset),
+	}
+
+	var snapshots, bookmarks []*Dataset
+	for _, d := range datasets {
+		switch {
+		case d.Type == DatasetTypeSnapshot || strings.Contains(d.Name, "@"):
+			snapshots = append(snapshots, d)
+		case d.Type == DatasetTypeBookmark || strings.Contains(d.Name, "#"):
+			bookmarks = append(bookmarks, d)
+		default:
+			tree.byName[d.Name] = &DatasetNode{Dataset: d}
+		}
+	}
+
+	for name, node := range tree.byName {
+		parent, ok := tree.byName[parentDatasetName(name)]
+		if !ok {
+			tree.Roots = append(tree.Roots, node)
+			continue
+		}
+		node.Parent = parent
+		parent.Children = append(parent.Children, node)
+	}
+
+	for _, s := range snapshots {
+		owner, _, _ := strings.Cut(s.Name, "@")
+		if node, ok := tree.byName[owner]; ok {
+			node.Snapshots = append(node.Snapshots, s)
+		}
+	}
+
+	for _, d := range datasets {
+		if d.GUID != "" && d.Type != DatasetTypeBookmark {
+			tree.byGUID[d.GUID] = d
+		}
+	}
+
+	// Bookmarks share the GUID of the snapshot they were created from.
+	for _, b := range bookmarks {
+		if _, ok := tree.byGUID[b.GUID]; !ok && b.GUID != "" {
+			tree.byGUID[b.GUID] = b
+		}
+	}
+
+	for _, b := range bookmarks {
+		owner, _, _ := strings.Cut(b.Name, "#")
+		if node, ok := tree.byName[owner]; ok {
+			node.Bookmarks = append(node.Bookmarks, b)
+		}
+	}
+
+	byNodeName := func(nodes []*DatasetNode) func(i, j int) bool {
+		return func(i, j int) bool { return nodes[i].Dataset.Name < nodes[j].Dataset.Name }
+	}
+
+	sort.Slice(tree.Roots, byNodeName(tree.Roots))
+	for _, node := range tree.byName {
+		sort.Slice(node.Children, byNodeName(node.Children))
+		sortByCreation(node.Snapshots)
+		sortByCreation(node.Bookmarks)
+	}
+
+	return tree
+}
+
+// Tree lists root and everything below it, including snapshots and bookmarks, and
+// returns the hierarchy. An empty root builds one tree per pool.
+func (z *zfs) Tree(ctx context.Context, root string) (*DatasetTree, error) {
+	var resp DatasetList
+
+	all := DatasetTypeAll
+	args := z.listArgs(root, true, &all)
+
+	if err := z.cmd.RunJSON(ctx, &resp, args...); err != nil {
+		return nil, err
+	}
+
+	datasets := make([]*Dataset, 0, len(resp.Datasets))
+	for _, d := range resp.Datasets {
+		z.hydrateDataset(d)
+		datasets = append(datasets, d)
+	}
+
+	tree := buildDatasetTree(datasets)
+	if root != "" && tree.Find(root) == nil {
+		return nil, fmt.Errorf("dataset_not_found: %s", root)
+	}
+
+	return tree, nil
+}
+
+func (t *DatasetTree) Find(name string) *DatasetNode {
+	if t == nil {
+		return nil
+	}
+	return t.byName[name]
+}
+
+// FindByGUID returns the dataset, snapshot or bookmark with the given GUID.
+func (t *DatasetTree) FindByGUID(guid string) *Dataset {
+	if t == nil {
+		return nil
+	}
+	return t.byGUID[guid]
+}
+
+// Walk visits every node in pre-order (parents before children). Returning an error
+// from fn stops the walk.
+func (t *DatasetTree) Walk(fn func(*DatasetNode) error) error {
+	for _, root := range t.Roots {
+		if err := root.Walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkPostOrder visits every node with children before their parents.
+func (t *DatasetTree) WalkPostOrder(fn func(*DatasetNode) error) error {
+	for _, root := range t.Roots {
+		if err := root.WalkPostOrder(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *DatasetNode) Walk(fn func(*DatasetNode) error) error {
+	if err := fn(n); err != nil {
+		return err
+	}
+	for _, child := range n.Children {
+		if err := child.Walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *DatasetNode) WalkPostOrder(fn func(*DatasetNode) error) error {
+	for _, child := range n.Children {
+		if err := child.WalkPostOrder(fn); err != nil {
+			return err
+		}
+	}
+	return fn(n)
+}
+
+func (n *DatasetNode) Depth() int {
+	depth := 0
+	for p := n.Parent; p != nil; p = p.Parent {
+		depth++
+	}
+	return depth
+}
+
+// Usage aggregates the node and its descendants. Used is taken from the node itself
+// since ZFS already includes descendants in it.
+func (n *DatasetNode) Usage() SubtreeUsage {
+	usage := SubtreeUsage{Used: n.Dataset.Used}
+
+	_ = n.Walk(func(node *DatasetNode) error {
+		usage.Datasets++
+		usage.Referenced += node.Dataset.Referenced
+		usage.Snapshots += len(node.Snapshots)
+		usage.Bookmarks += len(node.Bookmarks)
+		for _, s := range node.Snapshots {
+			usage.SnapshotUsed += s.Used
+		}
+		return nil
+	})
+
+	return usage
+}
+
+func (n *DatasetNode) propertiesWithSource(origin PropertyOrigin) map[string]ZFSProperty {
+	props := make(map[string]ZFSProperty)
+	for name, prop := range n.Dataset.Properties {
+		if prop.Source.Origin() == origin {
+			props[name] = prop
+		}
+	}
+	return props
+}
+
+// LocalProperties returns the properties set directly on this dataset.
+func (n *DatasetNode) LocalProperties() map[string]ZFSProperty {
+	return n.propertiesWithSource(OriginLocal)
+}
+
+// InheritedProperties returns the properties inherited from an ancestor. The source
+// data of each property names the ancestor it was inherited from.
+func (n *DatasetNode) InheritedProperties() map[string]ZFSProperty {
+	return n.propertiesWithSource(OriginInherited)
+}
@@ -0,0 +1,189 @@
+package gzfs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+type testDataset struct {
+	name  string
+	typ   DatasetType
+	txg   string
+	props map[string]string
+}
+
+// datasetListJSON renders zfs list/get -j output for the given datasets. Property
+// values of the form "value|type|data" carry an explicit source.
+func datasetListJSON(datasets ...testDataset) string {
+	resp := DatasetList{
+		OutputVersion: OutputVersion{Command: "zfs list", VersMajor: 0, VersMinor: 1},
+		Datasets:      make(map[string]*Dataset, len(datasets)),
+	}
+
+	for _, td := range datasets {
+		pool, _, _ := strings.Cut(td.name, "/")
+		pool, _, _ = strings.Cut(pool, "@")
+		pool, _, _ = strings.Cut(pool, "#")
+
+		ds := &Dataset{
+			Name:       td.name,
+			Type:       td.typ,
+			Pool:       pool,
+			CreateTXG:  td.txg,
+			Properties: make(map[string]ZFSProperty, len(td.props)),
+		}
+
+		for k, v := range td.props {
+			parts := strings.SplitN(v, "|", 3)
+			prop := ZFSProperty{Value: parts[0], Source: ZFSPropertySource{Type: "default"}}
+			if len(parts) > 1 {
+				prop.Source.Type = parts[1]
+			}
+			if len(parts) > 2 {
+				prop.Source.Data = parts[2]
+			}
+			ds.Properties[k] = prop
+		}
+
+		resp.Datasets[td.name] = ds
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		panic(fmt.Sprintf("marshal dataset list: %v", err))
+	}
+	return string(out)
+}
+
+func sampleTreeJSON() string {
+	return datasetListJSON(
+		testDataset{name: "tank", typ: DatasetTypeFilesystem, txg: "1", props: map[string]string{
+			"guid": "100", "used": "1000", "referenced": "100", "compression": "lz4|LOCAL",
+		}},
+		testDataset{name: "tank/vm", typ: DatasetTypeFilesystem, txg: "5", props: map[string]string{
+			"guid": "200", "used": "600", "referenced": "200", "compression": "lz4|INHERITED|tank",
+		}},
+		testDataset{name: "tank/home", typ: DatasetTypeFilesystem, txg: "3", props: map[string]string{
+			"guid": "300", "used": "200", "referenced": "150", "compression": "off|LOCAL",
+		}},
+		testDataset{name: "tank/vm/disk0", typ: DatasetTypeVolume, txg: "6", props: map[string]string{
+			"guid": "400", "used": "300", "referenced": "250", "compression": "lz4|INHERITED|tank",
+		}},
+		testDataset{name: "tank/vm@b", typ: DatasetTypeSnapshot, txg: "9", props: map[string]string{
+			"guid": "500", "used": "10",
+		}},
+		testDataset{name: "tank/vm@a", typ: DatasetTypeSnapshot, txg: "7", props: map[string]string{
+			"guid": "600", "used": "20",
+		}},
+		testDataset{name: "tank/vm#mark", typ: DatasetTypeBookmark, txg: "7", props: map[string]string{
+			"guid": "600",
+		}},
+	)
+}
+
+func TestZFS_Tree(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	mockRunner.AddCommand("zfs list -o "+strings.Join(dsPropList, ",")+" -p -r -t all tank -j", sampleTreeJSON(), "", nil)
+
+	tree, err := client.Tree(ctx, "tank")
+	if err != nil {
+		t.Fatalf("Tree returned error: %v", err)
+	}
+
+	if len(tree.Roots) != 1 || tree.Roots[0].Dataset.Name != "tank" {
+		t.Fatalf("Unexpected roots: %+v", tree.Roots)
+	}
+
+	var preOrder []string
+	_ = tree.Walk(func(n *DatasetNode) error {
+		preOrder = append(preOrder, n.Dataset.Name)
+		return nil
+	})
+	if got, want := strings.Join(preOrder, ","), "tank,tank/home,tank/vm,tank/vm/disk0"; got != want {
+		t.Errorf("pre-order = %s, want %s", got, want)
+	}
+
+	var postOrder []string
+	_ = tree.WalkPostOrder(func(n *DatasetNode) error {
+		postOrder = append(postOrder, n.Dataset.Name)
+		return nil
+	})
+	if got, want := strings.Join(postOrder, ","), "tank/home,tank/vm/disk0,tank/vm,tank"; got != want {
+		t.Errorf("post-order = %s, want %s", got, want)
+	}
+
+	vm := tree.Find("tank/vm")
+	if vm == nil {
+		t.Fatal("tank/vm not found")
+	}
+	if vm.Parent == nil || vm.Parent.Dataset.Name != "tank" {
+		t.Errorf("Unexpected parent for tank/vm")
+	}
+	if vm.Depth() != 1 {
+		t.Errorf("Expected depth 1, got %d", vm.Depth())
+	}
+	if len(vm.Snapshots) != 2 || vm.Snapshots[0].Name != "tank/vm@a" || vm.Snapshots[1].Name != "tank/vm@b" {
+		t.Errorf("Snapshots not in creation order: %v", vm.Snapshots)
+	}
+	if len(vm.Bookmarks) != 1 || vm.Bookmarks[0].Name != "tank/vm#mark" {
+		t.Errorf("Unexpected bookmarks: %v", vm.Bookmarks)
+	}
+
+	if ds := tree.FindByGUID("600"); ds == nil || ds.Name != "tank/vm@a" {
+		t.Errorf("FindByGUID(600) = %v, want snapshot over bookmark", ds)
+	}
+	if ds := tree.FindByGUID("400"); ds == nil || ds.Name != "tank/vm/disk0" {
+		t.Errorf("FindByGUID(400) = %v", ds)
+	}
+
+	usage := vm.Usage()
+	if usage.Datasets != 2 || usage.Snapshots != 2 || usage.Bookmarks != 1 {
+		t.Errorf("Unexpected counts: %+v", usage)
+	}
+	if usage.Used != 600 || usage.Referenced != 450 || usage.SnapshotUsed != 30 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	if _, ok := tree.Find("tank").LocalProperties()["compression"]; !ok {
+		t.Error("Expected compression to be local on tank")
+	}
+	inherited := vm.InheritedProperties()
+	if prop, ok := inherited["compression"]; !ok || prop.Source.Data != "tank" {
+		t.Errorf("Expected compression inherited from tank, got %+v", inherited)
+	}
+	if _, ok := tree.Find("tank/home").InheritedProperties()["compression"]; ok {
+		t.Error("compression should not be inherited on tank/home")
+	}
+}
+
+func TestZFS_TreeNotFound(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	mockRunner.AddCommand("zfs list -o "+strings.Join(dsPropList, ",")+" -p -r -t all tank/missing -j", datasetListJSON(), "", nil)
+
+	if _, err := client.Tree(ctx, "tank/missing"); err == nil {
+		t.Fatal("Expected error for missing root")
+	}
+}
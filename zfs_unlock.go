@@ -0,0 +1,182 @@
+package gzfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UnlockOptions controls UnlockAll.
+type UnlockOptions struct {
+	// Passphrases maps encryption roots to their passphrase and is consulted first.
+	Passphrases map[string]string
+	// Keys supplies keys for roots without a passphrase. Roots it has no key for,
+	// or all roots when Keys is nil, are loaded from their keylocation, using the
+	// client's KeyStore for prompt locations.
+	Keys KeyStore
+	// NoMount only loads keys.
+	NoMount bool
+}
+
+type UnlockAction string
+
+const (
+	UnlockActionLoadKey UnlockAction = "load-key"
+	UnlockActionMount   UnlockAction = "mount"
+)
+
+// UnlockResult reports one step of UnlockAll.
+type UnlockResult struct {
+	Dataset string       `json:"dataset"`
+	Action  UnlockAction `json:"action"`
+	Err     error        `json:"-"`
+}
+
+// UnlockReport lists every key load and mount UnlockAll attempted, in order.
+type UnlockReport struct {
+	Results []UnlockResult `json:"results"`
+}
+
+// Failed returns the results that did not succeed.
+func (r *UnlockReport) Failed() []UnlockResult {
+	var failed []UnlockResult
+	for _, res := range r.Results {
+		if res.Err != nil {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+func (r *UnlockReport) add(dataset string, action UnlockAction, err error) {
+	r.Results = append(r.Results, UnlockResult{Dataset: dataset, Action: action, Err: err})
+}
+
+var unlockProps = []string{"encryptionroot", "keystatus", "keyformat", "canmount", "mountpoint", "mounted"}
+
+func (z *zfs) loadKeyFrom(ctx context.Context, root string, format KeyFormat, opts UnlockOptions) error {
+	if pass, ok := opts.Passphrases[root]; ok {
+		_, _, err := z.cmd.RunBytes(ctx, keyInput("prompt", KeyFormatPassphrase, []byte(pass)), "load-key", "-L", "prompt", root)
+		if err != nil {
+			return fmt.Errorf("load_key_failed: %w", err)
+		}
+		return nil
+	}
+
+	if opts.Keys != nil {
+		key, err := opts.Keys.Load(ctx, root)
+		switch {
+		case err == nil:
+			if _, _, err := z.cmd.RunBytes(ctx, keyInput("prompt", format, key), "load-key", "-L", "prompt", root); err != nil {
+				return fmt.Errorf("load_key_failed: %w", err)
+			}
+			return nil
+		case !errors.Is(err, ErrKeyNotFound):
+			return fmt.Errorf("load_stored_key_failed: %w", err)
+		}
+	}
+
+	return z.LoadKey(ctx, root, false)
+}
+
+// UnlockAll loads the keys of every encryption root at or below root (every pool when
+// root is empty) whose key is unavailable, then mounts the file systems under those
+// roots parent-first. Datasets with canmount other than on, or a legacy or none
+// mountpoint, are left alone. Every step is reported; a failure only skips the
+// datasets that depend on it. The error is only set if the datasets cannot be listed.
+func (z *zfs) UnlockAll(ctx context.Context, root string, opts UnlockOptions) (*UnlockReport, error) {
+	var names []string
+	getOpts := GetOptions{Types: []DatasetType{DatasetTypeFilesystem, DatasetTypeVolume}}
+	if root != "" {
+		names = []string{root}
+		getOpts.Recursive = true
+	}
+
+	props, err := z.GetProperties(ctx, names, unlockProps, getOpts)
+	if err != nil {
+		return nil, fmt.Errorf("list_encryption_state_failed: %w", err)
+	}
+
+	value := func(ds, prop string) string {
+		return strings.TrimSpace(props[ds][prop].Value)
+	}
+
+	var roots []string
+	for ds := range props {
+		if value(ds, "encryptionroot") == ds && value(ds, "keystatus") == "unavailable" {
+			roots = append(roots, ds)
+		}
+	}
+	sort.Strings(roots)
+
+	report := &UnlockReport{}
+	unlocked := make(map[string]bool)
+
+	for _, r := range roots {
+		if err := ctx.Err(); err != nil {
+			report.add(r, UnlockActionLoadKey, err)
+			continue
+		}
+
+		err := z.loadKeyFrom(ctx, r, KeyFormat(value(r, "keyformat")), opts)
+		report.add(r, UnlockActionLoadKey, err)
+		if err == nil {
+			unlocked[r] = true
+		}
+	}
+
+	if opts.NoMount {
+		return report, nil
+	}
+
+	var mounts []string
+	for ds := range props {
+		if !unlocked[value(ds, "encryptionroot")] {
+			continue
+		}
+		if value(ds, "canmount") != string(CanMountOn) || value(ds, "mounted") == "yes" {
+			continue
+		}
+		if !isMountableMountpoint(value(ds, "mountpoint")) {
+			continue
+		}
+		mounts = append(mounts, ds)
+	}
+
+	sortByMountpoint(mounts, func(n string) string { return value(n, "mountpoint") }, false)
+
+	// File systems whose key did not load stay unmounted, so nothing below them may
+	// be mounted either, even under an encryption root of its own.
+	failed := make(map[string]bool)
+	for ds := range props {
+		if value(ds, "keystatus") == "unavailable" && !unlocked[value(ds, "encryptionroot")] {
+			failed[ds] = true
+		}
+	}
+
+	for _, ds := range mounts {
+		var err error
+		if p := hasFailedAncestor(ds, failed); p != "" {
+			err = fmt.Errorf("parent_mount_failed: %s", p)
+		}
+
+		if err == nil {
+			err = ctx.Err()
+		}
+
+		if err == nil {
+			if _, _, runErr := z.cmd.RunBytes(ctx, nil, "mount", ds); runErr != nil {
+				err = fmt.Errorf("mount_failed: %w", runErr)
+			}
+		}
+
+		if err != nil {
+			failed[ds] = true
+		}
+		report.add(ds, UnlockActionMount, err)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,106 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestZFS_UnlockAll(t *testing.T) {
+	ctx := context.Background()
+	runner := newStdinRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: runner,
+		},
+	}
+
+	keys := NewMemoryKeyStore()
+	keys.Store(ctx, "tank/vault", []byte("vault-passphrase"))
+	keys.Store(ctx, "tank/broken/inner", []byte("inner-passphrase"))
+
+	enc := func(root, status, canmount, mountpoint, mounted string) map[string]string {
+		return map[string]string{
+			"encryptionroot": root + "|NONE",
+			"keystatus":      status + "|NONE",
+			"keyformat":      "passphrase|LOCAL",
+			"canmount":       canmount + "|DEFAULT",
+			"mountpoint":     mountpoint + "|DEFAULT",
+			"mounted":        mounted + "|NONE",
+		}
+	}
+
+	runner.AddCommand("zfs get -p -r -t fs,vol encryptionroot,keystatus,keyformat,canmount,mountpoint,mounted tank -j", datasetListJSON(
+		testDataset{name: "tank", props: enc("-", "-", "on", "/tank", "yes")},
+		testDataset{name: "tank/home", props: enc("tank/home", "unavailable", "on", "/home", "no")},
+		testDataset{name: "tank/home/alice", props: enc("tank/home", "unavailable", "on", "/home/alice", "no")},
+		testDataset{name: "tank/home/alice/www", props: enc("tank/home", "unavailable", "on", "/home/alice/www", "no")},
+		testDataset{name: "tank/home/bob", props: enc("tank/home", "unavailable", "noauto", "/home/bob", "no")},
+		testDataset{name: "tank/vault", props: enc("tank/vault", "unavailable", "on", "/vault", "no")},
+		testDataset{name: "tank/vault/vol", props: enc("tank/vault", "unavailable", "-", "-", "-")},
+		testDataset{name: "tank/broken", props: enc("tank/broken", "unavailable", "on", "/broken", "no")},
+		testDataset{name: "tank/broken/inner", props: enc("tank/broken/inner", "unavailable", "on", "/broken/inner", "no")},
+		testDataset{name: "tank/open", props: enc("tank/open", "available", "on", "/open", "no")},
+	), "", nil)
+
+	runner.AddCommand("zfs load-key -L prompt tank/home", "", "", nil)
+	runner.AddCommand("zfs load-key -L prompt tank/vault", "", "", nil)
+	runner.AddCommand("zfs load-key tank/broken", "", "no key", fmt.Errorf("exit status 1"))
+	runner.AddCommand("zfs load-key -L prompt tank/broken/inner", "", "", nil)
+	runner.AddCommand("zfs mount tank/broken/inner", "", "", nil)
+	runner.AddCommand("zfs mount tank/home/alice/www", "", "", nil)
+	runner.AddCommand("zfs mount tank/home/alice", "", "busy", fmt.Errorf("exit status 1"))
+	runner.AddCommand("zfs mount tank/home", "", "", nil)
+	runner.AddCommand("zfs mount tank/vault", "", "", nil)
+
+	report, err := client.UnlockAll(ctx, "tank", UnlockOptions{
+		Passphrases: map[string]string{"tank/home": "home-passphrase"},
+		Keys:        keys,
+	})
+	if err != nil {
+		t.Fatalf("UnlockAll returned error: %v", err)
+	}
+
+	var got []string
+	for _, r := range report.Results {
+		got = append(got, fmt.Sprintf("%s %s %v", r.Action, r.Dataset, r.Err == nil))
+	}
+
+	want := []string{
+		"load-key tank/broken false",
+		"load-key tank/broken/inner true",
+		"load-key tank/home true",
+		"load-key tank/vault true",
+		"mount tank/home true",
+		"mount tank/vault true",
+		"mount tank/broken/inner false",
+		"mount tank/home/alice false",
+		"mount tank/home/alice/www false",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected report:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if len(report.Failed()) != 4 {
+		t.Errorf("Expected 4 failures, got %d", len(report.Failed()))
+	}
+
+	if got := runner.stdin["zfs load-key -L prompt tank/home"]; got != "home-passphrase\n" {
+		t.Errorf("tank/home key input = %q", got)
+	}
+	if got := runner.stdin["zfs load-key -L prompt tank/vault"]; got != "vault-passphrase\n" {
+		t.Errorf("tank/vault key input = %q", got)
+	}
+
+	for _, call := range runner.CallHistory {
+		if call.Cmd == "zfs mount tank/home/alice/www" {
+			t.Error("Child of a failed mount should not be mounted")
+		}
+		if call.Cmd == "zfs mount tank/broken/inner" {
+			t.Error("Child of a file system whose key failed to load should not be mounted")
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package gzfs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// metadataChunkSize keeps each metadata chunk below the 8 KiB user property limit
+// with room for multi-byte runes that are never split across chunks.
+const metadataChunkSize = 8000
+
+func validateUserPropertyPart(label, s string) error {
+	if s == "" {
+		return fmt.Errorf("%s is empty", label)
+	}
+
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == '-':
+		default:
+			return fmt.Errorf("invalid character %q in %s %q", r, label, s)
+		}
+	}
+
+	return nil
+}
+
+func userPropertyName(namespace, key string) (string, error) {
+	if err := validateUserPropertyPart("namespace", namespace); err != nil {
+		return "", err
+	}
+	if err := validateUserPropertyPart("key", key); err != nil {
+		return "", err
+	}
+
+	name := namespace + ":" + key
+	if len(name) > maxUserPropertyNameLen {
+		return "", fmt.Errorf("user property name %q is too long", name)
+	}
+
+	return name, nil
+}
+
+func isUnsetUserProperty(prop ZFSProperty) bool {
+	return prop.Value == "-" && prop.Source.Origin() == OriginNone
+}
+
+func (z *zfs) getAllProperties(ctx context.Context, dataset string) (map[string]ZFSProperty, error) {
+	var resp DatasetList
+
+	args := append([]string{"get"}, zfsArgs...)
+	args = append(args, "all", dataset)
+
+	if err := z.cmd.RunJSON(ctx, &resp, args...); err != nil {
+		return nil, err
+	}
+
+	ds, ok := resp.Datasets[dataset]
+	if !ok || ds == nil {
+		return nil, fmt.Errorf("dataset %q not found in zfs get output", dataset)
+	}
+
+	return ds.Properties, nil
+}
+
+// UserProperties returns the user properties in namespace set on or inherited by
+// dataset, keyed by the part after "namespace:".
+func (z *zfs) UserProperties(ctx context.Context, dataset, namespace string) (map[string]ZFSProperty, error) {
+	if dataset == "" {
+		return nil, fmt.Errorf("dataset name is empty")
+	}
+	if err := validateUserPropertyPart("namespace", namespace); err != nil {
+		return nil, err
+	}
+
+	all, err := z.getAllProperties(ctx, dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := namespace + ":"
+	props := make(map[string]ZFSProperty)
+	for name, prop := range all {
+		if key, ok := strings.CutPrefix(name, prefix); ok && !isUnsetUserProperty(prop) {
+			props[key] = prop
+		}
+	}
+
+	return props, nil
+}
+
+// GetUserProperty returns the value of namespace:key on dataset and whether it is set.
+func (z *zfs) GetUserProperty(ctx context.Context, dataset, namespace, key string) (string, bool, error) {
+	name, err := userPropertyName(namespace, key)
+	if err != nil {
+		return "", false, err
+	}
+
+	prop, err := z.GetProperty(ctx, dataset, name)
+	if err != nil {
+		return "", false, err
+	}
+
+	if isUnsetUserProperty(prop) {
+		return "", false, nil
+	}
+
+	return prop.Value, true, nil
+}
+
+// SetUserProperties sets every key in values under namespace with a single zfs set.
+func (z *zfs) SetUserProperties(ctx context.Context, dataset, namespace string, values map[string]string) error {
+	if dataset == "" {
+		return fmt.Errorf("dataset name is empty")
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("no_properties_to_set")
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := []string{"set"}
+	for _, key := range keys {
+		name, err := userPropertyName(namespace, key)
+		if err != nil {
+			return err
+		}
+		if err := ValidateProperty("", name, values[key], false); err != nil {
+			return err
+		}
+		args = append(args, fmt.Sprintf("%s=%s", name, values[key]))
+	}
+	args = append(args, dataset)
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, args...); err != nil {
+		return fmt.Errorf("set_user_properties_failed: %w", err)
+	}
+
+	return nil
+}
+
+// InheritUserProperties clears namespace:key for each key so the value is inherited
+// from the parent again, optionally on all descendants too.
+func (z *zfs) InheritUserProperties(ctx context.Context, dataset, namespace string, recursive bool, keys ...string) error {
+	if dataset == "" {
+		return fmt.Errorf("dataset name is empty")
+	}
+
+	for _, key := range keys {
+		name, err := userPropertyName(namespace, key)
+		if err != nil {
+			return err
+		}
+
+		args := []string{"inherit"}
+		if recursive {
+			args = append(args, "-r")
+		}
+		args = append(args, name, dataset)
+
+		if _, _, err := z.cmd.RunBytes(ctx, nil, args...); err != nil {
+			return fmt.Errorf("inherit_user_property_failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// FindByUserProperty returns the file systems and volumes whose namespace:key equals
+// value, sorted by name. Inherited values only count when includeInherited is set.
+func (z *zfs) FindByUserProperty(ctx context.Context, namespace, key, value string, includeInherited bool) ([]string, error) {
+	name, err := userPropertyName(namespace, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp DatasetList
+
+	args := append([]string{"get"}, zfsArgs...)
+	args = append(args, "-t", "filesystem,volume", name)
+
+	if err := z.cmd.RunJSON(ctx, &resp, args...); err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for dsName, ds := range resp.Datasets {
+		if ds == nil {
+			continue
+		}
+
+		prop, ok := ds.Properties[name]
+		if !ok || isUnsetUserProperty(prop) || prop.Value != value {
+			continue
+		}
+
+		if prop.Source.Origin() == OriginInherited && !includeInherited {
+			continue
+		}
+
+		matches = append(matches, dsName)
+	}
+
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func splitMetadata(payload string) []string {
+	var chunks []string
+
+	for len(payload) > metadataChunkSize {
+		cut := metadataChunkSize
+		for cut > 0 && !utf8.RuneStart(payload[cut]) {
+			cut--
+		}
+		chunks = append(chunks, payload[:cut])
+		payload = payload[cut:]
+	}
+
+	return append(chunks, payload)
+}
+
+func metadataCountKey(key string) string {
+	return key + ".n"
+}
+
+func metadataChunkKey(key string, i int) string {
+	return key + "." + strconv.Itoa(i)
+}
+
+// SetMetadata stores v as JSON in namespace:key on dataset. Payloads larger than a
+// single user property are split across numbered properties and written, together
+// with the chunk count, in one zfs set so readers never see a partial update.
+func (z *zfs) SetMetadata(ctx context.Context, dataset, namespace, key string, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	previous, err := z.UserProperties(ctx, dataset, namespace)
+	if err != nil {
+		return err
+	}
+
+	chunks := splitMetadata(string(payload))
+	values := map[string]string{metadataCountKey(key): strconv.Itoa(len(chunks))}
+	for i, chunk := range chunks {
+		values[metadataChunkKey(key, i)] = chunk
+	}
+
+	if err := z.SetUserProperties(ctx, dataset, namespace, values); err != nil {
+		return err
+	}
+
+	var stale []string
+	if prop, ok := previous[metadataCountKey(key)]; ok && prop.Source.Origin() == OriginLocal {
+		for i := len(chunks); i < int(ParseUint64(prop.Value)); i++ {
+			stale = append(stale, metadataChunkKey(key, i))
+		}
+	}
+
+	if len(stale) > 0 {
+		if err := z.InheritUserProperties(ctx, dataset, namespace, false, stale...); err != nil {
+			return fmt.Errorf("metadata_written_but_cleanup_failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ownUserProperties is UserProperties limited to values set on dataset itself,
+// locally or by zfs receive, so metadata stored on an ancestor is never mixed in.
+func (z *zfs) ownUserProperties(ctx context.Context, dataset, namespace string) (map[string]ZFSProperty, error) {
+	props, err := z.UserProperties(ctx, dataset, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, prop := range props {
+		if origin := prop.Source.Origin(); origin != OriginLocal && origin != OriginReceived {
+			delete(props, key)
+		}
+	}
+
+	return props, nil
+}
+
+// GetMetadata reassembles the JSON stored by SetMetadata into v. It reports false if
+// no metadata is stored under key on dataset itself; inherited chunks are ignored.
+func (z *zfs) GetMetadata(ctx context.Context, dataset, namespace, key string, v any) (bool, error) {
+	props, err := z.ownUserProperties(ctx, dataset, namespace)
+	if err != nil {
+		return false, err
+	}
+
+	countProp, ok := props[metadataCountKey(key)]
+	if !ok {
+		return false, nil
+	}
+
+	count, err := strconv.Atoi(countProp.Value)
+	if err != nil || count < 1 {
+		return false, fmt.Errorf("invalid_metadata_chunk_count: %q", countProp.Value)
+	}
+
+	var sb strings.Builder
+	for i := 0; i < count; i++ {
+		chunk, ok := props[metadataChunkKey(key, i)]
+		if !ok {
+			return false, fmt.Errorf("metadata_chunk_missing: %s", metadataChunkKey(key, i))
+		}
+		sb.WriteString(chunk.Value)
+	}
+
+	if err := json.Unmarshal([]byte(sb.String()), v); err != nil {
+		return false, fmt.Errorf("failed to unmarshal metadata: %w", err)
+	}
+
+	return true, nil
+}
+
+// DeleteMetadata removes the metadata stored under key.
+func (z *zfs) DeleteMetadata(ctx context.Context, dataset, namespace, key string) error {
+	props, err := z.ownUserProperties(ctx, dataset, namespace)
+	if err != nil {
+		return err
+	}
+
+	countProp, ok := props[metadataCountKey(key)]
+	if !ok {
+		return nil
+	}
+
+	keys := []string{metadataCountKey(key)}
+	for i := 0; i < int(ParseUint64(countProp.Value)); i++ {
+		keys = append(keys, metadataChunkKey(key, i))
+	}
+
+	return z.InheritUserProperties(ctx, dataset, namespace, false, keys...)
+}
+
+func (d *Dataset) UserProperties(ctx context.Context, namespace string) (map[string]ZFSProperty, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.UserProperties(ctx, d.Name, namespace)
+}
+
+func (d *Dataset) SetUserProperties(ctx context.Context, namespace string, values map[string]string) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.SetUserProperties(ctx, d.Name, namespace, values)
+}
+
+func (d *Dataset) SetMetadata(ctx context.Context, namespace, key string, v any) error {
+	if d == nil {
+		return fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.SetMetadata(ctx, d.Name, namespace, key, v)
+}
+
+func (d *Dataset) GetMetadata(ctx context.Context, namespace, key string, v any) (bool, error) {
+	if d == nil {
+		return false, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return false, fmt.Errorf("no zfs client attached")
+	}
+
+	return d.z.GetMetadata(ctx, d.Name, namespace, key, v)
+}
@@ -0,0 +1,247 @@
+package gzfs
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+type appMetadata struct {
+	Owner string   `json:"owner"`
+	Tags  []string `json:"tags"`
+	Blob  string   `json:"blob"`
+}
+
+func TestUserPropertyName(t *testing.T) {
+	if name, err := userPropertyName("com.ourco", "owner"); err != nil || name != "com.ourco:owner" {
+		t.Errorf("userPropertyName = %q, %v", name, err)
+	}
+
+	for _, tt := range [][2]string{{"", "owner"}, {"com.ourco", ""}, {"Com.Ourco", "owner"}, {"com.ourco", "a:b"}, {"com ourco", "x"}, {"com.ourco", "a+b"}, {"com+ourco", "x"}} {
+		if _, err := userPropertyName(tt[0], tt[1]); err == nil {
+			t.Errorf("Expected error for namespace %q key %q", tt[0], tt[1])
+		}
+	}
+}
+
+func TestSplitMetadata(t *testing.T) {
+	if chunks := splitMetadata(`{"a":1}`); len(chunks) != 1 {
+		t.Fatalf("Expected 1 chunk, got %d", len(chunks))
+	}
+
+	payload := strings.Repeat("é", metadataChunkSize)
+	chunks := splitMetadata(payload)
+	if len(chunks) != 2 {
+		t.Fatalf("Expected 2 chunks, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if len(chunk) > metadataChunkSize {
+			t.Errorf("chunk %d too large: %d", i, len(chunk))
+		}
+		if !utf8.ValidString(chunk) {
+			t.Errorf("chunk %d splits a rune", i)
+		}
+	}
+	if strings.Join(chunks, "") != payload {
+		t.Error("chunks do not reassemble to the payload")
+	}
+}
+
+func TestZFS_UserProperties(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	mockRunner.AddCommand("zfs get -p all tank/app -j", datasetListJSON(
+		testDataset{name: "tank/app", typ: DatasetTypeFilesystem, props: map[string]string{
+			"compression":      "lz4|LOCAL",
+			"com.ourco:owner":  "alice|LOCAL",
+			"com.ourco:team":   "infra|INHERITED|tank",
+			"com.other:owner":  "bob|LOCAL",
+			"com.ourco:absent": "-|-",
+		}},
+	), "", nil)
+
+	props, err := client.UserProperties(ctx, "tank/app", "com.ourco")
+	if err != nil {
+		t.Fatalf("UserProperties returned error: %v", err)
+	}
+
+	if len(props) != 2 || props["owner"].Value != "alice" || props["team"].Source.Data != "tank" {
+		t.Errorf("Unexpected user properties: %+v", props)
+	}
+
+	mockRunner.AddCommand("zfs set com.ourco:owner=carol com.ourco:team=storage tank/app", "", "", nil)
+	ds := &Dataset{z: client, Name: "tank/app", Type: DatasetTypeFilesystem}
+	if err := ds.SetUserProperties(ctx, "com.ourco", map[string]string{"team": "storage", "owner": "carol"}); err != nil {
+		t.Fatalf("SetUserProperties returned error: %v", err)
+	}
+
+	mockRunner.AddCommand("zfs inherit -r com.ourco:owner tank/app", "", "", nil)
+	if err := client.InheritUserProperties(ctx, "tank/app", "com.ourco", true, "owner"); err != nil {
+		t.Fatalf("InheritUserProperties returned error: %v", err)
+	}
+}
+
+func TestZFS_FindByUserProperty(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	mockRunner.AddCommand("zfs get -p -t filesystem,volume com.ourco:role -j", datasetListJSON(
+		testDataset{name: "tank/web", props: map[string]string{"com.ourco:role": "frontend|LOCAL"}},
+		testDataset{name: "tank/web/cache", props: map[string]string{"com.ourco:role": "frontend|INHERITED|tank/web"}},
+		testDataset{name: "tank/db", props: map[string]string{"com.ourco:role": "database|LOCAL"}},
+		testDataset{name: "tank/api", props: map[string]string{"com.ourco:role": "frontend|RECEIVED"}},
+		testDataset{name: "tank/tmp", props: map[string]string{"com.ourco:role": "-|NONE"}},
+	), "", nil)
+
+	names, err := client.FindByUserProperty(ctx, "com.ourco", "role", "frontend", false)
+	if err != nil {
+		t.Fatalf("FindByUserProperty returned error: %v", err)
+	}
+	if got := strings.Join(names, ","); got != "tank/api,tank/web" {
+		t.Errorf("Unexpected matches: %s", got)
+	}
+
+	names, err = client.FindByUserProperty(ctx, "com.ourco", "role", "frontend", true)
+	if err != nil {
+		t.Fatalf("FindByUserProperty returned error: %v", err)
+	}
+	if got := strings.Join(names, ","); got != "tank/api,tank/web,tank/web/cache" {
+		t.Errorf("Unexpected matches with inherited: %s", got)
+	}
+}
+
+func TestZFS_Metadata(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	meta := appMetadata{Owner: "alice", Tags: []string{"prod"}, Blob: strings.Repeat("x", 12000)}
+
+	// Previously stored as three chunks; the new payload needs two.
+	mockRunner.AddCommand("zfs get -p all tank/app -j", datasetListJSON(
+		testDataset{name: "tank/app", typ: DatasetTypeFilesystem, props: map[string]string{
+			"com.ourco:meta.n": "3|LOCAL",
+		}},
+	), "", nil)
+	mockRunner.AddCommand("zfs set com.ourco:meta.0=", "", "", nil)
+	mockRunner.AddCommand("zfs inherit com.ourco:meta.2 tank/app", "", "", nil)
+
+	if err := client.SetMetadata(ctx, "tank/app", "com.ourco", "meta", meta); err != nil {
+		t.Fatalf("SetMetadata returned error: %v", err)
+	}
+
+	var setCalls [][]string
+	for _, call := range mockRunner.CallHistory {
+		if len(call.Args) > 0 && call.Args[0] == "set" {
+			setCalls = append(setCalls, call.Args)
+		}
+	}
+	if len(setCalls) != 1 {
+		t.Fatalf("Expected exactly one zfs set, got %d", len(setCalls))
+	}
+
+	stored := map[string]string{}
+	set := setCalls[0]
+	if set[len(set)-1] != "tank/app" {
+		t.Fatalf("Unexpected set target: %v", set[len(set)-1])
+	}
+	for _, kv := range set[1 : len(set)-1] {
+		k, v, _ := strings.Cut(kv, "=")
+		if len(v) > maxUserPropertyValueLen {
+			t.Errorf("%s exceeds the user property limit: %d bytes", k, len(v))
+		}
+		stored[k] = v
+	}
+	if stored["com.ourco:meta.n"] != "2" {
+		t.Fatalf("Expected 2 chunks, got %q", stored["com.ourco:meta.n"])
+	}
+
+	last := mockRunner.GetLastCall()
+	if last == nil || last.Cmd != "zfs inherit com.ourco:meta.2 tank/app" {
+		t.Errorf("Expected stale chunk cleanup, last call: %+v", last)
+	}
+
+	readBack := testutil.NewMockRunner()
+	client.cmd.Runner = readBack
+	readBack.AddCommand("zfs get -p all tank/app -j", datasetListJSON(
+		testDataset{name: "tank/app", typ: DatasetTypeFilesystem, props: map[string]string{
+			"com.ourco:meta.n": "2|LOCAL",
+			"com.ourco:meta.0": stored["com.ourco:meta.0"] + "|LOCAL",
+			"com.ourco:meta.1": stored["com.ourco:meta.1"] + "|LOCAL",
+		}},
+	), "", nil)
+
+	var got appMetadata
+	ds := &Dataset{z: client, Name: "tank/app"}
+	found, err := ds.GetMetadata(ctx, "com.ourco", "meta", &got)
+	if err != nil {
+		t.Fatalf("GetMetadata returned error: %v", err)
+	}
+	if !found || got.Owner != "alice" || len(got.Blob) != 12000 || got.Tags[0] != "prod" {
+		t.Errorf("Unexpected metadata: found=%v owner=%q blob=%d", found, got.Owner, len(got.Blob))
+	}
+
+	found, err = ds.GetMetadata(ctx, "com.ourco", "other", &got)
+	if err != nil || found {
+		t.Errorf("Expected missing metadata, got found=%v err=%v", found, err)
+	}
+}
+
+func TestZFS_MetadataIgnoresInherited(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+	client := &zfs{cmd: Cmd{Bin: "zfs", Runner: mockRunner}}
+
+	mockRunner.AddCommand("zfs get -p all tank/app/web -j", datasetListJSON(
+		testDataset{name: "tank/app/web", typ: DatasetTypeFilesystem, props: map[string]string{
+			"com.ourco:meta.n":  "1|INHERITED|tank/app",
+			"com.ourco:meta.0":  `{"owner":"bob"}|INHERITED|tank/app`,
+			"com.ourco:other.n": "2|LOCAL",
+			"com.ourco:other.0": `{"owner":|LOCAL`,
+			"com.ourco:other.1": `"alice"}|INHERITED|tank/app`,
+		}},
+	), "", nil)
+
+	var got appMetadata
+	found, err := client.GetMetadata(ctx, "tank/app/web", "com.ourco", "meta", &got)
+	if err != nil || found {
+		t.Errorf("Expected inherited metadata to be ignored, got found=%v err=%v owner=%q", found, err, got.Owner)
+	}
+
+	if _, err := client.GetMetadata(ctx, "tank/app/web", "com.ourco", "other", &got); err == nil || !strings.Contains(err.Error(), "metadata_chunk_missing: other.1") {
+		t.Errorf("Expected inherited chunk to be treated as missing, got %v", err)
+	}
+
+	if err := client.DeleteMetadata(ctx, "tank/app/web", "com.ourco", "meta"); err != nil {
+		t.Fatalf("DeleteMetadata returned error: %v", err)
+	}
+	for _, call := range mockRunner.CallHistory {
+		if len(call.Args) > 0 && call.Args[0] == "inherit" {
+			t.Errorf("DeleteMetadata should not touch inherited chunks: %s", call.Cmd)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// zvolRoot is where udev (Linux) and devfs (FreeBSD) link volumes by dataset name.
+var zvolRoot = "/dev/zvol"
+
+// zvolPollInterval is how often WaitForDevice checks for the device node by default.
+var zvolPollInterval = 100 * time.Millisecond
+
+// Volume wraps a volume dataset with block device helpers.
+type Volume struct {
+	z    *zfs
+	Name string
+
+	// DevRoot is the directory volumes are linked under by name. Empty means /dev/zvol.
+	DevRoot string
+	// PollInterval is how often WaitForDevice checks for the device node. Zero means
+	// every 100ms.
+	PollInterval time.Duration
+}
+
+// ResizeOptions controls Volume.Resize.
+type ResizeOptions struct {
+	// Force allows shrinking, which destroys data past the new end of the volume.
+	Force bool
+}
+
+// ResizeResult reports a volume resize.
+type ResizeResult struct {
+	OldSize              uint64 `json:"oldSize"`
+	NewSize              uint64 `json:"newSize"`
+	Sparse               bool   `json:"sparse"`
+	OldRefreservation    uint64 `json:"oldRefreservation"`
+	NewRefreservation    uint64 `json:"newRefreservation"`
+	RefreservationGrowth uint64 `json:"refreservationGrowth"`
+}
+
+func (d *Dataset) Volume() (*Volume, error) {
+	if d == nil {
+		return nil, fmt.Errorf("dataset is nil")
+	}
+	if d.z == nil {
+		return nil, fmt.Errorf("no zfs client attached")
+	}
+	if d.Type != DatasetTypeVolume {
+		return nil, fmt.Errorf("not_a_volume: %s", d.Name)
+	}
+
+	return &Volume{z: d.z, Name: d.Name}, nil
+}
+
+// LinkPath returns the stable /dev/zvol/<pool>/<name> path of the volume.
+func (v *Volume) LinkPath() string {
+	root := v.DevRoot
+	if root == "" {
+		root = zvolRoot
+	}
+	return filepath.Join(root, v.Name)
+}
+
+// DevicePath resolves LinkPath to the underlying device node, such as /dev/zd0.
+func (v *Volume) DevicePath() (string, error) {
+	p, err := filepath.EvalSymlinks(v.LinkPath())
+	if err != nil {
+		return "", fmt.Errorf("zvol_device_not_found: %w", err)
+	}
+	return p, nil
+}
+
+// WaitForDevice waits until the device node of the volume exists and returns its
+// resolved path, or gives up when ctx is done.
+func (v *Volume) WaitForDevice(ctx context.Context) (string, error) {
+	interval := v.PollInterval
+	if interval <= 0 {
+		interval = zvolPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if p, err := v.DevicePath(); err == nil {
+			if _, statErr := os.Stat(p); statErr == nil {
+				return p, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("zvol_device_wait_failed: %s: %w", v.LinkPath(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (v *Volume) properties(ctx context.Context, props ...string) (map[string]ZFSProperty, error) {
+	all, err := v.z.GetProperties(ctx, []string{v.Name}, props, GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	p, ok := all[v.Name]
+	if !ok {
+		return nil, fmt.Errorf("dataset %q not found in zfs get output", v.Name)
+	}
+
+	return p, nil
+}
+
+// Mode returns the current volmode of the volume.
+func (v *Volume) Mode(ctx context.Context) (VolModeType, error) {
+	p, err := v.properties(ctx, "volmode")
+	if err != nil {
+		return "", err
+	}
+
+	return parseEnum[VolModeType](p["volmode"].Value), nil
+}
+
+// Resize sets volsize to size. Shrinking is refused unless opts.Force is set. For
+// thick-provisioned volumes, whose refreservation zfs grows with volsize, the growth
+// must fit in the space available to the volume.
+func (v *Volume) Resize(ctx context.Context, size uint64, opts ResizeOptions) (*ResizeResult, error) {
+	if size == 0 {
+		return nil, fmt.Errorf("invalid_volume_size: 0")
+	}
+
+	p, err := v.properties(ctx, "volsize", "volblocksize", "refreservation", "available")
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ResizeResult{
+		OldSize:           ParseSize(p["volsize"].Value),
+		NewSize:           size,
+		OldRefreservation: ParseSize(p["refreservation"].Value),
+	}
+	if res.OldSize == 0 {
+		return nil, fmt.Errorf("volsize of %s is unknown", v.Name)
+	}
+	res.Sparse = res.OldRefreservation < res.OldSize
+
+	if blockSize := ParseSize(p["volblocksize"].Value); blockSize > 0 && size%blockSize != 0 {
+		return nil, fmt.Errorf("invalid_volume_size: %d is not a multiple of volblocksize %d", size, blockSize)
+	}
+
+	if size == res.OldSize {
+		res.NewRefreservation = res.OldRefreservation
+		return res, nil
+	}
+
+	if size < res.OldSize && !opts.Force {
+		return nil, fmt.Errorf("volume_shrink_refused: %s from %d to %d bytes", v.Name, res.OldSize, size)
+	}
+
+	if size > res.OldSize && !res.Sparse {
+		// zfs scales refreservation with volsize, metadata overhead included.
+		growth := uint64(float64(res.OldRefreservation) / float64(res.OldSize) * float64(size-res.OldSize))
+		if available := ParseSize(p["available"].Value); growth > available {
+			return nil, fmt.Errorf("insufficient_space_for_refreservation: %s needs %d more bytes, %d available", v.Name, growth, available)
+		}
+	}
+
+	if _, _, err := v.z.cmd.RunBytes(ctx, nil, "set", "volsize="+strconv.FormatUint(size, 10), v.Name); err != nil {
+		return nil, fmt.Errorf("volume_resize_failed: %w", err)
+	}
+
+	after, err := v.properties(ctx, "refreservation")
+	if err != nil {
+		return nil, fmt.Errorf("volume_resized_but_refresh_failed: %w", err)
+	}
+
+	res.NewRefreservation = ParseSize(after["refreservation"].Value)
+	if res.NewRefreservation > res.OldRefreservation {
+		res.RefreservationGrowth = res.NewRefreservation - res.OldRefreservation
+	}
+
+	return res, nil
+}
@@ -0,0 +1,117 @@
+package gzfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+func TestVolume_WaitForDevice(t *testing.T) {
+	root := t.TempDir()
+
+	ds := &Dataset{z: &zfs{}, Name: "tank/vms/disk0", Type: DatasetTypeVolume}
+	vol, err := ds.Volume()
+	if err != nil {
+		t.Fatalf("Volume returned error: %v", err)
+	}
+
+	if vol.LinkPath() != "/dev/zvol/tank/vms/disk0" {
+		t.Errorf("Unexpected default link path: %s", vol.LinkPath())
+	}
+
+	vol.DevRoot, vol.PollInterval = filepath.Join(root, "zvol"), 5*time.Millisecond
+	link := vol.LinkPath()
+	if link != filepath.Join(root, "zvol", "tank/vms/disk0") {
+		t.Errorf("Unexpected link path: %s", link)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	if _, err := vol.WaitForDevice(ctx); err == nil {
+		t.Error("Expected timeout while the device is missing")
+	}
+	cancel()
+
+	device := filepath.Join(root, "zd0")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(15 * time.Millisecond)
+		os.WriteFile(device, nil, 0o600)
+		os.MkdirAll(filepath.Dir(link), 0o755)
+		os.Symlink("../../../zd0", link)
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	got, err := vol.WaitForDevice(ctx)
+	<-done
+	if err != nil {
+		t.Fatalf("WaitForDevice returned error: %v", err)
+	}
+	if want, _ := filepath.EvalSymlinks(device); got != want {
+		t.Errorf("WaitForDevice = %s, want %s", got, want)
+	}
+
+	if _, err := (&Dataset{z: &zfs{}, Name: "tank/fs", Type: DatasetTypeFilesystem}).Volume(); err == nil {
+		t.Error("Expected error for a file system")
+	}
+}
+
+func TestVolume_Resize(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+
+	client := &zfs{
+		cmd: Cmd{
+			Bin:    "zfs",
+			Runner: mockRunner,
+		},
+	}
+
+	vol := &Volume{z: client, Name: "tank/vol"}
+
+	mockRunner.AddCommand("zfs get -p volsize,volblocksize,refreservation,available tank/vol -j", datasetListJSON(
+		testDataset{name: "tank/vol", props: map[string]string{
+			"volsize":        "10737418240|LOCAL",
+			"volblocksize":   "16384|DEFAULT",
+			"refreservation": "11005853696|LOCAL",
+			"available":      "16106127360|NONE",
+		}},
+	), "", nil)
+	mockRunner.AddCommand("zfs get -p refreservation tank/vol -j", datasetListJSON(
+		testDataset{name: "tank/vol", props: map[string]string{"refreservation": "22011707392|LOCAL"}},
+	), "", nil)
+	mockRunner.AddCommand("zfs set volsize=21474836480 tank/vol", "", "", nil)
+	mockRunner.AddCommand("zfs get -p volmode tank/vol -j", datasetListJSON(
+		testDataset{name: "tank/vol", props: map[string]string{"volmode": "dev|LOCAL"}},
+	), "", nil)
+
+	res, err := vol.Resize(ctx, 20<<30, ResizeOptions{})
+	if err != nil {
+		t.Fatalf("Resize returned error: %v", err)
+	}
+	if res.Sparse || res.OldSize != 10<<30 || res.RefreservationGrowth != 22011707392-11005853696 {
+		t.Errorf("Unexpected resize result: %+v", res)
+	}
+
+	if _, err := vol.Resize(ctx, 5<<30, ResizeOptions{}); err == nil || !strings.Contains(err.Error(), "volume_shrink_refused") {
+		t.Errorf("Expected shrink refusal, got %v", err)
+	}
+	if _, err := vol.Resize(ctx, 10<<30+1, ResizeOptions{}); err == nil {
+		t.Error("Expected error for a size that is not a multiple of volblocksize")
+	}
+	if _, err := vol.Resize(ctx, 30<<30, ResizeOptions{}); err == nil || !strings.Contains(err.Error(), "insufficient_space_for_refreservation") {
+		t.Errorf("Expected refreservation error, got %v", err)
+	}
+
+	mode, err := vol.Mode(ctx)
+	if err != nil || mode != VolModeDev {
+		t.Errorf("Mode = %q, %v", mode, err)
+	}
+}
@@ -587,11 +587,23 @@ func (p *ZPool) GetProperty(name string) (ZFSProperty, error) {
 	return prop, nil
 }
 
-func (p *ZPool) Destroy(ctx context.Context) error {
+// Destroy destroys the pool. When SafetyOptions require confirmation, the pool name
+// must be passed as confirm.
+func (p *ZPool) Destroy(ctx context.Context, confirm ...string) error {
 	if p.z == nil {
 		return fmt.Errorf("no zpool client attached")
 	}
 
+	if p.z.zfs != nil {
+		var token string
+		if len(confirm) > 0 {
+			token = confirm[0]
+		}
+		if err := p.z.zfs.checkPoolDestroy(p.Name, token); err != nil {
+			return err
+		}
+	}
+
 	_, _, err := p.z.cmd.RunBytes(ctx, nil, "destroy", p.Name)
 	return err
 }
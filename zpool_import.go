@@ -0,0 +1,354 @@
+package gzfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ImportScanOptions controls where zpool import looks for pools.
+type ImportScanOptions struct {
+	// Dirs are searched for devices or files instead of the default device
+	// directories (-d). File-backed vdevs need the directory holding the files.
+	Dirs []string
+	// Destroyed lists or imports destroyed pools only (-D).
+	Destroyed bool
+}
+
+// ImportOptions controls Import.
+type ImportOptions struct {
+	ImportScanOptions
+	// NewName imports the pool under a different name.
+	NewName string
+	// AltRoot mounts the pool's file systems under this directory and implies
+	// cachefile=none (-R).
+	AltRoot string
+	// ReadOnly imports the pool with readonly=on.
+	ReadOnly bool
+	// Force imports a pool that appears to be in use by another system (-f).
+	Force bool
+	// NoMount imports without mounting any file systems (-N).
+	NoMount bool
+	// CacheFile sets the cachefile pool property, such as "none".
+	CacheFile string
+	// Properties are other pool properties set at import (-o).
+	Properties map[string]string
+}
+
+// ImportableVdev is a vdev in the config tree of an importable pool. Section entries
+// such as logs, cache and spares have no state.
+type ImportableVdev struct {
+	Name     string            `json:"name"`
+	State    string            `json:"state,omitempty"`
+	Message  string            `json:"message,omitempty"`
+	Children []*ImportableVdev `json:"children,omitempty"`
+}
+
+// ImportablePool is a pool found by zpool import.
+type ImportablePool struct {
+	Name      string          `json:"name"`
+	GUID      string          `json:"guid"`
+	State     ZPoolState      `json:"state"`
+	Destroyed bool            `json:"destroyed"`
+	Status    string          `json:"status,omitempty"`
+	Action    string          `json:"action,omitempty"`
+	Comment   string          `json:"comment,omitempty"`
+	See       string          `json:"see,omitempty"`
+	Config    *ImportableVdev `json:"config,omitempty"`
+}
+
+func importScanArgs(args []string, opts ImportScanOptions) []string {
+	for _, dir := range opts.Dirs {
+		args = append(args, "-d", dir)
+	}
+	if opts.Destroyed {
+		args = append(args, "-D")
+	}
+	return args
+}
+
+// parseImportConfig builds the vdev tree from the config lines of a pool, which
+// indent every level by two spaces after a leading tab.
+func parseImportConfig(lines []string) (*ImportableVdev, error) {
+	var root *ImportableVdev
+	var stack []*ImportableVdev
+	// Once a section has been seen, every following line sits one level deeper in
+	// the tree than it is indented.
+	offset := 0
+
+	for _, line := range lines {
+		line = strings.TrimPrefix(line, "\t")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" {
+			continue
+		}
+
+		depth := (len(line) - len(trimmed)) / 2
+		fields := strings.Fields(trimmed)
+
+		v := &ImportableVdev{Name: fields[0]}
+		if len(fields) > 1 {
+			v.State = fields[1]
+		}
+		if len(fields) > 2 {
+			v.Message = strings.Join(fields[2:], " ")
+		}
+
+		if depth == 0 {
+			// Only the first depth-0 line is the pool; logs, cache and spares follow
+			// at the same depth but belong to it.
+			if root == nil {
+				root = v
+				stack = []*ImportableVdev{root}
+				continue
+			}
+			offset = 1
+		}
+		depth += offset
+
+		if depth > len(stack) {
+			return nil, fmt.Errorf("unexpected_import_config: %q", line)
+		}
+
+		parent := stack[depth-1]
+		parent.Children = append(parent.Children, v)
+		stack = append(stack[:depth], v)
+	}
+
+	return root, nil
+}
+
+// importHeader splits a "  key: value" line. Continuation and config lines start
+// with a tab instead.
+func importHeader(line string) (string, string, bool) {
+	if strings.HasPrefix(line, "\t") {
+		return "", "", false
+	}
+
+	name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+	if !ok || name == "" || strings.Contains(name, " ") || (value != "" && value[0] != ' ') {
+		return "", "", false
+	}
+
+	return name, strings.TrimSpace(value), true
+}
+
+func parseImportable(out []byte) ([]ImportablePool, error) {
+	pools := []ImportablePool{}
+
+	var pool *ImportablePool
+	var key string
+	var config []string
+
+	finish := func() error {
+		if pool == nil {
+			return nil
+		}
+		if len(config) > 0 {
+			root, err := parseImportConfig(config)
+			if err != nil {
+				return err
+			}
+			pool.Config = root
+		}
+		pools = append(pools, *pool)
+		pool, config = nil, nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if name, value, ok := importHeader(line); ok {
+			key = name
+
+			if key == "pool" {
+				if err := finish(); err != nil {
+					return nil, err
+				}
+				pool = &ImportablePool{Name: value}
+				continue
+			}
+			if pool == nil {
+				return nil, fmt.Errorf("unexpected_import_output: %q", line)
+			}
+
+			switch key {
+			case "id":
+				pool.GUID = value
+			case "state":
+				state, destroyed := strings.CutSuffix(value, " (DESTROYED)")
+				pool.State, pool.Destroyed = ZPoolState(state), destroyed
+			case "status":
+				pool.Status = value
+			case "action":
+				pool.Action = value
+			case "comment":
+				pool.Comment = value
+			case "see":
+				pool.See = value
+			}
+			continue
+		}
+
+		if pool == nil || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// Indented lines continue the previous field or belong to the config tree.
+		text := strings.TrimSpace(line)
+		switch key {
+		case "config":
+			config = append(config, line)
+		case "status":
+			pool.Status += " " + text
+		case "action":
+			pool.Action += " " + text
+		case "comment":
+			pool.Comment += " " + text
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse import output: %w", err)
+	}
+
+	if err := finish(); err != nil {
+		return nil, err
+	}
+
+	return pools, nil
+}
+
+// Importable lists the pools that can be imported. It never imports anything.
+func (z *zpool) Importable(ctx context.Context, opts ImportScanOptions) ([]ImportablePool, error) {
+	out, _, err := z.cmd.RunBytes(ctx, nil, importScanArgs([]string{"import"}, opts)...)
+	if err != nil {
+		// zpool import exits non-zero when there is nothing to import.
+		var cmdErr *CmdError
+		if errors.As(err, &cmdErr) && strings.Contains(cmdErr.Stderr, "no pools available to import") {
+			return []ImportablePool{}, nil
+		}
+		return nil, fmt.Errorf("pool_import_scan_failed: %w", err)
+	}
+
+	return parseImportable(out)
+}
+
+func importArgs(nameOrGUID string, opts ImportOptions) []string {
+	args := importScanArgs([]string{"import"}, opts.ImportScanOptions)
+
+	if opts.Force {
+		args = append(args, "-f")
+	}
+	if opts.NoMount {
+		args = append(args, "-N")
+	}
+	if opts.AltRoot != "" {
+		args = append(args, "-R", opts.AltRoot)
+	}
+
+	props := make(map[string]string, len(opts.Properties)+2)
+	for k, v := range opts.Properties {
+		props[k] = v
+	}
+	if opts.ReadOnly {
+		props["readonly"] = "on"
+	}
+	if opts.CacheFile != "" {
+		props["cachefile"] = opts.CacheFile
+	}
+
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		args = append(args, "-o", fmt.Sprintf("%s=%s", k, props[k]))
+	}
+
+	args = append(args, nameOrGUID)
+	if opts.NewName != "" {
+		args = append(args, opts.NewName)
+	}
+
+	return args
+}
+
+func isPoolGUID(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Import imports the pool identified by name or numeric GUID and returns it.
+func (z *zpool) Import(ctx context.Context, nameOrGUID string, opts ImportOptions) (*ZPool, error) {
+	if nameOrGUID == "" {
+		return nil, fmt.Errorf("pool name is empty")
+	}
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, importArgs(nameOrGUID, opts)...); err != nil {
+		return nil, fmt.Errorf("pool_import_failed: %w", err)
+	}
+
+	var pool *ZPool
+	var err error
+
+	switch {
+	case opts.NewName != "":
+		pool, err = z.Get(ctx, opts.NewName)
+	case isPoolGUID(nameOrGUID):
+		pool, err = z.GetByGUID(ctx, nameOrGUID)
+	default:
+		pool, err = z.Get(ctx, nameOrGUID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pool_imported_but_lookup_failed: %w", err)
+	}
+	if pool == nil {
+		return nil, fmt.Errorf("pool_imported_but_not_found: %s", nameOrGUID)
+	}
+
+	return pool, nil
+}
+
+// Export exports pool, unmounting its file systems first. Force unmounts busy file
+// systems (-f).
+func (z *zpool) Export(ctx context.Context, pool string, force bool) error {
+	if pool == "" {
+		return fmt.Errorf("pool name is empty")
+	}
+
+	args := []string{"export"}
+	if force {
+		args = append(args, "-f")
+	}
+	args = append(args, pool)
+
+	if _, _, err := z.cmd.RunBytes(ctx, nil, args...); err != nil {
+		return fmt.Errorf("pool_export_failed: %w", err)
+	}
+
+	return nil
+}
+
+func (p *ZPool) Export(ctx context.Context, force bool) error {
+	if p.z == nil {
+		return fmt.Errorf("no zpool client attached")
+	}
+
+	return p.z.Export(ctx, p.Name, force)
+}
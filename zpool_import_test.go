@@ -0,0 +1,122 @@
+package gzfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/alchemillahq/gzfs/testutil"
+)
+
+const zpoolImportOutput = `   pool: tank
+     id: 15451357997522795478
+  state: ONLINE
+ status: Some supported features are not enabled on the pool.
+	(Note that they may be intentionally disabled if the
+	'compatibility' property is set.)
+ action: The pool can be imported using its name or numeric identifier, though
+	some features will not be available without an explicit 'zpool upgrade'.
+ config:
+
+	tank        ONLINE
+	  mirror-0  ONLINE
+	    /vdevs/a  ONLINE
+	    /vdevs/b  UNAVAIL  cannot open
+	logs
+	  /vdevs/log  ONLINE
+
+   pool: old
+     id: 6023891234
+  state: ONLINE (DESTROYED)
+ action: The pool can be imported using its name or numeric identifier.
+ config:
+
+	old         ONLINE
+	  /vdevs/c  ONLINE
+`
+
+func TestParseImportable(t *testing.T) {
+	pools, err := parseImportable([]byte(zpoolImportOutput))
+	if err != nil {
+		t.Fatalf("parseImportable returned error: %v", err)
+	}
+
+	if len(pools) != 2 {
+		t.Fatalf("Expected 2 pools, got %d", len(pools))
+	}
+
+	tank := pools[0]
+	if tank.Name != "tank" || tank.GUID != "15451357997522795478" || tank.State != ZPoolStateOnline || tank.Destroyed {
+		t.Errorf("Unexpected pool: %+v", tank)
+	}
+	if !strings.HasSuffix(tank.Status, "'compatibility' property is set.)") || !strings.HasSuffix(tank.Action, "'zpool upgrade'.") {
+		t.Errorf("Continuation lines not joined: %q / %q", tank.Status, tank.Action)
+	}
+
+	var tree []string
+	var walk func(v *ImportableVdev, depth int)
+	walk = func(v *ImportableVdev, depth int) {
+		tree = append(tree, fmt.Sprintf("%d:%s:%s", depth, v.Name, v.State))
+		for _, c := range v.Children {
+			walk(c, depth+1)
+		}
+	}
+	walk(tank.Config, 0)
+
+	want := "0:tank:ONLINE 1:mirror-0:ONLINE 2:/vdevs/a:ONLINE 2:/vdevs/b:UNAVAIL 1:logs: 2:/vdevs/log:ONLINE"
+	if strings.Join(tree, " ") != want {
+		t.Errorf("Config tree = %v, want %s", tree, want)
+	}
+	if msg := tank.Config.Children[0].Children[1].Message; msg != "cannot open" {
+		t.Errorf("Unexpected vdev message: %q", msg)
+	}
+
+	if old := pools[1]; old.Name != "old" || !old.Destroyed || old.State != ZPoolStateOnline || len(old.Config.Children) != 1 {
+		t.Errorf("Unexpected destroyed pool: %+v", old)
+	}
+}
+
+func TestZpool_ImportExport(t *testing.T) {
+	ctx := context.Background()
+	mockRunner := testutil.NewMockRunner()
+	z := &zpool{cmd: Cmd{Bin: "zpool", Runner: mockRunner}}
+
+	mockRunner.AddCommand("zpool import -d /vdevs -D", zpoolImportOutput, "", nil)
+	pools, err := z.Importable(ctx, ImportScanOptions{Dirs: []string{"/vdevs"}, Destroyed: true})
+	if err != nil || len(pools) != 2 {
+		t.Fatalf("Importable = %d pools, %v", len(pools), err)
+	}
+
+	mockRunner.AddCommand("zpool import", "", "no pools available to import", fmt.Errorf("exit status 1"))
+	if pools, err := z.Importable(ctx, ImportScanOptions{}); err != nil || len(pools) != 0 {
+		t.Errorf("Importable with nothing to import = %v, %v", pools, err)
+	}
+
+	mockRunner.AddCommand("zpool import -d /vdevs -f -N -R /mnt/recovery -o cachefile=none -o readonly=on 15451357997522795478 tank", "", "", nil)
+	mockRunner.AddCommand("zpool list -o all -v -p tank -P -j", testutil.ZPoolListJSON, "", nil)
+
+	pool, err := z.Import(ctx, "15451357997522795478", ImportOptions{
+		ImportScanOptions: ImportScanOptions{Dirs: []string{"/vdevs"}},
+		NewName:           "tank",
+		AltRoot:           "/mnt/recovery",
+		ReadOnly:          true,
+		Force:             true,
+		NoMount:           true,
+		CacheFile:         "none",
+	})
+	if err != nil {
+		t.Fatalf("Import returned error: %v", err)
+	}
+	if pool == nil || pool.Name != "tank" {
+		t.Errorf("Unexpected pool: %+v", pool)
+	}
+
+	mockRunner.AddCommand("zpool export -f tank", "", "", nil)
+	if err := pool.Export(ctx, true); err != nil {
+		t.Errorf("Export returned error: %v", err)
+	}
+	if last := mockRunner.GetLastCall(); last == nil || strings.Join(last.Args, " ") != "export -f tank" {
+		t.Errorf("Unexpected last call: %+v", last)
+	}
+}